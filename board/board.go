@@ -16,7 +16,10 @@ type Board struct {
 	STM            Color
 	EnPassant      Square
 	Castles        Castles
-	FiftyCnt       Depth
+	// CastleRooks are the starting squares of the castling rooks by color and
+	// side. They are only meaningful while the castling right is present.
+	CastleRooks [Colors][2]Square
+	FiftyCnt    Depth
 }
 
 func StartPos() *Board {
@@ -39,6 +42,18 @@ func (b *Board) ResetHashes() {
 	b.hashes = append(b.hashes, b.calculateHash())
 }
 
+// Copy creates a deep copy of b, including its move history. Moves made on
+// the copy do not affect b.
+func (b *Board) Copy() *Board {
+	cpy := *b
+	cpy.hashes = append(make([]Hashes, 0, cap(b.hashes)), b.hashes...)
+	return &cpy
+}
+
+// Ply is the number of half moves played in the game, calculated from the full
+// move counter.
+func (b *Board) Ply() int { return 2*(b.fullMoves-1) + int(b.STM) }
+
 // ResetFifty resets the fifty move counter.
 func (b *Board) ResetFifty() { b.FiftyCnt = 0 }
 
@@ -47,6 +62,26 @@ func (b *Board) IsEnPassant(sm move.Move) bool {
 	return b.EnPassant != 0 && b.EnPassant == sm.To() && b.SquaresToPiece[sm.From()] == Pawn
 }
 
+// Captured is the piece captured by m, NoPiece if m is not a capture. In
+// Chess960 the king destination of castling can hold its own rook, castling is
+// not a capture.
+func (b *Board) Captured(m move.Move) Piece {
+	if m.IsCastle() {
+		return NoPiece
+	}
+	return b.SquaresToPiece[b.CaptureSq(m)]
+}
+
+// CastleTargets are the king and rook destination squares of the castling
+// move m.
+func CastleTargets(m move.Move) (king, rook Square) {
+	rank := m.From().Rank()
+	if m.To().File() == GFile {
+		return m.To(), SquareAt(FFile, rank)
+	}
+	return m.To(), SquareAt(DFile, rank)
+}
+
 // CaptureSq is mostly just the To() square of m except for an en-passant capture it's the square of the captured pawn.
 func (b *Board) CaptureSq(m move.Move) Square {
 	if b.IsEnPassant(m) {
@@ -101,7 +136,7 @@ func (b *Board) MakeMove(m move.Move) Reverse {
 	piece := b.SquaresToPiece[m.From()]
 	canEnPassant := piece == Pawn && Abs(m.From()-m.To()) == 16 && b.CanEnPassant(m.To())
 	captureSq := b.CaptureSq(m)
-	capture := b.SquaresToPiece[captureSq]
+	capture := b.Captured(m)
 
 	castlingChange := b.Castles ^ b.NewCastles(m)
 
@@ -112,10 +147,10 @@ func (b *Board) MakeMove(m move.Move) Reverse {
 		b.FiftyCnt++
 	}
 
-	hashes.Xor(NoPiece, castlingRand[0]&hashEnable[(castlingChange>>0)&1])
-	hashes.Xor(NoPiece, castlingRand[1]&hashEnable[(castlingChange>>1)&1])
-	hashes.Xor(NoPiece, castlingRand[2]&hashEnable[(castlingChange>>2)&1])
-	hashes.Xor(NoPiece, castlingRand[3]&hashEnable[(castlingChange>>3)&1])
+	hashes.Xor(b.STM, NoPiece, castlingRand[0]&hashEnable[(castlingChange>>0)&1])
+	hashes.Xor(b.STM, NoPiece, castlingRand[1]&hashEnable[(castlingChange>>1)&1])
+	hashes.Xor(b.STM, NoPiece, castlingRand[2]&hashEnable[(castlingChange>>2)&1])
+	hashes.Xor(b.STM, NoPiece, castlingRand[3]&hashEnable[(castlingChange>>3)&1])
 
 	b.Castles ^= castlingChange
 	r.setCastlingChange(castlingChange)
@@ -126,9 +161,18 @@ func (b *Board) MakeMove(m move.Move) Reverse {
 		putPiece = m.Promo()
 	}
 
-	hashes.Xor(capture, b.removePiece(b.STM.Flip(), capture, captureSq))
-	hashes.Xor(piece, b.removePiece(b.STM, piece, m.From()))
-	hashes.Xor(putPiece, b.addPiece(b.STM, putPiece, m.To()))
+	if m.IsCastle() {
+		kingTo, rookTo := CastleTargets(m)
+
+		hashes.Xor(b.STM, Rook, b.removePiece(b.STM, Rook, m.CastleRook()))
+		hashes.Xor(b.STM, King, b.removePiece(b.STM, King, m.From()))
+		hashes.Xor(b.STM, King, b.addPiece(b.STM, King, kingTo))
+		hashes.Xor(b.STM, Rook, b.addPiece(b.STM, Rook, rookTo))
+	} else {
+		hashes.Xor(b.STM.Flip(), capture, b.removePiece(b.STM.Flip(), capture, captureSq))
+		hashes.Xor(b.STM, piece, b.removePiece(b.STM, piece, m.From()))
+		hashes.Xor(b.STM, putPiece, b.addPiece(b.STM, putPiece, m.To()))
+	}
 
 	if b.EnPassant != 0 {
 		hashes.NonPawn ^= epFileRand[b.EnPassant.File()] // remove old enPassant
@@ -143,27 +187,6 @@ func (b *Board) MakeMove(m move.Move) Reverse {
 	r.setEnPassantChange(b.EnPassant ^ newEnPassant)
 	b.EnPassant = newEnPassant
 
-	if piece == King {
-		switch {
-
-		case m.From() == E1 && m.To() == G1:
-			hashes.Xor(NoPiece, b.removePiece(b.STM, Rook, H1))
-			hashes.Xor(NoPiece, b.addPiece(b.STM, Rook, F1))
-
-		case m.From() == E1 && m.To() == C1:
-			hashes.Xor(NoPiece, b.removePiece(b.STM, Rook, A1))
-			hashes.Xor(NoPiece, b.addPiece(b.STM, Rook, D1))
-
-		case m.From() == E8 && m.To() == G8:
-			hashes.Xor(NoPiece, b.removePiece(b.STM, Rook, H8))
-			hashes.Xor(NoPiece, b.addPiece(b.STM, Rook, F8))
-
-		case m.From() == E8 && m.To() == C8:
-			hashes.Xor(NoPiece, b.removePiece(b.STM, Rook, A8))
-			hashes.Xor(NoPiece, b.addPiece(b.STM, Rook, D8))
-		}
-	}
-
 	b.STM = b.STM.Flip()
 	hashes.NonPawn ^= stmRand
 
@@ -181,38 +204,26 @@ func (b *Board) UndoMove(m move.Move, r Reverse) {
 
 	b.STM = b.STM.Flip()
 
-	rmPiece := b.SquaresToPiece[m.To()]
-	piece := rmPiece
-	if m.Promo() != NoPiece {
-		piece = Pawn
-	}
-
-	if piece == King {
-		switch {
-
-		case m.From() == E1 && m.To() == G1:
-			b.removePiece(b.STM, Rook, F1)
-			b.addPiece(b.STM, Rook, H1)
-
-		case m.From() == E1 && m.To() == C1:
-			b.removePiece(b.STM, Rook, D1)
-			b.addPiece(b.STM, Rook, A1)
+	b.EnPassant ^= r.enPassantChange()
 
-		case m.From() == E8 && m.To() == G8:
-			b.removePiece(b.STM, Rook, F8)
-			b.addPiece(b.STM, Rook, H8)
+	if m.IsCastle() {
+		kingTo, rookTo := CastleTargets(m)
 
-		case m.From() == E8 && m.To() == C8:
-			b.removePiece(b.STM, Rook, D8)
-			b.addPiece(b.STM, Rook, A8)
+		b.removePiece(b.STM, Rook, rookTo)
+		b.removePiece(b.STM, King, kingTo)
+		b.addPiece(b.STM, King, m.From())
+		b.addPiece(b.STM, Rook, m.CastleRook())
+	} else {
+		rmPiece := b.SquaresToPiece[m.To()]
+		piece := rmPiece
+		if m.Promo() != NoPiece {
+			piece = Pawn
 		}
-	}
 
-	b.EnPassant ^= r.enPassantChange()
-
-	b.removePiece(b.STM, rmPiece, m.To())
-	b.addPiece(b.STM, piece, m.From())
-	b.addPiece(b.STM.Flip(), r.capture(), b.CaptureSq(m))
+		b.removePiece(b.STM, rmPiece, m.To())
+		b.addPiece(b.STM, piece, m.From())
+		b.addPiece(b.STM.Flip(), r.capture(), b.CaptureSq(m))
+	}
 
 	b.Castles ^= r.castlingChange()
 	b.FiftyCnt = r.fiftyCnt()
@@ -229,20 +240,13 @@ func (b *Board) NewCastles(m move.Move) Castles {
 		affected |= Castle(b.STM, Short) | Castle(b.STM, Long)
 	}
 
-	if m.From() == A1 || m.To() == A1 {
-		affected |= LongWhite
-	}
-
-	if m.From() == H1 || m.To() == H1 {
-		affected |= ShortWhite
-	}
-
-	if m.From() == A8 || m.To() == A8 {
-		affected |= LongBlack
-	}
-
-	if m.From() == H8 || m.To() == H8 {
-		affected |= ShortBlack
+	for color := White; color <= Black; color++ {
+		for side := Short; side <= Long; side++ {
+			rook := b.CastleRooks[color][side]
+			if m.From() == rook || m.To() == rook {
+				affected |= Castle(color, side)
+			}
+		}
 	}
 
 	return b.Castles & ^affected
@@ -281,12 +285,12 @@ func (b *Board) MakeNullMove() Reverse {
 
 	if b.EnPassant != 0 {
 		r.setEnPassantChange(b.EnPassant)
-		hashes.Xor(NoPiece, epFileRand[b.EnPassant.File()])
+		hashes.Xor(b.STM, NoPiece, epFileRand[b.EnPassant.File()])
 		b.EnPassant = 0
 	}
 
 	b.STM = b.STM.Flip()
-	hashes.Xor(NoPiece, stmRand)
+	hashes.Xor(b.STM, NoPiece, stmRand)
 
 	b.hashes = append(b.hashes, hashes)
 	// b.consistencyCheck()
@@ -350,3 +354,9 @@ func (b *Board) Threefold() Depth {
 	}
 	return cnt
 }
+
+// InsufficientMaterial determines whether neither side can checkmate, that is
+// only the kings and at most one minor piece are left.
+func (b *Board) InsufficientMaterial() bool {
+	return b.Pieces[Pawn]|b.Pieces[Rook]|b.Pieces[Queen] == 0 && (b.Pieces[Knight]|b.Pieces[Bishop]).Count() <= 1
+}
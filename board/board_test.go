@@ -12,7 +12,7 @@ import (
 
 func TestCastle(t *testing.T) {
 	b := Must(board.FromFEN("k7/p7/8/8/8/8/8/R3K2R w KQ - 0 1"))
-	m := move.From(E1) | move.To(G1)
+	m := move.Castling(E1, H1)
 
 	r := b.MakeMove(m)
 
@@ -51,6 +51,78 @@ func TestCastle(t *testing.T) {
 	assert.Equal(t, ShortWhite|LongWhite, b.Castles)
 }
 
+func TestCastle960(t *testing.T) {
+	tests := []struct {
+		name  string
+		fen   string
+		m     move.Move
+		after string
+	}{
+		{
+			"king on its destination",
+			"4k3/8/8/8/8/8/8/1R4KR w BH - 0 1",
+			move.Castling(G1, H1),
+			"4k3/8/8/8/8/8/8/1R3RK1 b - - 1 1",
+		},
+		{
+			"king and rook swapping",
+			"4k3/8/8/8/8/8/8/2RK3R w CH - 0 1",
+			move.Castling(D1, C1),
+			"4k3/8/8/8/8/8/8/2KR3R b - - 1 1",
+		},
+		{
+			"black long castle",
+			"1r4kr/8/8/8/8/8/8/4K3 b bh - 0 1",
+			move.Castling(G8, B8),
+			"2kr3r/8/8/8/8/8/8/4K3 w - - 1 2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := Must(board.FromFEN(tt.fen))
+			hashes := b.Hashes()
+
+			r := b.MakeMove(tt.m)
+
+			assert.Equal(t, tt.after, b.FEN())
+			assert.Equal(t, Must(board.FromFEN(tt.after)).Hashes(), b.Hashes())
+
+			b.UndoMove(tt.m, r)
+
+			assert.Equal(t, Must(board.FromFEN(tt.fen)).FEN(), b.FEN())
+			assert.Equal(t, hashes, b.Hashes())
+		})
+	}
+}
+
+func TestCastleEncoding(t *testing.T) {
+	tests := []struct {
+		name        string
+		m           move.Move
+		to, rook    Square
+		std, chs960 string
+	}{
+		{"standard short", move.Castling(E1, H1), G1, H1, "e1g1", "e1h1"},
+		{"standard long", move.Castling(E8, A8), C8, A8, "e8c8", "e8a8"},
+		{"king on its destination", move.Castling(G1, H1), G1, H1, "g1g1", "g1h1"},
+		{"king and rook swapping", move.Castling(D1, C1), C1, C1, "d1c1", "d1c1"},
+		{"black long castle", move.Castling(G8, B8), C8, B8, "g8c8", "g8b8"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// To is the king destination as in standard chess, the history tables
+			// are indexed by it
+			assert.Equal(t, tt.to, tt.m.To())
+			assert.Equal(t, tt.rook, tt.m.CastleRook())
+			assert.Equal(t, NoPiece, tt.m.Promo())
+			assert.Equal(t, tt.std, tt.m.UCI(false))
+			assert.Equal(t, tt.chs960, tt.m.UCI(true))
+		})
+	}
+}
+
 func TestMoveCounts(t *testing.T) {
 	b := Must(board.FromFEN("6k1/1n3ppp/4r3/8/8/3B3P/2R2PP1/6K1 w - - 10 111"))
 
@@ -70,3 +142,62 @@ func TestMoveCounts(t *testing.T) {
 	b.UndoMove(move.From(C2)|move.To(C7), r1)
 	assert.Equal(t, "6k1/1n3ppp/4r3/8/8/3B3P/2R2PP1/6K1 w - - 10 111", b.FEN())
 }
+
+func TestCopy(t *testing.T) {
+	b := Must(board.FromFEN("6k1/1n3ppp/4r3/8/8/3B3P/2R2PP1/6K1 w - - 10 111"))
+	b.MakeMove(move.From(C2) | move.To(C7))
+
+	cpy := b.Copy()
+
+	assert.Equal(t, b.FEN(), cpy.FEN())
+	assert.Equal(t, b.Hashes(), cpy.Hashes())
+
+	cpy.MakeMove(move.From(B7) | move.To(D6))
+
+	assert.Equal(t, "6k1/1nR2ppp/4r3/8/8/3B3P/5PP1/6K1 b - - 11 111", b.FEN())
+	assert.NotEqual(t, b.Hashes(), cpy.Hashes())
+}
+
+func TestInsufficientMaterial(t *testing.T) {
+	tests := []struct {
+		name string
+		fen  string
+		want bool
+	}{
+		{"bare kings", "8/8/4k3/8/8/2K5/8/8 w - - 0 1", true},
+		{"knight", "8/8/4k3/8/8/2KN4/8/8 w - - 0 1", true},
+		{"bishop", "8/8/4kb2/8/8/2K5/8/8 b - - 0 1", true},
+		{"two knights", "8/8/4k3/8/8/2KNN3/8/8 w - - 0 1", false},
+		{"minor each", "8/8/4kn2/8/8/2KB4/8/8 w - - 0 1", false},
+		{"pawn", "8/8/4k3/8/8/2KP4/8/8 w - - 0 1", false},
+		{"rook", "8/8/4k3/8/8/2KR4/8/8 w - - 0 1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := Must(board.FromFEN(tt.fen))
+
+			assert.Equal(t, tt.want, b.InsufficientMaterial())
+		})
+	}
+}
+
+func TestHashKeys(t *testing.T) {
+	b := Must(board.FromFEN("6k1/1n3ppp/4r3/8/8/3B3P/2R2PP1/6K1 w - - 10 111"))
+	hashes, material := b.Hashes(), b.MaterialHash()
+
+	// quiet rook move changes the white non-pawn key only
+	b.MakeMove(move.From(C2) | move.To(C7))
+
+	assert.NotEqual(t, hashes.NonPawns[White], b.Hashes().NonPawns[White])
+	assert.Equal(t, hashes.NonPawns[Black], b.Hashes().NonPawns[Black])
+	assert.Equal(t, hashes.Pawn, b.Hashes().Pawn)
+	assert.Equal(t, material, b.MaterialHash())
+
+	// capture changes the material key
+	b.MakeMove(move.From(B7) | move.To(D6))
+	b.MakeMove(move.From(D3) | move.To(H7))
+
+	assert.NotEqual(t, material, b.MaterialHash())
+	assert.Equal(t, Must(board.FromFEN(b.FEN())).MaterialHash(), b.MaterialHash())
+}
@@ -148,21 +148,39 @@ func (fp *fenParser) stm() error {
 	return nil
 }
 
+// cRights parses the castling rights in standard, X-FEN or Shredder-FEN
+// notation. K, Q, k and q refer to the outermost rook on the given side of the
+// king, file letters refer to the rook on that file.
 func (fp *fenParser) cRights() error {
+	b := fp.b
+	for color := White; color <= Black; color++ {
+		for side := Short; side <= Long; side++ {
+			b.CastleRooks[color][side] = b.outerRook(color, side)
+		}
+	}
+
 	for fp.ix < fp.l && fp.fen[fp.ix] != ' ' {
-		switch fp.fen[fp.ix] {
-		case 'K':
-			fp.b.Castles |= ShortWhite
-		case 'Q':
-			fp.b.Castles |= LongWhite
-		case 'k':
-			fp.b.Castles |= ShortBlack
-		case 'q':
-			fp.b.Castles |= LongBlack
-		case '-':
+		c := fp.fen[fp.ix]
+
+		switch {
+
+		case c == 'K':
+			b.Castles |= ShortWhite
+		case c == 'Q':
+			b.Castles |= LongWhite
+		case c == 'k':
+			b.Castles |= ShortBlack
+		case c == 'q':
+			b.Castles |= LongBlack
+		case c == '-':
+
+		case 'A' <= c && c <= 'H':
+			b.rookCastle(White, Coord(c-'A'))
+		case 'a' <= c && c <= 'h':
+			b.rookCastle(Black, Coord(c-'a'))
 
 		default:
-			return fmt.Errorf("expecting K, Q, k, q or - got %c", fp.fen[fp.ix])
+			return fmt.Errorf("expecting K, Q, k, q, a file letter or - got %c", c)
 		}
 
 		fp.ix++
@@ -170,6 +188,42 @@ func (fp *fenParser) cRights() error {
 	return nil
 }
 
+// outerRook is the square of the outermost rook of color c on side s of its
+// king on the back rank. It defaults to the rook square of standard chess.
+func (b *Board) outerRook(c Color, s Side) Square {
+	rank := FirstRank.FromPerspectiveOf(c)
+	file, step := HFile, Coord(-1)
+	if s == Long {
+		file, step = AFile, 1
+	}
+
+	king := b.Pieces[King] & b.Colors[c] & RankBB(rank)
+	if king == 0 {
+		return SquareAt(file, rank)
+	}
+
+	rooks := b.Pieces[Rook] & b.Colors[c]
+	for f := file; f != king.LowestSet().File(); f += step {
+		if sq := SquareAt(f, rank); rooks&BitBoardFromSquares(sq) != 0 {
+			return sq
+		}
+	}
+	return SquareAt(file, rank)
+}
+
+// rookCastle sets the castling right of color c with the rook on file.
+func (b *Board) rookCastle(c Color, file Coord) {
+	rank := FirstRank.FromPerspectiveOf(c)
+	side := Short
+
+	if king := b.Pieces[King] & b.Colors[c] & RankBB(rank); king != 0 && file < king.LowestSet().File() {
+		side = Long
+	}
+
+	b.Castles |= Castle(c, side)
+	b.CastleRooks[c][side] = SquareAt(file, rank)
+}
+
 func (fp *fenParser) enPassant() error {
 	if fp.fen[fp.ix] != '-' {
 		if fp.ix+1 >= fp.l {
@@ -268,21 +322,26 @@ func (b Board) FEN() string {
 
 	fmt.Fprintf(&sb, " %c ", "wb"[b.STM])
 
-	if b.Castles&ShortWhite != 0 {
-		sb.WriteString("K")
-	}
-
-	if b.Castles&LongWhite != 0 {
-		sb.WriteString("Q")
-	}
+	for color := White; color <= Black; color++ {
+		for side := Short; side <= Long; side++ {
+			if b.Castles&Castle(color, side) == 0 {
+				continue
+			}
 
-	if b.Castles&ShortBlack != 0 {
-		sb.WriteString("k")
+			// X-FEN: the file letter is only needed if the rook is not the
+			// outermost one
+			rook := b.CastleRooks[color][side]
+			c := "KQ"[side]
+			if rook != b.outerRook(color, side) {
+				c = byte('A' + rook.File())
+			}
+			if color == Black {
+				c += 'a' - 'A'
+			}
+			sb.WriteByte(c)
+		}
 	}
 
-	if b.Castles&LongBlack != 0 {
-		sb.WriteString("q")
-	}
 	if b.Castles == 0 {
 		sb.WriteString("-")
 	}
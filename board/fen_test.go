@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/paulsonkoly/chess-3/board"
+	. "github.com/paulsonkoly/chess-3/chess"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -73,8 +74,8 @@ func TestFENConversion(t *testing.T) {
 		},
 		{
 			name: "Invalid castling rights character",
-			fen:  "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KA e6 0 1",
-			err:  errors.New("expecting K, Q, k, q or - got A"),
+			fen:  "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KI e6 0 1",
+			err:  errors.New("expecting K, Q, k, q, a file letter or - got I"),
 		},
 		{
 			name: "En passant square invalid (a9)",
@@ -114,7 +115,7 @@ func TestFENConversion(t *testing.T) {
 		{
 			name: "Invalid castling rights mix",
 			fen:  "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQx e6 0 1",
-			err:  errors.New("expecting K, Q, k, q or - got x"),
+			err:  errors.New("expecting K, Q, k, q, a file letter or - got x"),
 		},
 		{
 			name: "Incomplete en passant square",
@@ -154,7 +155,15 @@ func TestFENConversion(t *testing.T) {
 		{
 			name: "Invalid castling mix",
 			fen:  "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KX - 0 1",
-			err:  errors.New("expecting K, Q, k, q or - got X"),
+			err:  errors.New("expecting K, Q, k, q, a file letter or - got X"),
+		},
+		{
+			name: "X-FEN castling rights",
+			fen:  "bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w KQkq - 2 9",
+		},
+		{
+			name: "X-FEN castling rights with an inner rook",
+			fen:  "rr2k3/8/8/8/8/8/8/RR2K2R w KBb - 0 1",
 		},
 		{
 			name: "Invalid rank structure",
@@ -199,3 +208,12 @@ func TestFENConversion(t *testing.T) {
 		})
 	}
 }
+
+func TestShredderFEN(t *testing.T) {
+	b, err := board.FromFEN("bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w HFhf - 2 9")
+
+	require.NoError(t, err)
+	assert.Equal(t, ShortWhite|LongWhite|ShortBlack|LongBlack, b.Castles)
+	assert.Equal(t, [Colors][2]Square{{H1, F1}, {H8, F8}}, b.CastleRooks)
+	assert.Equal(t, "bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w KQkq - 2 9", b.FEN())
+}
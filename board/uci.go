@@ -0,0 +1,72 @@
+package board
+
+import (
+	"errors"
+
+	"github.com/paulsonkoly/chess-3/move"
+
+	. "github.com/paulsonkoly/chess-3/chess"
+)
+
+// ParseUCIMove parses the move uciM in uci long algebraic notation in the
+// position b. Castling can be given either in standard or in Chess960
+// notation. The result is pseudo-legal in b.
+func (b *Board) ParseUCIMove(uciM string) (move.Move, error) {
+	if len(uciM) != 4 && len(uciM) != 5 {
+		return 0, errors.New("invalid uci move")
+	}
+	from := Square((uciM[0] - 'a') + (uciM[1]-'1')*8)
+	to := Square((uciM[2] - 'a') + (uciM[3]-'1')*8)
+	if from < A1 || from > H8 || to < A1 || to > H8 {
+		return 0, errors.New("invalid uci move")
+	}
+	var promo Piece
+	if len(uciM) == 5 {
+		switch uciM[4] {
+		case 'q':
+			promo = Queen
+		case 'r':
+			promo = Rook
+		case 'b':
+			promo = Bishop
+		case 'n':
+			promo = Knight
+		default:
+			return 0, errors.New("invalid uci move")
+		}
+	}
+
+	m := move.From(from) | move.To(to) | move.Promo(promo)
+	if b.SquaresToPiece[from] == King {
+		m = b.parseCastle(m)
+	}
+
+	if !b.IsPseudoLegal(m) {
+		return 0, errors.New("uci move not pseudo-legal")
+	}
+
+	return m, nil
+}
+
+// parseCastle converts the king move m to a castling move if it is castling
+// either in Chess960 notation, the king capturing its own rook, or in standard
+// notation, the king moving two squares.
+func (b *Board) parseCastle(m move.Move) move.Move {
+	if b.Colors[b.STM]&BitBoardFromSquares(m.To()) != 0 {
+		return move.Castling(m.From(), m.To())
+	}
+
+	if Abs(m.From().File()-m.To().File()) == 2 {
+		side := Short
+		if m.To() < m.From() {
+			side = Long
+		}
+
+		castle := move.Castling(m.From(), b.CastleRooks[b.STM][side])
+		if king, _ := CastleTargets(castle); king == m.To() {
+			return castle
+		}
+	}
+
+	return m
+}
@@ -0,0 +1,44 @@
+package board_test
+
+import (
+	"testing"
+
+	"github.com/paulsonkoly/chess-3/board"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/paulsonkoly/chess-3/chess"
+)
+
+func TestParseUCIMove(t *testing.T) {
+	tests := []struct {
+		name    string
+		fen     string
+		uciM    string
+		want    string
+		wantErr bool
+	}{
+		{"quiet", StartPosFEN, "g1f3", "g1f3", false},
+		{"promotion", "7k/P7/8/8/8/8/8/K7 w - - 0 1", "a7a8n", "a7a8n", false},
+		{"castle", "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "e1g1", "e1g1", false},
+		{"castle 960", "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "e1h1", "e1g1", false},
+		{"not pseudo-legal", StartPosFEN, "e2e5", "", true},
+		{"bad promotion", "7k/P7/8/8/8/8/8/K7 w - - 0 1", "a7a8k", "", true},
+		{"bad square", StartPosFEN, "e2e9", "", true},
+		{"bad length", StartPosFEN, "e2", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := Must(board.FromFEN(tt.fen))
+
+			m, err := b.ParseUCIMove(tt.uciM)
+
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.want, m.String())
+			}
+		})
+	}
+}
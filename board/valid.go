@@ -20,7 +20,13 @@ var (
 // Given that some UIs send fens with EP set when EP is not possible due to
 // pins or missing pawns, we accept these but set b.EnPassant to 0.
 // Returns error nil if the position is valid.
-func (b *Board) Valid() error {
+func (b *Board) Valid() error { return b.valid(false) }
+
+// Valid960 is Valid for Chess960, allowing the king and the castling rooks on
+// any file.
+func (b *Board) Valid960() error { return b.valid(true) }
+
+func (b *Board) valid(chess960 bool) error {
 	for color := White; color <= Black; color++ {
 		if !(b.Colors[color] & b.Pieces[King]).One() {
 			return ErrWrongPieceCount
@@ -44,19 +50,23 @@ func (b *Board) Valid() error {
 			return ErrWrongPieceCount
 		}
 
-		kingSq := SquareAt(EFile, FirstRank.FromPerspectiveOf(color))
-		if b.Castles&Castle(color, Short) != 0 {
-			rookSq := SquareAt(HFile, FirstRank.FromPerspectiveOf(color))
-			if b.Pieces[Rook]&b.Colors[color]&BitBoardFromSquares(rookSq) == 0 ||
-				b.Pieces[King]&b.Colors[color]&BitBoardFromSquares(kingSq) == 0 {
-				return ErrWrongCastle
-			}
+		rank := FirstRank.FromPerspectiveOf(color)
+		king := b.Pieces[King] & b.Colors[color] & RankBB(rank)
+		if !chess960 {
+			king &= BitBoardFromSquares(SquareAt(EFile, rank))
 		}
 
-		if b.Castles&Castle(color, Long) != 0 {
-			rookSq := SquareAt(AFile, FirstRank.FromPerspectiveOf(color))
-			if b.Pieces[Rook]&b.Colors[color]&BitBoardFromSquares(rookSq) == 0 ||
-				b.Pieces[King]&b.Colors[color]&BitBoardFromSquares(kingSq) == 0 {
+		for side := Short; side <= Long; side++ {
+			if b.Castles&Castle(color, side) == 0 {
+				continue
+			}
+
+			rookSq := b.CastleRooks[color][side]
+			if !chess960 && rookSq != SquareAt([...]Coord{HFile, AFile}[side], rank) {
+				return ErrWrongCastle
+			}
+			if king == 0 || b.Pieces[Rook]&b.Colors[color]&BitBoardFromSquares(rookSq) == 0 ||
+				(side == Short) != (rookSq > king.LowestSet()) {
 				return ErrWrongCastle
 			}
 		}
@@ -114,6 +124,9 @@ func (b *Board) IsPseudoLegal(m move.Move) bool {
 	if b.Colors[b.STM]&fromBB == 0 {
 		return false
 	}
+	if m.IsCastle() {
+		return b.canCastle(m)
+	}
 	if b.Colors[b.STM]&toBB != 0 {
 		return false
 	}
@@ -148,36 +161,8 @@ func (b *Board) IsPseudoLegal(m move.Move) bool {
 		}
 
 	case King:
-		switch {
-
-		case from == E1 && to == G1 && b.STM == White:
-			if b.Castles&ShortWhite == 0 || BitBoardFromSquares(F1, G1)&occ != 0 ||
-				b.IsAttacked(b.STM.Flip(), occ, BitBoardFromSquares(E1, F1, G1)) {
-				return false
-			}
-
-		case from == E1 && to == C1 && b.STM == White:
-			if b.Castles&LongWhite == 0 || BitBoardFromSquares(D1, C1, B1)&occ != 0 ||
-				b.IsAttacked(b.STM.Flip(), occ, BitBoardFromSquares(E1, D1, C1)) {
-				return false
-			}
-
-		case from == E8 && to == G8 && b.STM == Black:
-			if b.Castles&ShortBlack == 0 || BitBoardFromSquares(F8, G8)&occ != 0 ||
-				b.IsAttacked(b.STM.Flip(), occ, BitBoardFromSquares(E8, F8, G8)) {
-				return false
-			}
-
-		case from == E8 && to == C8 && b.STM == Black:
-			if b.Castles&LongBlack == 0 || BitBoardFromSquares(D8, C8, B8)&occ != 0 ||
-				b.IsAttacked(b.STM.Flip(), occ, BitBoardFromSquares(E8, D8, C8)) {
-				return false
-			}
-
-		default:
-			if attacks.KingMoves(from)&toBB == 0 {
-				return false
-			}
+		if attacks.KingMoves(from)&toBB == 0 {
+			return false
 		}
 
 	case Pawn:
@@ -236,3 +221,39 @@ func (b *Board) IsPseudoLegal(m move.Move) bool {
 
 	return true
 }
+
+// canCastle determines if the castling move m is pseudo legal. The squares
+// between the king and the rook and their destinations have to be empty, and
+// the king cannot be in check or pass through an attacked square.
+func (b *Board) canCastle(m move.Move) bool {
+	king := m.From()
+	rook := m.CastleRook()
+	side := Short
+	if rook < king {
+		side = Long
+	}
+
+	// a hash move can have any king destination
+	if m != move.Castling(king, rook) {
+		return false
+	}
+
+	if b.SquaresToPiece[king] != King || b.Castles&Castle(b.STM, side) == 0 || b.CastleRooks[b.STM][side] != rook {
+		return false
+	}
+
+	kingTo, rookTo := CastleTargets(m)
+	occ := b.Colors[White] | b.Colors[Black]
+
+	if (span(king, kingTo)|span(rook, rookTo))&occ&^BitBoardFromSquares(king, rook) != 0 {
+		return false
+	}
+
+	return !b.IsAttacked(b.STM.Flip(), occ, span(king, kingTo))
+}
+
+// span is the set of squares from a to b inclusive on the same rank.
+func span(a, b Square) BitBoard {
+	lo, hi := min(a, b), max(a, b)
+	return BitBoard(1)<<(hi+1) - BitBoard(1)<<lo
+}
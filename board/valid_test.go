@@ -154,6 +154,26 @@ func TestValid(t *testing.T) {
 	}
 }
 
+func TestValid960(t *testing.T) {
+	tests := []struct {
+		name string
+		fen  string
+		want error
+	}{
+		{"chess960 startpos", "bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w HFhf - 2 9", nil},
+		{"standard startpos", StartPosFEN, nil},
+		{"king off the back rank", "4k3/8/8/8/8/8/6K1/5R1R w H - 0 1", board.ErrWrongCastle},
+		{"missing rook", "4k3/8/8/8/8/8/8/5RK1 w K - 0 1", board.ErrWrongCastle},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := Must(board.FromFEN(tt.fen))
+			assert.Equal(t, tt.want, b.Valid960(), "fen: %s", tt.fen)
+		})
+	}
+}
+
 func TestIsPseudoLegal(t *testing.T) {
 	tests := []struct {
 		name string
@@ -242,75 +262,111 @@ func TestIsPseudoLegal(t *testing.T) {
 		{
 			name: "white short castle pseudo legal",
 			fen:  "4k3/8/8/8/8/8/8/4K2R w K - 0 1",
-			move: move.From(E1) | move.To(G1),
+			move: move.Castling(E1, H1),
 			want: true,
 		},
 		{
 			name: "white long castle pseudo legal",
 			fen:  "4k3/8/8/8/8/8/8/R3K3 w Q - 0 1",
-			move: move.From(E1) | move.To(C1),
+			move: move.Castling(E1, A1),
 			want: true,
 		},
 		{
 			name: "black short castle pseudo legal",
 			fen:  "4k2r/8/8/8/8/8/8/4K3 b k - 0 1",
-			move: move.From(E8) | move.To(G8),
+			move: move.Castling(E8, H8),
 			want: true,
 		},
 		{
 			name: "black long castle pseudo legal",
 			fen:  "r3k3/8/8/8/8/8/8/4K3 b q - 0 1",
-			move: move.From(E8) | move.To(C8),
+			move: move.Castling(E8, A8),
 			want: true,
 		},
 		{
 			name: "white castle not pseudo legal due to check",
 			fen:  "4k3/8/8/b7/8/8/8/4K2R w K - 0 1",
-			move: move.From(E1) | move.To(G1),
+			move: move.Castling(E1, H1),
 			want: false,
 		},
 		{
 			name: "white castle not pseudo legal due to checking in between",
 			fen:  "4k3/8/8/1b6/8/8/8/4K2R w K - 0 1",
-			move: move.From(E1) | move.To(G1),
+			move: move.Castling(E1, H1),
 			want: false,
 		},
 		{
 			name: "white castle not pseudo legal due to no right",
 			fen:  "4k3/8/8/8/8/8/8/4K2R w k - 0 1",
-			move: move.From(E1) | move.To(G1),
+			move: move.Castling(E1, H1),
 			want: false,
 		},
 		{
 			name: "white castle not pseudo legal due castling through occupied square",
 			fen:  "4k3/8/8/8/8/8/8/RN2K3 w Q - 0 1",
-			move: move.From(E1) | move.To(C1),
+			move: move.Castling(E1, A1),
 			want: false,
 		},
 		{
 			name: "black castle not pseudo legal due to check",
 			fen:  "4k2r/8/8/8/B7/8/8/4K3 b k - 0 1",
-			move: move.From(E8) | move.To(G8),
+			move: move.Castling(E8, H8),
 			want: false,
 		},
 		{
 			name: "black castle not pseudo legal due to checking in between",
 			fen:  "4k2r/8/8/8/1B6/8/8/4K3 b k - 0 1",
-			move: move.From(E8) | move.To(G8),
+			move: move.Castling(E8, H8),
 			want: false,
 		},
 		{
 			name: "black castle not pseudo legal due to no right",
 			fen:  "4k2r/8/8/8/8/8/8/4K3 b - - 0 1",
-			move: move.From(E8) | move.To(G8),
+			move: move.Castling(E8, H8),
 			want: false,
 		},
 		{
 			name: "black castle not pseudo legal due castling through occupied square",
 			fen:  "rn2k3/8/8/8/8/8/8/4K3 b q - 0 1",
-			move: move.From(E8) | move.To(C8),
+			move: move.Castling(E8, A8),
 			want: false,
 		},
+		{
+			name: "castle without the castle flag not pseudo legal",
+			fen:  "4k3/8/8/8/8/8/8/4K2R w K - 0 1",
+			move: move.From(E1) | move.To(G1),
+			want: false,
+		},
+		{
+			name: "chess960 short castle pseudo legal",
+			fen:  "4k3/8/8/8/8/8/8/1R4KR w H - 0 1",
+			move: move.Castling(G1, H1),
+			want: true,
+		},
+		{
+			name: "chess960 long castle pseudo legal",
+			fen:  "4k3/8/8/8/8/8/8/1R4KR w B - 0 1",
+			move: move.Castling(G1, B1),
+			want: true,
+		},
+		{
+			name: "chess960 castle not pseudo legal due to occupied rook destination",
+			fen:  "4k3/8/8/8/8/8/8/1RN3KR w B - 0 1",
+			move: move.Castling(G1, B1),
+			want: false,
+		},
+		{
+			name: "chess960 castle with the wrong rook not pseudo legal",
+			fen:  "4k3/8/8/8/8/8/8/RR2K3 w B - 0 1",
+			move: move.Castling(E1, A1),
+			want: false,
+		},
+		{
+			name: "chess960 castle swapping king and rook pseudo legal",
+			fen:  "4k3/8/8/8/8/8/8/2RK4 w C - 0 1",
+			move: move.Castling(D1, C1),
+			want: true,
+		},
 		{
 			name: "single pawn push pseudo legal",
 			fen:  "4k3/8/8/8/8/8/1P6/4K3 w - - 0 1",
@@ -13,16 +13,25 @@ type Hash uint64
 type Hashes struct {
 	Pawn    Hash // Pawn is unique per pawn placement
 	NonPawn Hash // NonPawn is unique per non-pawn piece placement + other board states.
+	// NonPawns are unique per non-pawn piece placement of each color, without
+	// other board states.
+	NonPawns [Colors]Hash
 }
 
 // Full is combined Zobrist hash.
 func (h Hashes) Full() Hash { return h.Pawn ^ h.NonPawn }
 
-func (h *Hashes) Xor(pt Piece, val Hash) {
-	if pt == Pawn {
+// Xor updates the hashes with val of piece type pt of color c. pt is NoPiece
+// for board states other than piece placement.
+func (h *Hashes) Xor(c Color, pt Piece, val Hash) {
+	switch pt {
+	case Pawn:
 		h.Pawn ^= val
-	} else {
+	case NoPiece:
 		h.NonPawn ^= val
+	default:
+		h.NonPawn ^= val
+		h.NonPawns[c] ^= val
 	}
 }
 
@@ -73,7 +82,7 @@ func (b Board) calculateHash() Hashes {
 			for pieces := b.Pieces[pType] & b.Colors[color]; pieces != 0; pieces &= pieces - 1 {
 				sq := pieces.LowestSet()
 
-				hashes.NonPawn ^= PiecesRand[color][pType][sq]
+				hashes.Xor(color, pType, PiecesRand[color][pType][sq])
 			}
 		}
 	}
@@ -94,3 +103,16 @@ func (b Board) calculateHash() Hashes {
 
 	return hashes
 }
+
+// MaterialHash is the hash of the piece counts of b.
+func (b *Board) MaterialHash() Hash {
+	var h Hash
+	for color := range Colors {
+		for pType := Pawn; pType < King; pType++ {
+			// counts fit in 4 bits, even with all pawns promoted
+			h = h<<4 | Hash(b.Counts[color][pType])
+		}
+	}
+	// Fibonacci hashing spreads the packed counts over all bits
+	return h * 0x9e3779b97f4a7c15
+}
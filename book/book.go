@@ -0,0 +1,140 @@
+// Package book reads Polyglot opening books.
+package book
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/rand/v2"
+	"os"
+	"slices"
+
+	"github.com/paulsonkoly/chess-3/board"
+	. "github.com/paulsonkoly/chess-3/chess"
+	"github.com/paulsonkoly/chess-3/move"
+)
+
+// entrySize is the size of a Polyglot book entry in bytes.
+const entrySize = 16
+
+var ErrFormat = errors.New("invalid polyglot book")
+
+// entry is a Polyglot book entry.
+type entry struct {
+	key    board.Hash
+	move   uint16
+	weight uint16
+}
+
+// Book is a Polyglot opening book.
+type Book struct {
+	entries []entry // sorted by key
+}
+
+// Open reads the Polyglot book file at path.
+func Open(path string) (*Book, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return parse(data)
+}
+
+func parse(data []byte) (*Book, error) {
+	if len(data)%entrySize != 0 {
+		return nil, ErrFormat
+	}
+
+	entries := make([]entry, len(data)/entrySize)
+	for i := range entries {
+		raw := data[i*entrySize:]
+		entries[i] = entry{
+			key:    board.Hash(binary.BigEndian.Uint64(raw)),
+			move:   binary.BigEndian.Uint16(raw[8:]),
+			weight: binary.BigEndian.Uint16(raw[10:]),
+		}
+	}
+
+	// books are sorted by key, but we don't rely on it
+	slices.SortStableFunc(entries, func(a, b entry) int {
+		switch {
+		case a.key < b.key:
+			return -1
+		case a.key > b.key:
+			return 1
+		}
+		return 0
+	})
+
+	return &Book{entries: entries}, nil
+}
+
+// Pick picks a book move in b using r, with the probability of each move
+// proportional to its weight. ok is false if b is not in the book.
+func (bk *Book) Pick(b *board.Board, r *rand.Rand) (m move.Move, ok bool) {
+	return bk.pick(b, b.PolyglotKey(), r)
+}
+
+func (bk *Book) pick(b *board.Board, key board.Hash, r *rand.Rand) (move.Move, bool) {
+	ix, _ := slices.BinarySearchFunc(bk.entries, key, func(e entry, key board.Hash) int {
+		switch {
+		case e.key < key:
+			return -1
+		case e.key > key:
+			return 1
+		}
+		return 0
+	})
+
+	candidates := make([]entry, 0, 8)
+	sum := 0
+	for ; ix < len(bk.entries) && bk.entries[ix].key == key; ix++ {
+		e := bk.entries[ix]
+		if e.weight > 0 && legal(b, decode(b, e.move)) {
+			candidates = append(candidates, e)
+			sum += int(e.weight)
+		}
+	}
+
+	if sum == 0 {
+		return 0, false
+	}
+
+	pick := r.IntN(sum)
+	for _, e := range candidates {
+		pick -= int(e.weight)
+		if pick < 0 {
+			return decode(b, e.move), true
+		}
+	}
+
+	panic("unreachable")
+}
+
+// decode converts a Polyglot move to move.Move. Polyglot encodes castling as
+// the king capturing its own rook, the same as move.Move but without the
+// castle flag.
+func decode(b *board.Board, pm uint16) move.Move {
+	to := Square(pm & 0x3f)
+	from := Square(pm >> 6 & 0x3f)
+	promo := Piece(pm >> 12 & 0x7)
+	if promo != NoPiece {
+		promo++ // knight 1 ... queen 4
+	}
+
+	if b.SquaresToPiece[from] == King && b.Colors[b.STM]&BitBoardFromSquares(to) != 0 {
+		return move.Castling(from, to)
+	}
+
+	return move.From(from) | move.To(to) | move.Promo(promo)
+}
+
+// legal determines whether m is a legal move in b.
+func legal(b *board.Board, m move.Move) bool {
+	if !b.IsPseudoLegal(m) {
+		return false
+	}
+	r := b.MakeMove(m)
+	defer b.UndoMove(m, r)
+	return !b.InCheck(b.STM.Flip())
+}
@@ -0,0 +1,92 @@
+package book
+
+import (
+	"encoding/binary"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/paulsonkoly/chess-3/board"
+	. "github.com/paulsonkoly/chess-3/chess"
+	"github.com/paulsonkoly/chess-3/move"
+	"github.com/stretchr/testify/assert"
+)
+
+// polyglotMove encodes a move in Polyglot format.
+func polyglotMove(from, to Square, promo int) uint16 {
+	return uint16(to) | uint16(from)<<6 | uint16(promo)<<12
+}
+
+func bookData(entries ...entry) []byte {
+	data := make([]byte, 0, entrySize*len(entries))
+	for _, e := range entries {
+		data = binary.BigEndian.AppendUint64(data, uint64(e.key))
+		data = binary.BigEndian.AppendUint16(data, e.move)
+		data = binary.BigEndian.AppendUint16(data, e.weight)
+		data = binary.BigEndian.AppendUint32(data, 0)
+	}
+	return data
+}
+
+func TestParse(t *testing.T) {
+	_, err := parse(make([]byte, entrySize+1))
+	assert.ErrorIs(t, err, ErrFormat)
+
+	bk, err := parse(bookData(entry{key: 2}, entry{key: 1}, entry{key: 3}))
+	assert.NoError(t, err)
+	assert.Equal(t, []entry{{key: 1}, {key: 2}, {key: 3}}, bk.entries)
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		fen  string
+		pm   uint16
+		want move.Move
+	}{
+		{"quiet move", StartPosFEN, polyglotMove(E2, E4, 0), move.From(E2) | move.To(E4)},
+		{"short castle", "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", polyglotMove(E1, H1, 0), move.Castling(E1, H1)},
+		{"long castle", "r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", polyglotMove(E8, A8, 0), move.Castling(E8, A8)},
+		{"rook move", "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", polyglotMove(H1, E1, 0), move.From(H1) | move.To(E1)},
+		{
+			"promotion", "7k/P7/8/8/8/8/8/K7 w - - 0 1", polyglotMove(A7, A8, 1),
+			move.From(A7) | move.To(A8) | move.Promo(Knight),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := Must(board.FromFEN(tt.fen))
+
+			assert.Equal(t, tt.want, decode(b, tt.pm))
+		})
+	}
+}
+
+func TestPick(t *testing.T) {
+	const key = board.Hash(42)
+
+	bk := Must(parse(bookData(
+		entry{key: key - 1, move: polyglotMove(D2, D4, 0), weight: 100},
+		entry{key: key, move: polyglotMove(E2, E4, 0), weight: 1},
+		entry{key: key, move: polyglotMove(D2, D4, 0), weight: 3},
+		entry{key: key, move: polyglotMove(C2, C4, 0), weight: 0},
+		entry{key: key, move: polyglotMove(E2, E5, 0), weight: 100},
+		entry{key: key + 1, move: polyglotMove(C2, C4, 0), weight: 100},
+	)))
+	b := board.StartPos()
+	r := rand.New(rand.NewPCG(1, 2))
+
+	counts := map[move.Move]int{}
+	for range 4000 {
+		m, ok := bk.pick(b, key, r)
+		assert.True(t, ok)
+		counts[m]++
+	}
+
+	assert.Len(t, counts, 2)
+	assert.InDelta(t, 1000, counts[move.From(E2)|move.To(E4)], 100)
+	assert.InDelta(t, 3000, counts[move.From(D2)|move.To(D4)], 100)
+
+	_, ok := bk.pick(b, key+2, r)
+	assert.False(t, ok)
+}
@@ -7,21 +7,33 @@ import (
 
 const StartPosFEN = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
 
-type Depth int8
+type Depth int16
 
-const MaxPlies = 64
+const MaxPlies = 128
 
 type Score int16
 
 const (
 	Inf = Score(10_000)  // Inf is the checkmate score.
 	Inv = Score(-11_000) // Inv is an invalid score. It is guaranteed to be less than any valid scores.
+	// TBWin is the score of a tablebase win. It is below the checkmate scores.
+	TBWin = Inf - 2*MaxPlies
 )
 
 func (s Score) IsMate() bool {
 	return s <= -Inf+MaxPlies || s >= Inf-MaxPlies
 }
 
+// MateMoves is the number of moves until checkmate for a mate score s. It is
+// negative if the side to move is getting mated, and 0 if the side to move is
+// already mated. ok is false if s is not a mate score.
+func (s Score) MateMoves() (moves int, ok bool) {
+	if !s.IsMate() {
+		return 0, false
+	}
+	return int(Signum(s)) * int((Inf-Abs(s)+1)/2), true
+}
+
 func (s Score) String() string {
 	if s == Inv {
 		return "Inv"
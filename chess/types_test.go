@@ -37,3 +37,29 @@ func TestScoreString(t *testing.T) {
 		})
 	}
 }
+
+func TestScoreMateMoves(t *testing.T) {
+	tests := [...]struct {
+		name   string
+		score  Score
+		want   int
+		wantOK bool
+	}{
+		{"0 score", 0, 0, false},
+		{"positive score", 73, 0, false},
+		{"score for being mated", -Inf, 0, true},
+		{"score for mating opponent in 1 move", Inf - 1, 1, true},
+		{"score for being mated in 1 move", -Inf + 2, -1, true},
+		{"score for mating opponent in 3 moves", Inf - 5, 3, true},
+		{"score for being mated in 3 moves", -Inf + 6, -3, true},
+		{"score under mate boundary", Inf - MaxPlies - 1, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mate, ok := tt.score.MateMoves()
+			assert.Equal(t, tt.want, mate)
+			assert.Equal(t, tt.wantOK, ok)
+		})
+	}
+}
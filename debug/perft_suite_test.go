@@ -10,20 +10,23 @@ import (
 	. "github.com/paulsonkoly/chess-3/chess"
 )
 
-const epd = "standard.epd"
+var epds = []string{"standard.epd", "chess960.epd"}
 
 func TestPerftSuite(t *testing.T) {
-	inp := Must(debug.NewEPDReader(epd))
-	t.Cleanup(inp.Close)
 	t.Parallel()
 
-	for inp.Scan() {
-		entry := inp.Entry()
+	for _, epd := range epds {
+		inp := Must(debug.NewEPDReader(epd))
+		t.Cleanup(inp.Close)
 
-		t.Run(fmt.Sprintf("%s at depth %d", entry.Fen, entry.D),
-			func(t *testing.T) {
-				t.Parallel()
-				assert.Equal(t, entry.Cnt, debug.Perft(entry.Board, entry.D, false))
-			})
+		for inp.Scan() {
+			entry := inp.Entry()
+
+			t.Run(fmt.Sprintf("%s at depth %d", entry.Fen, entry.D),
+				func(t *testing.T) {
+					t.Parallel()
+					assert.Equal(t, entry.Cnt, debug.Perft(entry.Board, entry.D, false))
+				})
+		}
 	}
 }
@@ -0,0 +1,281 @@
+// Package engine is the chess engine API for embedding in Go programs. It
+// wraps the board, the search and the time control of a game behind a context
+// aware interface, without any of the protocol handling of the uci package.
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/paulsonkoly/chess-3/board"
+	"github.com/paulsonkoly/chess-3/move"
+	"github.com/paulsonkoly/chess-3/search"
+	"github.com/paulsonkoly/chess-3/transp"
+
+	. "github.com/paulsonkoly/chess-3/chess"
+)
+
+var (
+	// ErrIllegalMove is returned for moves that are not legal in the position.
+	ErrIllegalMove = errors.New("illegal move")
+	// ErrNoMoves is returned by Think if the side to move has no legal moves.
+	ErrNoMoves = errors.New("no legal moves")
+	// ErrNoHistory is returned by Undo if no move was played.
+	ErrNoHistory = errors.New("no move to undo")
+)
+
+// Engine plays a game of chess. It keeps the position and the search state
+// between moves. An Engine is not safe for concurrent use.
+type Engine struct {
+	board   *board.Board
+	history []played // history is the moves played since the position was set up.
+	search  *search.Search
+	info    func(search.Info)
+}
+
+// played is a move played on the board with its undo information.
+type played struct {
+	m move.Move
+	r board.Reverse
+}
+
+type options struct {
+	hash    int
+	threads int
+	info    func(search.Info)
+}
+
+// Option is an option for creating a new Engine.
+type Option func(*options)
+
+// WithHash sets the transposition table size in megabytes. The default is 1.
+func WithHash(mb int) Option { return func(o *options) { o.hash = mb } }
+
+// WithThreads sets the number of search threads. The default is 1.
+func WithThreads(n int) Option { return func(o *options) { o.threads = n } }
+
+// WithInfoHandler reports the search progress of Think to handler. The default
+// is no reporting.
+func WithInfoHandler(handler func(search.Info)) Option { return func(o *options) { o.info = handler } }
+
+// New creates a new Engine in the starting position.
+func New(opts ...Option) *Engine {
+	actual := options{hash: 1, threads: 1}
+	for _, opt := range opts {
+		opt(&actual)
+	}
+
+	s := search.New(actual.hash * transp.MegaBytes)
+	s.SetThreads(actual.threads)
+
+	return &Engine{board: board.StartPos(), search: s, info: actual.info}
+}
+
+// NewGame resets the engine to the starting position, and clears the search
+// state of the previous game.
+func (e *Engine) NewGame() {
+	e.board = board.StartPos()
+	e.history = e.history[:0]
+	e.search.Clear()
+}
+
+// SetPosition sets up the position given by fen, or the starting position if
+// fen is empty, and plays moves in uci notation from there. fen can carry
+// Chess960 castling rights. On error the position is unchanged.
+func (e *Engine) SetPosition(fen string, moves []string) error {
+	b := board.StartPos()
+
+	if fen != "" {
+		var err error
+		if b, err = board.FromFEN(fen); err != nil {
+			return err
+		}
+
+		// the castling rights of a Chess960 fen fail the standard validation
+		if err := b.Valid(); err != nil {
+			if !errors.Is(err, board.ErrWrongCastle) || b.Valid960() != nil {
+				return err
+			}
+		}
+	}
+
+	history := []played{}
+	for _, uciM := range moves {
+		p, err := play(b, uciM)
+		if err != nil {
+			return err
+		}
+		history = append(history, p)
+	}
+
+	e.board, e.history = b, history
+	return nil
+}
+
+// Play plays the move uciM in uci notation in the current position.
+func (e *Engine) Play(uciM string) error {
+	p, err := play(e.board, uciM)
+	if err != nil {
+		return err
+	}
+	e.history = append(e.history, p)
+	return nil
+}
+
+// Undo takes back the last move played by SetPosition or Play.
+func (e *Engine) Undo() error {
+	if len(e.history) == 0 {
+		return ErrNoHistory
+	}
+
+	p := e.history[len(e.history)-1]
+	e.history = e.history[:len(e.history)-1]
+	e.board.UndoMove(p.m, p.r)
+	return nil
+}
+
+// Board is a copy of the current position.
+func (e *Engine) Board() *board.Board { return e.board.Copy() }
+
+// FEN is the FEN of the current position.
+func (e *Engine) FEN() string { return e.board.FEN() }
+
+// play makes the legal move uciM on b.
+func play(b *board.Board, uciM string) (played, error) {
+	m, err := b.ParseUCIMove(uciM)
+	if err != nil {
+		return played{}, err
+	}
+
+	r := b.MakeMove(m)
+	if b.InCheck(b.STM.Flip()) {
+		b.UndoMove(m, r)
+		return played{}, fmt.Errorf("%w %s", ErrIllegalMove, uciM)
+	}
+
+	return played{m, r}, nil
+}
+
+// Result is the outcome of Think.
+type Result struct {
+	Move   move.Move // Move is the best move.
+	Ponder move.Move // Ponder is the expected reply to Move, 0 if unknown.
+	// Score is the score of the position from the side to move.
+	Score Score
+	Depth Depth         // Depth is the depth Move was completely searched to.
+	PV    []move.Move   // PV is the principal variation.
+	Nodes int           // Nodes is the number of nodes searched by all threads.
+	Time  time.Duration // Time is the duration of the search.
+}
+
+// Think searches the current position within limits, without playing the
+// result. The search stops at the limits or when ctx is done, whichever comes
+// first, and returns the best move found so far. A done ctx stops the search
+// only after depth 1 is complete, even if ctx is done before Think is called,
+// thus there is always a searched move. The only error is ErrNoMoves if there
+// is no legal move in the position.
+func (e *Engine) Think(ctx context.Context, limits Limits) (Result, error) {
+	stm := e.board.STM
+	counters := search.Counters{}
+	stop := make(chan struct{})
+	fin := make(chan struct{})
+	// searched is closed when depth 1 is complete
+	searched := make(chan struct{})
+
+	var pv []move.Move
+	// depth is the last completed iteration depth
+	var depth Depth
+	info := func(i search.Info) {
+		if i.Kind == search.PVInfo && i.MultiPV <= 1 {
+			pv = i.PV
+			if i.Bound == transp.Exact {
+				if depth < 1 && i.Depth >= 1 {
+					close(searched)
+				}
+				depth = i.Depth
+			}
+		}
+		if e.info != nil {
+			e.info(i)
+		}
+	}
+
+	opts := []search.Option{
+		search.WithCounters(&counters),
+		search.WithStop(stop),
+		search.WithOutput(nil),
+		search.WithInfoHandler(info),
+		search.WithMultiPV(max(limits.MultiPV, 1)),
+		search.WithRootMoves(limits.SearchMoves),
+	}
+
+	if limits.Depth > 0 {
+		opts = append(opts, search.WithDepth(limits.Depth))
+	}
+
+	if limits.Nodes > 0 {
+		opts = append(opts, search.WithNodes(limits.Nodes))
+	}
+
+	if limits.SoftNodes > 0 {
+		opts = append(opts, search.WithSoftNodes(limits.SoftNodes))
+	}
+
+	if limits.Mate > 0 {
+		opts = append(opts, search.WithMate(limits.Mate))
+	}
+
+	var hardC <-chan time.Time
+	if limits.Timed(stm) {
+		opts = append(opts, search.WithSoftTime(limits.SoftTime(stm).Milliseconds()))
+		opts = append(opts, search.WithFixedTime(limits.MoveTime > 0))
+
+		hardTimer := time.NewTimer(limits.HardTime(stm))
+		defer hardTimer.Stop()
+		hardC = hardTimer.C
+	}
+
+	wg := sync.WaitGroup{}
+	wg.Go(func() {
+		defer close(stop)
+
+		select {
+		case <-fin:
+		case <-hardC:
+		case <-ctx.Done():
+			select {
+			case <-fin:
+			case <-hardC:
+			case <-searched:
+			}
+		}
+	})
+
+	start := time.Now()
+	score, bm, pm := e.search.Go(e.board, opts...)
+	close(fin)
+	wg.Wait()
+
+	if bm == 0 {
+		return Result{}, ErrNoMoves
+	}
+
+	result := Result{
+		Move:   bm,
+		Ponder: pm,
+		Score:  score,
+		Depth:  depth,
+		PV:     pv,
+		Nodes:  counters.Nodes,
+		Time:   time.Since(start),
+	}
+
+	if len(pv) == 0 || pv[0] != bm {
+		result.PV = []move.Move{bm}
+	}
+
+	return result, nil
+}
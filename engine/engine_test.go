@@ -0,0 +1,163 @@
+package engine_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/paulsonkoly/chess-3/engine"
+	"github.com/paulsonkoly/chess-3/search"
+	"github.com/paulsonkoly/chess-3/transp"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/paulsonkoly/chess-3/chess"
+)
+
+func TestSetPosition(t *testing.T) {
+	tests := []struct {
+		name    string
+		fen     string
+		moves   []string
+		want    string
+		wantErr bool
+	}{
+		{"startpos", "", nil, "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", false},
+		{"startpos moves", "", []string{"e2e4", "e7e5"}, "rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR w KQkq - 0 2", false},
+		{"fen", "7k/8/8/8/8/8/6q1/K7 w - - 0 1", nil, "7k/8/8/8/8/8/6q1/K7 w - - 0 1", false},
+		{"fen moves", "7k/8/8/8/8/8/6q1/K7 w - - 0 1", []string{"a1b1"}, "7k/8/8/8/8/8/6q1/1K6 b - - 1 1", false},
+		{"invalid fen", "7k/8/8 w - - 0 1", nil, "", true},
+		{"invalid position", "8/8/8/8/8/8/6q1/K7 w - - 0 1", nil, "", true},
+		{"chess960 fen", "1r4kr/8/8/8/8/8/8/1R4KR w BHbh - 0 1", nil, "1r4kr/8/8/8/8/8/8/1R4KR w KQkq - 0 1", false},
+		{"chess960 fen moves", "1r4kr/8/8/8/8/8/8/1R4KR w BHbh - 0 1", []string{"g1b1"}, "1r4kr/8/8/8/8/8/8/2KR3R b kq - 1 1", false},
+		{"invalid castling", "r3k2r/8/8/8/8/8/8/R3K3 w KQkq - 0 1", nil, "", true},
+		{"invalid move", "", []string{"e2e5"}, "", true},
+		{"illegal move", "7k/8/8/8/8/8/6q1/K7 w - - 0 1", []string{"a1a2"}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := engine.New()
+			before := e.FEN()
+
+			err := e.SetPosition(tt.fen, tt.moves)
+
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Equal(t, before, e.FEN())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.want, e.FEN())
+			}
+		})
+	}
+}
+
+func TestUndo(t *testing.T) {
+	e := engine.New()
+
+	assert.ErrorIs(t, e.Undo(), engine.ErrNoHistory)
+
+	assert.NoError(t, e.SetPosition("", []string{"e2e4"}))
+	assert.NoError(t, e.Play("e7e5"))
+
+	assert.NoError(t, e.Undo())
+	assert.Equal(t, "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - 0 1", e.FEN())
+
+	assert.NoError(t, e.Undo())
+	assert.Equal(t, StartPosFEN, e.FEN())
+	assert.Equal(t, Black, e.Board().STM.Flip())
+
+	assert.ErrorIs(t, e.Undo(), engine.ErrNoHistory)
+}
+
+func TestThink(t *testing.T) {
+	infos := 0
+	e := engine.New(engine.WithInfoHandler(func(search.Info) { infos++ }))
+
+	assert.NoError(t, e.SetPosition("", []string{"e2e4"}))
+
+	result, err := e.Think(context.Background(), engine.Limits{Depth: 5})
+
+	assert.NoError(t, err)
+	assert.NotZero(t, result.Move)
+	assert.Equal(t, Depth(5), result.Depth)
+	assert.Equal(t, result.Move, result.PV[0])
+	assert.Positive(t, result.Nodes)
+	assert.Positive(t, infos)
+
+	assert.NoError(t, e.Play(result.Move.String()))
+}
+
+// TestThinkDepth tests that the result depth is the depth of the last
+// completed iteration, also when the search stops within an iteration.
+func TestThinkDepth(t *testing.T) {
+	var last Depth
+	e := engine.New(engine.WithInfoHandler(func(info search.Info) {
+		if info.Bound == transp.Exact {
+			last = info.Depth
+		}
+	}))
+
+	assert.NoError(t, e.SetPosition("r3k2r/2pb1ppp/2pp1q2/p7/1nP1B3/1P2P3/P2N1PPP/R2QK2R w KQkq a6 0 14", nil))
+
+	for nodes := 1_000; nodes < 50_000; nodes += 2_003 {
+		result, err := e.Think(context.Background(), engine.Limits{Nodes: nodes})
+
+		assert.NoError(t, err)
+		assert.Equal(t, last, result.Depth)
+	}
+}
+
+func TestThinkSoftNodes(t *testing.T) {
+	e := engine.New()
+
+	result, err := e.Think(context.Background(), engine.Limits{SoftNodes: 1000, Nodes: 1_000_000})
+
+	assert.NoError(t, err)
+	assert.NotZero(t, result.Move)
+	assert.Less(t, result.Nodes, 1_000_000)
+}
+
+func TestThinkMate(t *testing.T) {
+	e := engine.New()
+	assert.NoError(t, e.SetPosition("", []string{"f2f3", "e7e5", "g2g4", "d8h4"}))
+
+	_, err := e.Think(context.Background(), engine.Limits{Depth: 5})
+
+	assert.ErrorIs(t, err, engine.ErrNoMoves)
+}
+
+func TestThinkCancel(t *testing.T) {
+	e := engine.New()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// a done context still completes depth 1
+	result, err := e.Think(ctx, engine.Limits{})
+
+	assert.NoError(t, err)
+	assert.NotZero(t, result.Move)
+	assert.GreaterOrEqual(t, result.Depth, Depth(1))
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	result, err = e.Think(ctx, engine.Limits{})
+
+	assert.NoError(t, err)
+	assert.NotZero(t, result.Move)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestThinkTimed(t *testing.T) {
+	e := engine.New()
+
+	start := time.Now()
+	result, err := e.Think(context.Background(), engine.Limits{MoveTime: 50 * time.Millisecond})
+
+	assert.NoError(t, err)
+	assert.NotZero(t, result.Move)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
@@ -0,0 +1,101 @@
+package engine
+
+import (
+	"time"
+
+	"github.com/paulsonkoly/chess-3/move"
+	"github.com/paulsonkoly/chess-3/search"
+
+	. "github.com/paulsonkoly/chess-3/chess"
+)
+
+const (
+	// predictedMoves is the number of moves the remaining time is split
+	// between, unless the time control gives less.
+	predictedMoves = 30
+	// timeInf is the time limit of searches without a clock.
+	timeInf = time.Duration(1 << 60)
+	// maxMoveShare is the share of the remaining time the scaled soft time
+	// limit of a move can grow to.
+	maxMoveShare = 0.5
+)
+
+// Limits are the limits of a single search. The zero value is an unlimited
+// search, that is stopped by the cancellation of its context only.
+type Limits struct {
+	WTime     time.Duration // WTime is the remaining time of White, 0 for no clock.
+	BTime     time.Duration // BTime is the remaining time of Black, 0 for no clock.
+	WInc      time.Duration // WInc is the increment of White per move.
+	BInc      time.Duration // BInc is the increment of Black per move.
+	MovesToGo int           // MovesToGo is the number of moves to the next time control, 0 for none.
+	MoveTime  time.Duration // MoveTime is the exact time to search, 0 for no limit.
+	// Overhead is the time reserved for communication per move.
+	Overhead time.Duration
+
+	Depth     Depth // Depth is the depth limit, 0 for no limit.
+	Nodes     int   // Nodes is the node count limit, 0 for no limit.
+	SoftNodes int   // SoftNodes stops the search after the depth exceeding it, 0 for no limit.
+	Mate      int   // Mate searches for a mate in at most Mate moves, to about 2 * Mate plies.
+	MultiPV   int   // MultiPV is the number of principal variations to report.
+	// SearchMoves restricts the search to these root moves, nil for all moves.
+	SearchMoves []move.Move
+}
+
+// Timed determines whether the search of the side to move stm is limited by
+// time.
+func (l Limits) Timed(stm Color) bool {
+	return (stm == White && l.WTime > 0) || (stm == Black && l.BTime > 0) || l.MoveTime > 0
+}
+
+// SoftTime is the base soft time limit of stm, the search scales it
+// dynamically. It is capped so that scaled up by search.MaxTimeScale it is at
+// most maxMoveShare of the remaining time.
+func (l Limits) SoftTime(stm Color) time.Duration {
+	if l.MoveTime > 0 {
+		return max(l.MoveTime-l.Overhead, time.Millisecond)
+	}
+
+	movesToGo := predictedMoves
+	if 0 < l.MovesToGo && l.MovesToGo < predictedMoves {
+		movesToGo = l.MovesToGo
+	}
+
+	var timeLeft, inc time.Duration
+	switch {
+	case stm == White && l.WTime > 0:
+		timeLeft, inc = l.WTime, l.WInc
+	case stm == Black && l.BTime > 0:
+		timeLeft, inc = l.BTime, l.BInc
+	default:
+		return timeInf
+	}
+
+	timeLeft = max(timeLeft-l.Overhead, time.Millisecond)
+	limit := time.Duration(float64(timeLeft) * maxMoveShare / search.MaxTimeScale)
+
+	return min(timeLeft/time.Duration(movesToGo)+inc/2, limit)
+}
+
+// HardTime is the time after which the search of stm is aborted.
+func (l Limits) HardTime(stm Color) time.Duration {
+	if l.MoveTime > 0 {
+		return max(l.MoveTime-l.Overhead, time.Millisecond)
+	}
+
+	timeLeft := timeInf
+
+	if stm == White && l.WTime > 0 {
+		timeLeft = l.WTime
+	}
+
+	if stm == Black && l.BTime > 0 {
+		timeLeft = l.BTime
+	}
+
+	if timeLeft <= 2*l.Overhead {
+		// we are losing on time anyway, but at least allocate time
+		return max(timeLeft/2, time.Millisecond)
+	}
+
+	return Clamp(4*l.SoftTime(stm), l.Overhead, timeLeft-l.Overhead)
+}
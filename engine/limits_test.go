@@ -0,0 +1,42 @@
+package engine_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/paulsonkoly/chess-3/engine"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/paulsonkoly/chess-3/chess"
+)
+
+func TestLimits(t *testing.T) {
+	ms := time.Millisecond
+
+	tests := []struct {
+		name     string
+		limits   engine.Limits
+		stm      Color
+		timed    bool
+		wantSoft time.Duration
+		wantHard time.Duration
+	}{
+		{"movetime", engine.Limits{MoveTime: 1000 * ms, Overhead: 100 * ms}, White, true, 900 * ms, 900 * ms},
+		{"clock", engine.Limits{WTime: 3100 * ms, WInc: 200 * ms, Overhead: 100 * ms}, White, true, 200 * ms, 800 * ms},
+		{"movestogo", engine.Limits{BTime: 1000 * ms, MovesToGo: 10}, Black, true, 100 * ms, 400 * ms},
+		{"few movestogo", engine.Limits{WTime: 1300 * ms, WInc: 200 * ms, MovesToGo: 2, Overhead: 100 * ms},
+			White, true, 200 * ms, 800 * ms},
+		{"short of time", engine.Limits{WTime: 150 * ms, Overhead: 100 * ms}, White, true, 50 * ms / 30, 75 * ms},
+		{"other side's clock", engine.Limits{WTime: 1000 * ms}, Black, false, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.timed, tt.limits.Timed(tt.stm))
+			if tt.timed {
+				assert.Equal(t, tt.wantSoft, tt.limits.SoftTime(tt.stm))
+				assert.Equal(t, tt.wantHard, tt.limits.HardTime(tt.stm))
+			}
+		})
+	}
+}
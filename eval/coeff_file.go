@@ -0,0 +1,331 @@
+package eval
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"reflect"
+	"slices"
+
+	. "github.com/paulsonkoly/chess-3/chess"
+)
+
+// Coefficient files hold a CoeffSet in either a JSON or a compact binary
+// format. The JSON format is an object with a key for each CoeffSet field
+// holding a number or nested arrays of numbers. The binary format starts with
+// coeffMagic and coeffVersion as little endian uint16, followed by the field
+// count as uint16. Each field is its name length as byte, its name, the number
+// of array dimensions as byte and the dimensions as little endian uint16s. The
+// field values follow the field headers as little endian int16s, in the order
+// of the headers. Both formats need every field of CoeffSet with the exact
+// array shapes.
+
+const (
+	coeffMagic   = "C3CF"
+	coeffVersion = 1
+)
+
+var (
+	ErrCoeffFormat = errors.New("invalid coefficient file")
+	ErrCoeffShape  = errors.New("coefficient shape mismatch")
+)
+
+// LoadCoefficients reads the coefficient file at path. The format is detected
+// from the content.
+func LoadCoefficients(path string) (*CoeffSet[Score], error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadCoefficients(f)
+}
+
+// ReadCoefficients reads coefficients in either format from r.
+func ReadCoefficients(r io.Reader) (*CoeffSet[Score], error) {
+	br := bufio.NewReader(r)
+	c := &CoeffSet[Score]{}
+
+	read := readJSON
+	if magic, err := br.Peek(len(coeffMagic)); err == nil && string(magic) == coeffMagic {
+		read = readBinary
+	}
+
+	if err := read(br, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// WriteJSON writes c to w in the JSON coefficient format. float64
+// coefficients are rounded.
+func (c *CoeffSet[T]) WriteJSON(w io.Writer) error {
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+
+	buf := bytes.Buffer{}
+	buf.WriteString("{\n")
+	for i := range t.NumField() {
+		data, err := json.Marshal(toInts(v.Field(i)))
+		if err != nil {
+			return err
+		}
+		comma := ","
+		if i == t.NumField()-1 {
+			comma = ""
+		}
+		fmt.Fprintf(&buf, "  %q: %s%s\n", t.Field(i).Name, data, comma)
+	}
+	buf.WriteString("}\n")
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// WriteBinary writes c to w in the binary coefficient format. float64
+// coefficients are rounded.
+func (c *CoeffSet[T]) WriteBinary(w io.Writer) error {
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+
+	buf := bytes.Buffer{}
+	buf.WriteString(coeffMagic)
+	buf.Write(binary.LittleEndian.AppendUint16(nil, coeffVersion))
+	buf.Write(binary.LittleEndian.AppendUint16(nil, uint16(t.NumField())))
+
+	for i := range t.NumField() {
+		name := t.Field(i).Name
+		dims := shape(t.Field(i).Type)
+
+		buf.WriteByte(byte(len(name)))
+		buf.WriteString(name)
+		buf.WriteByte(byte(len(dims)))
+		for _, d := range dims {
+			buf.Write(binary.LittleEndian.AppendUint16(nil, uint16(d)))
+		}
+	}
+
+	for i := range t.NumField() {
+		for _, x := range flatten(v.Field(i), nil) {
+			buf.Write(binary.LittleEndian.AppendUint16(nil, uint16(x)))
+		}
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func readJSON(r io.Reader, c *CoeffSet[Score]) error {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+
+	raw := map[string]any{}
+	if err := dec.Decode(&raw); err != nil {
+		return fmt.Errorf("%w: %w", ErrCoeffFormat, err)
+	}
+
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+
+	for name := range raw {
+		if _, ok := t.FieldByName(name); !ok {
+			return fmt.Errorf("%w: unknown field %s", ErrCoeffFormat, name)
+		}
+	}
+
+	for i := range t.NumField() {
+		name := t.Field(i).Name
+		x, ok := raw[name]
+		if !ok {
+			return fmt.Errorf("%w: missing field %s", ErrCoeffFormat, name)
+		}
+		if err := fromJSON(v.Field(i), x, name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fromJSON sets v from the decoded JSON value x. path is the location of v
+// for error messages.
+func fromJSON(v reflect.Value, x any, path string) error {
+	if v.Kind() == reflect.Array {
+		arr, ok := x.([]any)
+		if !ok {
+			return fmt.Errorf("%w: %s expected array of %d", ErrCoeffShape, path, v.Len())
+		}
+		if len(arr) != v.Len() {
+			return fmt.Errorf("%w: %s has length %d expected %d", ErrCoeffShape, path, len(arr), v.Len())
+		}
+		for i := range arr {
+			if err := fromJSON(v.Index(i), arr[i], fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	num, ok := x.(json.Number)
+	if !ok {
+		return fmt.Errorf("%w: %s expected number", ErrCoeffShape, path)
+	}
+	n, err := num.Int64()
+	if err != nil || n < math.MinInt16 || n > math.MaxInt16 {
+		return fmt.Errorf("%w: %s value %s is not a 16 bit integer", ErrCoeffFormat, path, num)
+	}
+	v.SetInt(n)
+
+	return nil
+}
+
+func readBinary(r io.Reader, c *CoeffSet[Score]) error {
+	var header struct {
+		Magic   [len(coeffMagic)]byte
+		Version uint16
+		Fields  uint16
+	}
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return fmt.Errorf("%w: %w", ErrCoeffFormat, err)
+	}
+	if header.Version != coeffVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrCoeffFormat, header.Version)
+	}
+
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+
+	seen := make(map[string]bool)
+	order := make([]reflect.Value, 0, header.Fields)
+
+	for range header.Fields {
+		name, err := readString(r)
+		if err != nil {
+			return err
+		}
+		dims, err := readDims(r)
+		if err != nil {
+			return err
+		}
+
+		f, ok := t.FieldByName(name)
+		if !ok {
+			return fmt.Errorf("%w: unknown field %s", ErrCoeffFormat, name)
+		}
+		if seen[name] {
+			return fmt.Errorf("%w: duplicate field %s", ErrCoeffFormat, name)
+		}
+		seen[name] = true
+
+		if want := shape(f.Type); !slices.Equal(dims, want) {
+			return fmt.Errorf("%w: %s has shape %v expected %v", ErrCoeffShape, name, dims, want)
+		}
+		order = append(order, v.FieldByIndex(f.Index))
+	}
+
+	for i := range t.NumField() {
+		if !seen[t.Field(i).Name] {
+			return fmt.Errorf("%w: missing field %s", ErrCoeffFormat, t.Field(i).Name)
+		}
+	}
+
+	for _, f := range order {
+		if err := readValues(r, f); err != nil {
+			return fmt.Errorf("%w: %w", ErrCoeffFormat, err)
+		}
+	}
+
+	return nil
+}
+
+func readString(r io.Reader) (string, error) {
+	var n [1]byte
+	if _, err := io.ReadFull(r, n[:]); err != nil {
+		return "", fmt.Errorf("%w: %w", ErrCoeffFormat, err)
+	}
+	s := make([]byte, n[0])
+	if _, err := io.ReadFull(r, s); err != nil {
+		return "", fmt.Errorf("%w: %w", ErrCoeffFormat, err)
+	}
+	return string(s), nil
+}
+
+func readDims(r io.Reader) ([]int, error) {
+	var n [1]byte
+	if _, err := io.ReadFull(r, n[:]); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCoeffFormat, err)
+	}
+	raw := make([]uint16, n[0])
+	if err := binary.Read(r, binary.LittleEndian, raw); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCoeffFormat, err)
+	}
+	dims := make([]int, len(raw))
+	for i, d := range raw {
+		dims[i] = int(d)
+	}
+	return dims, nil
+}
+
+func readValues(r io.Reader, v reflect.Value) error {
+	if v.Kind() == reflect.Array {
+		for i := range v.Len() {
+			if err := readValues(r, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var x int16
+	if err := binary.Read(r, binary.LittleEndian, &x); err != nil {
+		return err
+	}
+	v.SetInt(int64(x))
+	return nil
+}
+
+// shape is the array dimensions of t, empty for scalars.
+func shape(t reflect.Type) []int {
+	dims := []int{}
+	for ; t.Kind() == reflect.Array; t = t.Elem() {
+		dims = append(dims, t.Len())
+	}
+	return dims
+}
+
+// toInts converts v to nested []any of ints, rounding floats.
+func toInts(v reflect.Value) any {
+	if v.Kind() == reflect.Array {
+		arr := make([]any, v.Len())
+		for i := range arr {
+			arr[i] = toInts(v.Index(i))
+		}
+		return arr
+	}
+	return scalar(v)
+}
+
+// flatten appends the values of v to dst in row major order, rounding floats.
+func flatten(v reflect.Value, dst []int16) []int16 {
+	if v.Kind() == reflect.Array {
+		for i := range v.Len() {
+			dst = flatten(v.Index(i), dst)
+		}
+		return dst
+	}
+	return append(dst, scalar(v))
+}
+
+func scalar(v reflect.Value) int16 {
+	if v.Kind() == reflect.Float64 {
+		return int16(math.Round(v.Float()))
+	}
+	return int16(v.Int())
+}
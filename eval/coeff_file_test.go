@@ -0,0 +1,106 @@
+package eval
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/paulsonkoly/chess-3/chess"
+)
+
+func TestCoefficientsRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(*CoeffSet[Score], *bytes.Buffer) error
+	}{
+		{"json", func(c *CoeffSet[Score], b *bytes.Buffer) error { return c.WriteJSON(b) }},
+		{"binary", func(c *CoeffSet[Score], b *bytes.Buffer) error { return c.WriteBinary(b) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := bytes.Buffer{}
+			assert.NoError(t, tt.write(&Coefficients, &buf))
+
+			c, err := ReadCoefficients(&buf)
+
+			assert.NoError(t, err)
+			assert.Equal(t, Coefficients, *c)
+		})
+	}
+}
+
+func TestCoefficientsRounding(t *testing.T) {
+	f := CoeffSet[float64]{KRvKN: 1.6, KRvKB: -2.5}
+
+	buf := bytes.Buffer{}
+	assert.NoError(t, f.WriteBinary(&buf))
+
+	c, err := ReadCoefficients(&buf)
+
+	assert.NoError(t, err)
+	assert.Equal(t, Score(2), c.KRvKN)
+	assert.Equal(t, Score(-3), c.KRvKB)
+}
+
+// editJSON returns the JSON coefficients with the field name replaced by value,
+// or removed if value is empty.
+func editJSON(t *testing.T, name, value string) string {
+	t.Helper()
+
+	buf := bytes.Buffer{}
+	assert.NoError(t, Coefficients.WriteJSON(&buf))
+
+	fields := map[string]json.RawMessage{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &fields))
+
+	if value == "" {
+		delete(fields, name)
+	} else {
+		fields[name] = json.RawMessage(value)
+	}
+
+	data, err := json.Marshal(fields)
+	assert.NoError(t, err)
+	return string(data)
+}
+
+func TestReadCoefficientsErrors(t *testing.T) {
+	buf := bytes.Buffer{}
+	assert.NoError(t, Coefficients.WriteBinary(&buf))
+	bin := buf.Bytes()
+
+	// the first field header is PSqT with the dimensions 12 and 64
+	badShape := bytes.Clone(bin)
+	badShape[len(coeffMagic)+4+1+len("PSqT")+1] = 11
+
+	tests := []struct {
+		name string
+		data string
+		want error
+	}{
+		{"not json", "coefficients", ErrCoeffFormat},
+		{"unknown field", editJSON(t, "Unknown", "1"), ErrCoeffFormat},
+		{"missing field", editJSON(t, "KRvKB", ""), ErrCoeffFormat},
+		{"short array", editJSON(t, "TempoBonus", "[1]"), ErrCoeffShape},
+		{"short inner array", editJSON(t, "KingStorm", "[[1,2,3,4,5,6,7],[1,2,3,4,5,6,7],[1]]"), ErrCoeffShape},
+		{"scalar for array", editJSON(t, "TempoBonus", "1"), ErrCoeffShape},
+		{"array for scalar", editJSON(t, "KRvKB", "[1]"), ErrCoeffShape},
+		{"out of range", editJSON(t, "KRvKB", "40000"), ErrCoeffFormat},
+		{"fraction", editJSON(t, "KRvKB", "0.5"), ErrCoeffFormat},
+		{"binary shape", string(badShape), ErrCoeffShape},
+		{"binary truncated", string(bin[:len(bin)-1]), ErrCoeffFormat},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ReadCoefficients(strings.NewReader(tt.data))
+
+			assert.ErrorIs(t, err, tt.want)
+			assert.Nil(t, c)
+		})
+	}
+}
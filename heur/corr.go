@@ -0,0 +1,69 @@
+package heur
+
+import (
+	"github.com/paulsonkoly/chess-3/board"
+
+	. "github.com/paulsonkoly/chess-3/chess"
+)
+
+const (
+	// corrSize is the number of entries per correction table.
+	corrSize = 1 << 14
+	// corrGrain is the resolution of the stored corrections per centipawn.
+	corrGrain = 64
+	// corrMax is the maximal absolute value of a stored correction.
+	corrMax = 128 * corrGrain
+)
+
+// Correction history.
+//
+// Stores the difference between search results and the static evaluation,
+// indexed by the side to move and partial position keys: the pawn structure,
+// the non-pawn piece placement of each color and the material.
+type Correction struct {
+	pawn     [Colors][corrSize]int16
+	nonPawn  [Colors][Colors][corrSize]int16
+	material [Colors][corrSize]int16
+}
+
+// NewCorrection creates a new correction history.
+func NewCorrection() *Correction {
+	return &Correction{}
+}
+
+// Clear resets all entries to 0.
+func (c *Correction) Clear() {
+	*c = Correction{}
+}
+
+// Apply is the static evaluation eval of b corrected by the history.
+func (c *Correction) Apply(b *board.Board, eval Score) Score {
+	sum := 0
+	for _, e := range c.entries(b) {
+		sum += int(*e)
+	}
+
+	corrected := int(eval) + sum/(2*corrGrain)
+	return Score(Clamp(corrected, int(-Inf+MaxPlies+1), int(Inf-MaxPlies-1)))
+}
+
+// Update updates the history of b with diff, the difference between the
+// search result of depth d and the corrected static evaluation.
+func (c *Correction) Update(b *board.Board, d Depth, diff Score) {
+	bonus := Clamp(int(diff)*int(d)*corrGrain/8, -corrMax/4, corrMax/4)
+
+	for _, e := range c.entries(b) {
+		*e += int16(bonus - int(*e)*Abs(bonus)/corrMax)
+	}
+}
+
+func (c *Correction) entries(b *board.Board) [4]*int16 {
+	stm, hashes := b.STM, b.Hashes()
+
+	return [...]*int16{
+		&c.pawn[stm][hashes.Pawn%corrSize],
+		&c.nonPawn[stm][White][hashes.NonPawns[White]%corrSize],
+		&c.nonPawn[stm][Black][hashes.NonPawns[Black]%corrSize],
+		&c.material[stm][b.MaterialHash()%corrSize],
+	}
+}
@@ -0,0 +1,33 @@
+package heur_test
+
+import (
+	"testing"
+
+	"github.com/paulsonkoly/chess-3/board"
+	"github.com/paulsonkoly/chess-3/heur"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/paulsonkoly/chess-3/chess"
+)
+
+func TestCorrection(t *testing.T) {
+	c := heur.NewCorrection()
+	b := Must(board.FromFEN("4k3/pp6/8/8/8/8/PPP5/4K1N1 w - - 0 1"))
+	other := Must(board.FromFEN("4k3/pp6/8/8/8/8/PPP5/4K1N1 b - - 0 1"))
+
+	assert.Equal(t, Score(30), c.Apply(b, 30))
+
+	for range 100 {
+		c.Update(b, 8, 100-(c.Apply(b, 0)))
+	}
+
+	// converges close to the search results
+	assert.InDelta(t, 100, int(c.Apply(b, 0)), 10)
+	// the other side to move is unaffected
+	assert.Equal(t, Score(30), c.Apply(other, 30))
+	// corrections are bounded, and stay out of the mate range
+	assert.Less(t, c.Apply(b, Inf-MaxPlies), Inf-MaxPlies)
+
+	c.Clear()
+	assert.Equal(t, Score(30), c.Apply(b, 30))
+}
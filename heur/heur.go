@@ -1,4 +1,5 @@
-// Package heur provides move ordering heuristics.
+// Package heur provides move ordering heuristics and the static evaluation
+// correction history.
 //
 // # Move ordering stages
 //
@@ -67,7 +68,7 @@ type StackMove struct {
 func (mr *MoveRanker) RankNoisy(m move.Move, b *board.Board) Score {
 	promo := m.Promo()
 	attacker := b.SquaresToPiece[m.From()]
-	victim := b.SquaresToPiece[b.CaptureSq(m)]
+	victim := b.Captured(m)
 
 	if promo != NoPiece {
 		promo -= Pawn // Knight, Bishop, Rook, Queen => 0: NoPiece, 1: Knight, ... etc.
@@ -125,7 +126,7 @@ func (mr *MoveRanker) RankQuiet(m move.Move, b *board.Board, stack *stack.Stack[
 func (mr *MoveRanker) RankNoisyEvasion(m move.Move, b *board.Board) Score {
 	promo := m.Promo()
 	attacker := b.SquaresToPiece[m.From()]
-	victim := b.SquaresToPiece[b.CaptureSq(m)]
+	victim := b.Captured(m)
 
 	if promo != NoPiece {
 		promo -= Pawn // Knight, Bishop, Rook, Queen => 0: NoPiece, 1: Knight, ... etc.
@@ -158,7 +159,7 @@ func (mr *MoveRanker) FailHigh(d Depth, b *board.Board, moves []move.Weighted, s
 	red := Score(1) << params.HistAdjReduction
 
 	for i, m := range moves {
-		captured := b.SquaresToPiece[b.CaptureSq(m.Move)]
+		captured := b.Captured(m.Move)
 		capture := captured != NoPiece
 		quiet := m.Promo() == NoPiece && captured == NoPiece
 		last := i == len(moves)-1
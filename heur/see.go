@@ -12,6 +12,10 @@ import (
 //
 // Some of this code is derived from the algorithm found in stockfish.
 func SEE(b *board.Board, m move.Move, threshold Score) bool {
+	if m.IsCastle() {
+		return threshold <= 0
+	}
+
 	from := m.From()
 	to := m.To()
 	captureSq := b.CaptureSq(m)
@@ -331,7 +331,7 @@ func TestSEE(t *testing.T) {
 			want: 100, // N - (N + Q - P) + Q
 		},
 		{fen: "r1bqk1nr/pppp1ppp/2n5/1B2p3/1b2P3/5N2/PPPP1PPP/RNBQK2R w KQkq - 0 1",
-			m:    move.From(E1) | move.To(G1),
+			m:    move.Castling(E1, H1),
 			want: 0, //
 		},
 	}
@@ -4,29 +4,44 @@ import (
 	"bufio"
 	"flag"
 	"fmt"
+	"io"
 	"math"
 	"os"
 	"runtime"
 	"runtime/pprof"
 	"strconv"
+	"strings"
 
 	"slices"
 
 	"github.com/paulsonkoly/chess-3/board"
+	"github.com/paulsonkoly/chess-3/eval"
 	"github.com/paulsonkoly/chess-3/search"
 	"github.com/paulsonkoly/chess-3/transp"
 	"github.com/paulsonkoly/chess-3/uci"
+	"github.com/paulsonkoly/chess-3/xboard"
 
 	. "github.com/paulsonkoly/chess-3/chess"
 )
 
 var cpuProf = flag.String("cpuProf", "", "cpu profile file name")
 var memProf = flag.String("memProf", "", "mem profile file name")
+var coeffFile = flag.String("coeffFile", "", "evaluation coefficients file name")
+var xboardOverhead = flag.Duration("xboardOverhead", xboard.DefaultMoveOverhead, "time reserved for communication per move in xboard mode")
 
 func main() {
 
 	flag.Parse()
 
+	if *coeffFile != "" {
+		c, err := eval.LoadCoefficients(*coeffFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		eval.Coefficients = *c
+	}
+
 	if *cpuProf != "" {
 		cpu, err := os.Create(*cpuProf)
 		if err != nil {
@@ -43,7 +58,7 @@ func main() {
 	if slices.Contains(os.Args, "bench") {
 		runOBBench()
 	} else {
-		uci.NewDriver().Run()
+		runProtocol()
 	}
 
 	if *memProf != "" {
@@ -59,6 +74,21 @@ func main() {
 	}
 }
 
+// runProtocol runs the xboard driver if the first command on stdin is
+// "xboard", and the uci driver otherwise. The first command is passed on to
+// the driver.
+func runProtocol() {
+	in := bufio.NewReader(os.Stdin)
+	first, _ := in.ReadString('\n')
+	input := io.MultiReader(strings.NewReader(first), in)
+
+	if strings.TrimSpace(first) == "xboard" {
+		xboard.NewDriver(xboard.WithInput(input), xboard.WithMoveOverhead(*xboardOverhead)).Run()
+	} else {
+		uci.NewDriver(uci.WithInput(input)).Run()
+	}
+}
+
 var OBBenchSet = [...]string{
 	"r3k2r/2pb1ppp/2pp1q2/p7/1nP1B3/1P2P3/P2N1PPP/R2QK2R w KQkq a6 0 14",
 	"4rrk1/2p1b1p1/p1p3q1/4p3/2P2n1p/1P1NR2P/PB3PP1/3R1QK1 b - - 2 24",
@@ -10,7 +10,9 @@ type Weighted struct {
 }
 
 // Move represents a chess move, it contains the to and from squares and the
-// promotion piece type.
+// promotion piece type. Castling is encoded as the king move to its
+// destination square with the castle flag set, and the file of the castling
+// rook in place of the promotion piece.
 type Move uint16
 
 const (
@@ -20,6 +22,7 @@ const (
 	fromShift  = 6
 	promoMsk   = Move((1<<3 - 1) << 12)
 	promoShift = 12
+	castleFlag = Move(1 << 15)
 )
 
 // From constructs a move that has the from square set.
@@ -31,6 +34,16 @@ func To(to Square) Move { return (Move(to) << toShift) & toMsk }
 // Promo constructs a move that has the promotion piece type set.
 func Promo(p Piece) Move { return (Move(p) << promoShift) & promoMsk }
 
+// Castling constructs a castling move of the king on king with the rook on
+// rook.
+func Castling(king, rook Square) Move {
+	to := SquareAt(GFile, king.Rank())
+	if rook < king {
+		to = SquareAt(CFile, king.Rank())
+	}
+	return From(king) | To(to) | Move(rook.File())<<promoShift | castleFlag
+}
+
 // To is the target square of the move.
 func (s Move) To() Square { return Square((s & toMsk) >> toShift) }
 
@@ -38,17 +51,38 @@ func (s Move) To() Square { return Square((s & toMsk) >> toShift) }
 func (s Move) From() Square { return Square((s & fromMsk) >> fromShift) }
 
 // Promo is the promotion piece of the move.
-func (s Move) Promo() Piece { return Piece((s & promoMsk) >> promoShift) }
+func (s Move) Promo() Piece {
+	if s.IsCastle() {
+		return NoPiece
+	}
+	return Piece((s & promoMsk) >> promoShift)
+}
+
+// CastleRook is the square of the castling rook of the castling move s.
+func (s Move) CastleRook() Square {
+	return SquareAt(Coord((s&promoMsk)>>promoShift), s.From().Rank())
+}
+
+// IsCastle determines whether s is a castling move.
+func (s Move) IsCastle() bool { return s&castleFlag != 0 }
 
 // Matches determines if a Move m matches s.
 func (s Move) Matches(m *Weighted) bool {
 	return s == m.Move
 }
 
-// String representation of s, following uci move notation.
-func (s Move) String() string {
+// String representation of s, following uci move notation of standard chess.
+func (s Move) String() string { return s.UCI(false) }
+
+// UCI is the uci move notation of s. With chess960 castling is the king
+// capturing its own rook, otherwise the two square king move of standard
+// chess.
+func (s Move) UCI(chess960 bool) string {
 	if s == 0 {
 		return "0000"
 	}
+	if s.IsCastle() && chess960 {
+		return s.From().String() + s.CastleRook().String()
+	}
 	return s.From().String() + s.To().String() + s.Promo().String()
 }
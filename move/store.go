@@ -1,7 +1,9 @@
 package move
 
+import . "github.com/paulsonkoly/chess-3/chess"
+
 // StoreSize is the maximal amount of moves the store can hold (across all frames).
-const StoreSize = 2048
+const StoreSize = 32 * MaxPlies
 
 // Store is a stack based storage for chess moves. It is assumed that you want
 // to allocate "frames" in the store in a stack like manner, pushing new
@@ -176,48 +176,16 @@ func enPassant(ms *move.Store, b *board.Board) {
 	}
 }
 
-func shortCastle(ms *move.Store, b *board.Board) {
-	var castleMask BitBoard
-	switch b.STM {
-	case White:
-		castleMask = BitBoardFromSquares(E1, F1, G1)
-	case Black:
-		castleMask = BitBoardFromSquares(E8, F8, G8)
-	}
-
-	occ := b.Colors[White] | b.Colors[Black]
-	king := b.Colors[b.STM] & b.Pieces[King]
-	if b.Castles&Castle(b.STM, Short) != 0 && occ&castleMask == king {
-		// this isn't quite the right condition, we would need to properly
-		// calculate if the rook gives check this condition is simple, and would
-		// suffice most of the time
-		if castleMask != 0 {
-			if !b.IsAttacked(b.STM.Flip(), occ, castleMask) {
-				from := king.LowestSet()
-				ms.Alloc(move.From(from) | move.To(from+2))
-			}
-		}
-	}
-}
-
-func longCastle(ms *move.Store, b *board.Board) {
-	var castleMask BitBoard
-	switch b.STM {
-	case White:
-		castleMask = BitBoardFromSquares(E1, D1, C1)
-	case Black:
-		castleMask = BitBoardFromSquares(E8, D8, C8)
+// castle generates the castling move to side s, if the castling right is
+// present and the castling is pseudo legal.
+func castle(ms *move.Store, b *board.Board, s Side) {
+	if b.Castles&Castle(b.STM, s) == 0 {
+		return
 	}
 
-	occ := b.Colors[White] | b.Colors[Black]
-	king := b.Colors[b.STM] & b.Pieces[King]
-	if b.Castles&Castle(b.STM, Long) != 0 && occ&(castleMask>>1) == 0 {
-		if castleMask != 0 {
-			if !b.IsAttacked(b.STM.Flip(), occ, castleMask) {
-				from := king.LowestSet()
-				ms.Alloc(move.From(from) | move.To(from-2))
-			}
-		}
+	king := (b.Colors[b.STM] & b.Pieces[King]).LowestSet()
+	if m := move.Castling(king, b.CastleRooks[b.STM][s]); b.IsPseudoLegal(m) {
+		ms.Alloc(m)
 	}
 }
 
@@ -252,8 +220,8 @@ func Quiet(ms *move.Store, b *board.Board) {
 	singlePushMoves(ms, b, ^occ)
 	doublePushMoves(ms, b, ^occ)
 
-	shortCastle(ms, b)
-	longCastle(ms, b)
+	castle(ms, b, Short)
+	castle(ms, b, Long)
 }
 
 // NoisyEvasions generates all pseudo legal noisy moves when in check by pieces
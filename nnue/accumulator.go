@@ -0,0 +1,107 @@
+package nnue
+
+import (
+	"github.com/paulsonkoly/chess-3/board"
+	. "github.com/paulsonkoly/chess-3/chess"
+	"github.com/paulsonkoly/chess-3/move"
+)
+
+// Accumulators is a stack of hidden layer values, following the moves made on
+// the board. Each search thread needs its own Accumulators.
+type Accumulators struct {
+	net   *Network
+	stack []int16 // stack is the flat stack of accumulators, each has the white then the black perspective.
+	top   int     // top is the index of the current accumulator.
+}
+
+// NewAccumulators creates Accumulators for net.
+func NewAccumulators(net *Network) *Accumulators {
+	return &Accumulators{net: net, stack: make([]int16, 2*net.hidden*(MaxPlies+1))}
+}
+
+// current is the accumulator of the perspective pov on top of the stack.
+func (a *Accumulators) current(pov Color) []int16 {
+	start := (2*a.top + int(pov)) * a.net.hidden
+	return a.stack[start : start+a.net.hidden]
+}
+
+// Refresh empties the stack and calculates the accumulator of b from scratch.
+func (a *Accumulators) Refresh(b *board.Board) {
+	a.top = 0
+
+	copy(a.current(White), a.net.ftBiases)
+	copy(a.current(Black), a.net.ftBiases)
+
+	for c := White; c <= Black; c++ {
+		for occ := b.Colors[c]; occ != 0; occ &= occ - 1 {
+			sq := occ.LowestSet()
+			a.add(c, b.SquaresToPiece[sq], sq)
+		}
+	}
+}
+
+// Push pushes the accumulator after the move m on b. It has to be called
+// before m is made on b.
+func (a *Accumulators) Push(b *board.Board, m move.Move) {
+	size := 2 * a.net.hidden
+	if (a.top+2)*size > len(a.stack) {
+		a.stack = append(a.stack, make([]int16, size)...)
+	}
+
+	prev := a.stack[a.top*size : (a.top+1)*size]
+	a.top++
+	copy(a.stack[a.top*size:(a.top+1)*size], prev)
+
+	stm := b.STM
+
+	if m.IsCastle() {
+		kingTo, rookTo := board.CastleTargets(m)
+
+		a.sub(stm, King, m.From())
+		a.sub(stm, Rook, m.CastleRook())
+		a.add(stm, King, kingTo)
+		a.add(stm, Rook, rookTo)
+		return
+	}
+
+	piece := b.SquaresToPiece[m.From()]
+	put := piece
+	if m.Promo() != NoPiece {
+		put = m.Promo()
+	}
+
+	if captured := b.Captured(m); captured != NoPiece {
+		a.sub(stm.Flip(), captured, b.CaptureSq(m))
+	}
+	a.sub(stm, piece, m.From())
+	a.add(stm, put, m.To())
+}
+
+// Pop pops the accumulator of the last pushed move.
+func (a *Accumulators) Pop() { a.top-- }
+
+// Evaluate is the evaluation of the position on top of the stack from stm's
+// point of view.
+func (a *Accumulators) Evaluate(stm Color) Score {
+	return a.net.output(a.current(stm), a.current(stm.Flip()))
+}
+
+// add adds the feature of piece p of color c on sq.
+func (a *Accumulators) add(c Color, p Piece, sq Square) {
+	for pov := White; pov <= Black; pov++ {
+		acc := a.current(pov)
+		for i, w := range a.net.weights(feature(pov, c, p, sq)) {
+			acc[i] += w
+		}
+	}
+}
+
+// sub removes the feature of piece p of color c on sq.
+func (a *Accumulators) sub(c Color, p Piece, sq Square) {
+	for pov := White; pov <= Black; pov++ {
+		acc := a.current(pov)
+		for i, w := range a.net.weights(feature(pov, c, p, sq)) {
+			acc[i] -= w
+		}
+	}
+}
@@ -0,0 +1,12 @@
+//go:build embednet
+
+package nnue
+
+import _ "embed"
+
+// embedded is the default network built into the executable. The network file
+// is not part of the repository, it has to be copied to default.nnue, or
+// downloaded with make EMBEDNET=1 NETURL=<url>.
+//
+//go:embed default.nnue
+var embedded []byte
@@ -0,0 +1,143 @@
+// Package nnue is an efficiently updatable neural network evaluation.
+//
+// The network is a (768->N)x2->1 perspective network. The 768 inputs are the
+// piece-square features, from the perspective of each side, feeding a hidden
+// layer of N neurons per perspective. The two hidden layers, the side to move
+// first, are activated with SCReLU and connected to a single output.
+//
+// The network file is the little endian int16 quantised form of the feature
+// weights [768][N], the feature biases [N], the output weights [2][N] and the
+// output bias, optionally padded to a multiple of 64 bytes.
+package nnue
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"sync"
+
+	"github.com/paulsonkoly/chess-3/board"
+	. "github.com/paulsonkoly/chess-3/chess"
+)
+
+const (
+	// Inputs is the number of input features.
+	Inputs = 768
+	// QA is the quantisation of the feature transformer.
+	QA = 255
+	// QB is the quantisation of the output layer.
+	QB = 64
+	// Scale converts the network output to centipawns.
+	Scale = 400
+)
+
+// padding is the alignment the network file might be padded to.
+const padding = 64
+
+var ErrFormat = errors.New("invalid network file")
+
+// Network is the quantised network. It is read only, and it can be shared by
+// several Accumulators.
+type Network struct {
+	hidden     int
+	ftWeights  []int16 // ftWeights are the feature weights indexed by feature*hidden + neuron.
+	ftBiases   []int16
+	outWeights []int16 // outWeights are the output weights of the side to move then the other side.
+	outBias    int16
+}
+
+// Load reads the network file at path.
+func Load(path string) (*Network, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(data)
+}
+
+// Parse parses the network from data. The hidden layer size is derived from
+// the data size.
+func Parse(data []byte) (*Network, error) {
+	// 768N feature weights, N feature biases, 2N output weights and 1 output bias
+	words := len(data) / 2
+	hidden := (words - 1) / (Inputs + 3)
+	size := 2 * (hidden*(Inputs+3) + 1)
+
+	if hidden <= 0 || len(data) < size || len(data)-size >= padding {
+		return nil, ErrFormat
+	}
+
+	values := make([]int16, size/2)
+	for i := range values {
+		values[i] = int16(binary.LittleEndian.Uint16(data[2*i:]))
+	}
+
+	n := &Network{hidden: hidden}
+
+	n.ftWeights, values = values[:Inputs*hidden], values[Inputs*hidden:]
+	n.ftBiases, values = values[:hidden], values[hidden:]
+	n.outWeights, values = values[:2*hidden], values[2*hidden:]
+	n.outBias = values[0]
+
+	return n, nil
+}
+
+// embeddedNetwork parses the embedded network once.
+var embeddedNetwork = sync.OnceValue(func() *Network {
+	if len(embedded) == 0 {
+		return nil
+	}
+	return Must(Parse(embedded))
+})
+
+// Default is the network embedded in the executable, nil if the engine was
+// built without one.
+func Default() *Network { return embeddedNetwork() }
+
+// Hidden is the size of the hidden layer per perspective.
+func (n *Network) Hidden() int { return n.hidden }
+
+// Evaluate is the evaluation of b from the side to move's point of view,
+// calculated from scratch.
+func (n *Network) Evaluate(b *board.Board) Score {
+	a := NewAccumulators(n)
+	a.Refresh(b)
+	return a.Evaluate(b.STM)
+}
+
+// feature is the input index of the piece p of color c on sq from the
+// perspective of pov.
+func feature(pov, c Color, p Piece, sq Square) int {
+	if pov == Black {
+		c = c.Flip()
+		sq ^= 56
+	}
+	return int(c)*6*64 + int(p-Pawn)*64 + int(sq)
+}
+
+// weights are the feature weights of the feature f.
+func (n *Network) weights(f int) []int16 { return n.ftWeights[f*n.hidden : (f+1)*n.hidden] }
+
+// output calculates the output from the hidden layers us and them.
+func (n *Network) output(us, them []int16) Score {
+	var sum int64
+
+	for i, v := range us {
+		sum += screlu(v) * int64(n.outWeights[i])
+	}
+	for i, v := range them {
+		sum += screlu(v) * int64(n.outWeights[n.hidden+i])
+	}
+
+	sum = (sum/QA + int64(n.outBias)) * Scale / (QA * QB)
+
+	// stay clear of the mate scores
+	limit := int64(Inf - MaxPlies - 1)
+	return Score(Clamp(sum, -limit, limit))
+}
+
+func screlu(v int16) int64 {
+	x := int64(Clamp(v, 0, QA))
+	return x * x
+}
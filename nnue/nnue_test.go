@@ -0,0 +1,129 @@
+package nnue
+
+import (
+	"encoding/binary"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/paulsonkoly/chess-3/board"
+	. "github.com/paulsonkoly/chess-3/chess"
+	"github.com/paulsonkoly/chess-3/move"
+	"github.com/stretchr/testify/assert"
+)
+
+// randomNetwork is a network file with random weights and hidden layer size
+// hidden, followed by pad bytes of padding.
+func randomNetwork(hidden, pad int) []byte {
+	r := rand.New(rand.NewPCG(1, 2))
+
+	data := make([]byte, 2*(hidden*(Inputs+3)+1)+pad)
+	for i := 0; i+1 < len(data)-pad; i += 2 {
+		binary.LittleEndian.PutUint16(data[i:], uint16(r.IntN(128)-64))
+	}
+	return data
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []byte
+		hidden int
+		err    error
+	}{
+		{"exact size", randomNetwork(16, 0), 16, nil},
+		{"padded", randomNetwork(16, 38), 16, nil},
+		{"too much padding", randomNetwork(16, 64), 0, ErrFormat},
+		{"truncated", randomNetwork(16, 0)[:1000], 0, ErrFormat},
+		{"empty", nil, 0, ErrFormat},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			net, err := Parse(tt.data)
+
+			assert.Equal(t, tt.err, err)
+			if err == nil {
+				assert.Equal(t, tt.hidden, net.Hidden())
+			}
+		})
+	}
+}
+
+func TestAccumulators(t *testing.T) {
+	net := Must(Parse(randomNetwork(8, 0)))
+
+	tests := []struct {
+		name  string
+		fen   string
+		moves []move.Move
+	}{
+		{
+			"quiet moves and captures",
+			StartPosFEN,
+			[]move.Move{
+				move.From(E2) | move.To(E4), move.From(D7) | move.To(D5),
+				move.From(E4) | move.To(D5), move.From(D8) | move.To(D5),
+			},
+		},
+		{
+			"en passant",
+			"4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1",
+			[]move.Move{move.From(E5) | move.To(D6)},
+		},
+		{
+			"capture promotion",
+			"1n2k3/P7/8/8/8/8/8/4K3 w - - 0 1",
+			[]move.Move{move.From(A7) | move.To(B8) | move.Promo(Queen)},
+		},
+		{
+			"castling",
+			"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1",
+			[]move.Move{move.Castling(E1, H1), move.Castling(E8, A8)},
+		},
+		{
+			"chess960 castling",
+			"1r4kr/8/8/8/8/8/8/2RK3R w CHbh - 0 1",
+			[]move.Move{move.Castling(D1, C1), move.Castling(G8, H8)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := Must(board.FromFEN(tt.fen))
+			a := NewAccumulators(net)
+			a.Refresh(b)
+
+			fresh := NewAccumulators(net)
+			check := func() {
+				t.Helper()
+				fresh.Refresh(b)
+				for pov := White; pov <= Black; pov++ {
+					assert.Equal(t, fresh.current(pov), a.current(pov))
+				}
+				assert.Equal(t, net.Evaluate(b), a.Evaluate(b.STM))
+			}
+
+			rs := make([]board.Reverse, 0, len(tt.moves))
+			for _, m := range tt.moves {
+				a.Push(b, m)
+				rs = append(rs, b.MakeMove(m))
+				check()
+			}
+
+			for i := len(tt.moves) - 1; i >= 0; i-- {
+				b.UndoMove(tt.moves[i], rs[i])
+				a.Pop()
+				check()
+			}
+		})
+	}
+}
+
+func TestEvaluateSymmetry(t *testing.T) {
+	net := Must(Parse(randomNetwork(8, 0)))
+
+	b := Must(board.FromFEN("r1bqkb1r/pppp1ppp/2n2n2/4p3/2B1P3/5N2/PPPP1PPP/RNBQK2R w KQkq - 4 4"))
+	mirrored := Must(board.FromFEN("rnbqk2r/pppp1ppp/5n2/2b1p3/4P3/2N2N2/PPPP1PPP/R1BQKB1R b KQkq - 4 4"))
+
+	assert.Equal(t, net.Evaluate(b), net.Evaluate(mirrored))
+}
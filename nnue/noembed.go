@@ -0,0 +1,7 @@
+//go:build !embednet
+
+package nnue
+
+// embedded is the default network built into the executable. Built without
+// the embednet tag there is no default network.
+var embedded []byte
@@ -25,6 +25,9 @@ const (
 	SEEPruningDepthLimit  = 7
 	SEEPruningQuietMargin = -84
 	SEEPruningNoisyMargin = -35
+	SEDepthLimit          = 7
+	SEMarginFactor        = 2
+	SEDoubleMargin        = 20
 )
 
 // UCIOptions returns the uci options string for tunable parameters in an spsa
@@ -32,6 +32,9 @@ var (
 	SEEPruningDepthLimit  = 7
 	SEEPruningQuietMargin = -84
 	SEEPruningNoisyMargin = -35
+	SEDepthLimit          = 7
+	SEMarginFactor        = 2
+	SEDoubleMargin        = 20
 )
 
 var tunables = [...]struct {
@@ -56,6 +59,9 @@ var tunables = [...]struct {
 	{&SEEPruningDepthLimit, "SEEPruningDepthLimit", 3, 12},
 	{&SEEPruningQuietMargin, "SEEPruningQuietMargin", -100, -50},
 	{&SEEPruningNoisyMargin, "SEEPruningNoisyMargin", -50, -10},
+	{&SEDepthLimit, "SEDepthLimit", 4, 10},
+	{&SEMarginFactor, "SEMarginFactor", 1, 4},
+	{&SEDoubleMargin, "SEDoubleMargin", 5, 50},
 }
 
 func UCIOptions() string {
@@ -41,6 +41,16 @@ func NewAllMoves(
 	return AllMoves{yielder: yielder{ms: ms}, board: b, ranker: ranker, hashMove: hashMove, hstack: hstack}
 }
 
+// NewRootMoves creates a new move iterator yielding moves in the order of
+// decreasing weights. The weights must be positive. ms points to the move
+// store, the moves are allocated in its top frame.
+func NewRootMoves(ms *move.Store, moves []move.Weighted) AllMoves {
+	for _, m := range moves {
+		*ms.Alloc(m.Move) = m
+	}
+	return AllMoves{yielder: yielder{ms: ms}, state: yieldRest}
+}
+
 // NoisyOrEvasions is the move iterator for a given position that iterates
 // noisy moves or when in check all evasions.
 type NoisyOrEvasions struct {
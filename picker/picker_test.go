@@ -121,7 +121,7 @@ func TestAllMoves(t *testing.T) {
 					assert.Equal(t, hashMove, m, "fen %s, hashmove %s yielded %s", tt.fen, hashMove, pck.Move())
 
 				case verifyGoodNoisies:
-					if (m.Promo() != NoPiece || b.SquaresToPiece[b.CaptureSq(m)] != NoPiece) && heur.SEE(b, m, 0) {
+					if (m.Promo() != NoPiece || b.Captured(m) != NoPiece) && heur.SEE(b, m, 0) {
 						assert.GreaterOrEqual(t, pck.Move().Weight, heur.Captures, "fen %s capture weight too low %s", tt.fen, m)
 						continue
 					}
@@ -130,7 +130,7 @@ func TestAllMoves(t *testing.T) {
 					fallthrough
 
 				case verifyQuiets:
-					if m.Promo() == NoPiece && b.SquaresToPiece[b.CaptureSq(m)] == NoPiece {
+					if m.Promo() == NoPiece && b.Captured(m) == NoPiece {
 						assert.Greater(t, pck.Move().Weight, -heur.Captures, "fen %s quiet weight too low %s", tt.fen, m)
 						assert.Less(t, pck.Move().Weight, heur.Captures, "fen %s quiet weight too high %s", tt.fen, m)
 						continue
@@ -269,6 +269,26 @@ func TestNoisyOrEvasions(t *testing.T) {
 	}
 }
 
+func TestRootMoves(t *testing.T) {
+	ms := move.NewStore()
+	ms.Push()
+
+	moves := []move.Weighted{
+		{Move: move.From(E2) | move.To(E4), Weight: 2},
+		{Move: move.From(D2) | move.To(D4), Weight: 3},
+		{Move: move.From(G1) | move.To(F3), Weight: 1},
+	}
+
+	pck := picker.NewRootMoves(ms, moves)
+	yielded := []move.Move{}
+	for pck.Next() {
+		yielded = append(yielded, pck.Move().Move)
+	}
+
+	assert.Equal(t, []move.Move{moves[1].Move, moves[0].Move, moves[2].Move}, yielded)
+	assertNonIncreasing(t, pck.YieldedMoves())
+}
+
 func assertNonIncreasing(t *testing.T, moves []move.Weighted, msgAndArgs ...any) {
 	for i := 1; i < len(moves); i++ {
 		assert.LessOrEqual(t, moves[i].Weight, moves[i-1].Weight, msgAndArgs...)
@@ -0,0 +1,111 @@
+package search
+
+import (
+	"math/rand/v2"
+
+	"github.com/paulsonkoly/chess-3/board"
+	"github.com/paulsonkoly/chess-3/eval"
+	"github.com/paulsonkoly/chess-3/move"
+	"github.com/paulsonkoly/chess-3/nnue"
+
+	. "github.com/paulsonkoly/chess-3/chess"
+)
+
+// Evaluator is the static evaluation used by the search. Each search thread
+// has its own Evaluator, they are not required to be thread safe.
+type Evaluator interface {
+	// Evaluate is the static evaluation of b from the side to move's point of
+	// view.
+	Evaluate(b *board.Board) Score
+	// Refresh is called with the root position at the start of the search.
+	Refresh(b *board.Board)
+	// MakeMove is called before the move m is made on b. Null moves are not
+	// reported.
+	MakeMove(b *board.Board, m move.Move)
+	// UndoMove is called after the last move reported by MakeMove is undone.
+	UndoMove()
+	// Clear clears the internal state, it is called between games.
+	Clear()
+}
+
+// HCE is the hand crafted evaluation of the eval package.
+type HCE struct {
+	eval   *eval.Eval[Score]
+	coeffs *eval.CoeffSet[Score]
+}
+
+// NewHCE creates a hand crafted evaluation with the coefficients c.
+func NewHCE(c *eval.CoeffSet[Score]) *HCE {
+	return &HCE{eval: eval.New[Score](), coeffs: c}
+}
+
+func (h *HCE) Evaluate(b *board.Board) Score    { return h.eval.Score(b, h.coeffs) }
+func (h *HCE) Refresh(*board.Board)             {}
+func (h *HCE) MakeMove(*board.Board, move.Move) {}
+func (h *HCE) UndoMove()                        {}
+func (h *HCE) Clear()                           { h.eval.Clear() }
+
+// NNUE is the evaluation of an nnue network.
+type NNUE struct {
+	acc *nnue.Accumulators
+}
+
+// NewNNUE creates an evaluation with the network net.
+func NewNNUE(net *nnue.Network) *NNUE {
+	return &NNUE{acc: nnue.NewAccumulators(net)}
+}
+
+func (n *NNUE) Evaluate(b *board.Board) Score        { return n.acc.Evaluate(b.STM) }
+func (n *NNUE) Refresh(b *board.Board)               { n.acc.Refresh(b) }
+func (n *NNUE) MakeMove(b *board.Board, m move.Move) { n.acc.Push(b, m) }
+func (n *NNUE) UndoMove()                            { n.acc.Pop() }
+func (n *NNUE) Clear()                               {}
+
+// Noisy adds pseudo random noise to the evaluation of an other Evaluator. The
+// noise is a function of the position, thus the same position always gets the
+// same noise. It is meant for weakening the engine.
+type Noisy struct {
+	Evaluator
+	noise Score
+	seed  *uint64 // seed is shared by the Noisy evaluators of the search threads.
+}
+
+// NewNoisy creates an evaluation adding noise of magnitude at most noise to e.
+func NewNoisy(e Evaluator, noise Score) *Noisy {
+	seed := rand.Uint64()
+	return &Noisy{Evaluator: e, noise: noise, seed: &seed}
+}
+
+// NoisyEvaluators is the constructor of the Noisy evaluators of the search
+// threads, adding noise of magnitude at most noise to the evaluators of
+// newEval. The evaluators share the noise, so the threads agree on the static
+// evaluations in the transposition table.
+func NoisyEvaluators(newEval func() Evaluator, noise Score) func() Evaluator {
+	seed := rand.Uint64()
+	return func() Evaluator { return &Noisy{Evaluator: newEval(), noise: noise, seed: &seed} }
+}
+
+func (n *Noisy) Evaluate(b *board.Board) Score {
+	h := splitMix(uint64(b.Hashes().Full()) ^ *n.seed)
+
+	noise := Score(h%uint64(2*n.noise+1)) - n.noise
+	bound := Inf - MaxPlies - 1
+
+	return Clamp(n.Evaluator.Evaluate(b)+noise, -bound, bound)
+}
+
+// Clear clears the internal state, and picks a new noise for each position,
+// shared with the evaluators of the same NoisyEvaluators.
+func (n *Noisy) Clear() {
+	*n.seed = rand.Uint64()
+	n.Evaluator.Clear()
+}
+
+// defaultEvaluator creates the evaluators of the network net, or the hand
+// crafted evaluation with the default coefficients if net is nil.
+func defaultEvaluator(net *nnue.Network) func() Evaluator {
+	if net == nil {
+		return func() Evaluator { return NewHCE(&eval.Coefficients) }
+	}
+	return func() Evaluator { return NewNNUE(net) }
+}
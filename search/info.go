@@ -0,0 +1,127 @@
+package search
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/paulsonkoly/chess-3/move"
+	"github.com/paulsonkoly/chess-3/transp"
+
+	. "github.com/paulsonkoly/chess-3/chess"
+)
+
+// Kind is the kind of an Info.
+type Kind byte
+
+const (
+	// PVInfo is the progress of a PV line, reported after each completed depth
+	// and each aspiration window failure.
+	PVInfo Kind = iota
+	// CurrMoveInfo is the root move being searched, in CurrMove and
+	// CurrMoveNumber.
+	CurrMoveInfo
+	// AbortInfo is the node count of an aborted search, reported at the abort.
+	// Only Depth and Nodes are set.
+	AbortInfo
+	// NoMateInfo reports that a mate search found no mate in Mate moves.
+	NoMateInfo
+)
+
+// Info is the search progress. Kind tells what it reports, the fields not
+// belonging to Kind are zero.
+type Info struct {
+	Kind     Kind
+	Depth    Depth // Depth is the iteration depth.
+	SelDepth Depth // SelDepth is the maximal ply reached in the iteration.
+	// MultiPV is the 1 based index of the PV line in multi PV mode, 0
+	// otherwise.
+	MultiPV int
+	Score   Score // Score is the score of the line from the side to move.
+	// Bound is the bound type of Score. It is transp.Exact unless the
+	// aspiration window failed.
+	Bound    transp.Type
+	WDL      *WDL  // WDL is the win, draw and loss probabilities, nil without a model.
+	Nodes    int   // Nodes is the number of nodes searched by all threads.
+	Time     int64 // Time is the elapsed time in milliseconds.
+	HashFull int   // HashFull is the permille of the transposition table in use.
+	TBHits   int   // TBHits is the number of successful tablebase probes.
+	// PV is the principal variation. The handler can keep it, the search does
+	// not reuse it.
+	PV []move.Move
+
+	CurrMove       move.Move // CurrMove is the root move being searched.
+	CurrMoveNumber int       // CurrMoveNumber is the 1 based number of CurrMove.
+	Mate           int       // Mate is the number of moves the mate search was limited to.
+}
+
+// WDL is the win, draw and loss probabilities in permille.
+type WDL struct {
+	Win, Draw, Loss int
+}
+
+// UCIInfo is an info handler writing info to w in the uci info line format,
+// with castling in the Chess960 notation if chess960 is set. It returns nil if
+// w is nil.
+func UCIInfo(w io.Writer, chess960 bool) func(Info) {
+	if w == nil {
+		return nil
+	}
+
+	return func(info Info) {
+		switch info.Kind {
+		case CurrMoveInfo:
+			fmt.Fprintf(w, "info depth %d currmove %s currmovenumber %d\n",
+				info.Depth, info.CurrMove.UCI(chess960), info.CurrMoveNumber)
+			return
+
+		case AbortInfo:
+			fmt.Fprintf(w, "info depth %d nodes %d\n", info.Depth, info.Nodes)
+			return
+
+		case NoMateInfo:
+			fmt.Fprintf(w, "info string no mate in %d found\n", info.Mate)
+			return
+		}
+
+		nps := int64(info.Nodes) * 1000 / max(info.Time, 1)
+
+		multiPV := ""
+		if info.MultiPV > 0 {
+			multiPV = fmt.Sprintf(" multipv %d", info.MultiPV)
+		}
+
+		wdl := ""
+		if info.WDL != nil {
+			wdl = fmt.Sprintf(" wdl %d %d %d", info.WDL.Win, info.WDL.Draw, info.WDL.Loss)
+		}
+
+		bound := ""
+		switch info.Bound {
+		case transp.UpperBound:
+			bound = " upperbound"
+		case transp.LowerBound:
+			bound = " lowerbound"
+		}
+
+		tbHits := ""
+		if info.TBHits > 0 {
+			tbHits = fmt.Sprintf(" tbhits %d", info.TBHits)
+		}
+
+		fmt.Fprintf(w, "info depth %d seldepth %d%s score %s%s%s nodes %d nps %d time %d hashfull %d%s pv %s\n",
+			info.Depth, info.SelDepth, multiPV, info.Score, wdl, bound, info.Nodes, nps, info.Time, info.HashFull,
+			tbHits, pvInfo(info.PV, chess960))
+	}
+}
+
+func pvInfo(moves []move.Move, chess960 bool) string {
+	sb := strings.Builder{}
+	space := ""
+	for _, m := range moves {
+		sb.WriteString(space)
+		sb.WriteString(m.UCI(chess960))
+		space = " "
+	}
+	return sb.String()
+}
@@ -50,3 +50,9 @@ func bufIx(ply Depth) int {
 func (pv *pv) active() []move.Move {
 	return pv.moves[0:pv.depth[0]]
 }
+
+// pvLine is a principal variation of a completed search with its score.
+type pvLine struct {
+	score Score
+	moves []move.Move
+}
@@ -0,0 +1,86 @@
+package search
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/paulsonkoly/chess-3/move"
+
+	. "github.com/paulsonkoly/chess-3/chess"
+)
+
+// RootMove is the search statistics of a root move.
+type RootMove struct {
+	Move  move.Move
+	Nodes int // Nodes is the number of nodes spent on the move.
+	// Score is the score of the move in its last full depth search, Inv if it
+	// was not searched yet. Moves not improving alpha have an upper bound
+	// score. Reduced searches failing low do not update it.
+	Score Score
+	Depth Depth // Depth is the iteration depth of the last full depth search of the move.
+}
+
+// RootMoves is the statistics of the root moves of the last search of the
+// main thread, in the order they were searched in the last iteration.
+func (s *Search) RootMoves() []RootMove { return slices.Clone(s.rootStats) }
+
+// resetRoot resets the root move statistics to moves.
+func (s *Search) resetRoot(moves []move.Move) {
+	s.rootStats = s.rootStats[:0]
+	for _, m := range moves {
+		s.rootStats = append(s.rootStats, RootMove{Move: m, Score: Inv})
+	}
+}
+
+// rootStat is the statistics of root move m. It is nil if m is not a root
+// move.
+func (s *Search) rootStat(m move.Move) *RootMove {
+	for i := range s.rootStats {
+		if s.rootStats[i].Move == m {
+			return &s.rootStats[i]
+		}
+	}
+	return nil
+}
+
+// sortRoot orders the root moves for the next iteration. best is searched
+// first, then the rest by their last scores and then by the effort spent on
+// them.
+func (s *Search) sortRoot(best move.Move) {
+	slices.SortStableFunc(s.rootStats, func(a, b RootMove) int {
+		switch {
+		case a.Move == best:
+			return -1
+		case b.Move == best:
+			return 1
+		}
+		return cmp.Or(cmp.Compare(b.Score, a.Score), cmp.Compare(b.Nodes, a.Nodes))
+	})
+}
+
+// rootPicker is the root move ordering of the current iteration. ok is false
+// if there are no statistics yet.
+func (s *Search) rootPicker() (moves []move.Weighted, ok bool) {
+	if len(s.rootStats) == 0 || s.rootStats[0].Depth == 0 {
+		return nil, false
+	}
+
+	moves = make([]move.Weighted, len(s.rootStats))
+	for i, stat := range s.rootStats {
+		moves[i] = move.Weighted{Move: stat.Move, Weight: Score(len(s.rootStats) - i)}
+	}
+	return moves, true
+}
+
+// rootNodeFrac is the fraction of the root nodes spent on the root move m in
+// the current search.
+func (s *Search) rootNodeFrac(m move.Move) float64 {
+	total := 0
+	for _, stat := range s.rootStats {
+		total += stat.Nodes
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(s.rootStat(m).Nodes) / float64(total)
+}
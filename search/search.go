@@ -1,18 +1,20 @@
 package search
 
 import (
-	"fmt"
+	"math"
+	"math/rand/v2"
 	"os"
-	"strings"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/paulsonkoly/chess-3/board"
-	"github.com/paulsonkoly/chess-3/eval"
 	"github.com/paulsonkoly/chess-3/heur"
 	"github.com/paulsonkoly/chess-3/move"
 	"github.com/paulsonkoly/chess-3/movegen"
 	"github.com/paulsonkoly/chess-3/params"
 	"github.com/paulsonkoly/chess-3/picker"
+	"github.com/paulsonkoly/chess-3/tablebase"
 	"github.com/paulsonkoly/chess-3/transp"
 
 	. "github.com/paulsonkoly/chess-3/chess"
@@ -26,7 +28,7 @@ func (s *Search) Go(b *board.Board, opts ...Option) (score Score, move move.Move
 		s.gen++
 	}()
 
-	options := Options{Depth: MaxPlies, Nodes: -1, SoftNodes: -1, Output: os.Stdout}
+	options := Options{Depth: MaxPlies, Nodes: -1, SoftNodes: -1, Output: os.Stdout, MultiPV: 1}
 	for _, opt := range opts {
 		opt(&options)
 	}
@@ -35,115 +37,454 @@ func (s *Search) Go(b *board.Board, opts ...Option) (score Score, move move.Move
 		options.Counters = &Counters{}
 	}
 
-	return s.iterativeDeepen(b, &options)
+	if options.InfoHandler == nil {
+		options.InfoHandler = UCIInfo(options.Output, options.Chess960)
+	}
+
+	s.setContempt(b, &options)
+
+	s.total.Store(0)
+
+	if len(s.helpers) == 0 {
+		score, move, ponder = s.iterativeDeepen(b, &options)
+		score, move, ponder = s.pick(score, move, ponder, &options)
+		s.reportMate(score, &options)
+		return
+	}
+
+	// Lazy SMP. The helpers search the same position on their own copy of the
+	// board until the main thread finishes, sharing their findings only
+	// through the transposition table.
+	stop := make(chan struct{})
+	wg := sync.WaitGroup{}
+
+	// the helpers stop at the node limit, except while pondering where only
+	// the main thread applies the limits after the ponder hit
+	helperNodes := options.Nodes
+	if options.PonderHit != nil {
+		helperNodes = -1
+	}
+
+	for _, h := range s.helpers {
+		h.refresh()
+		h.gen = s.gen
+		h.nodes.Store(0)
+		h.us, h.contempt, h.ttMask = s.us, s.contempt, s.ttMask
+
+		hb := b.Copy()
+		hOpts := Options{
+			Depth:     options.Depth,
+			Nodes:     helperNodes,
+			SoftNodes: -1,
+			Counters:  &Counters{},
+			Stop:      stop,
+			RootMoves: options.RootMoves,
+		}
+
+		wg.Go(func() {
+			h.iterativeDeepen(hb, &hOpts)
+			h.nodes.Store(int64(hOpts.Counters.Nodes))
+		})
+	}
+
+	score, move, ponder = s.iterativeDeepen(b, &options)
+
+	close(stop)
+	wg.Wait()
+
+	options.Counters.Nodes += s.helperNodes()
+	score, move, ponder = s.pick(score, move, ponder, &options)
+	s.reportMate(score, &options)
+
+	return
+}
+
+// pick picks the move to play among the PV lines of the last search if
+// opts.Temperature is set, otherwise it returns score, best and ponder. A line
+// is picked with a probability proportional to exp((score - max) /
+// temperature), where max is the best score of the lines.
+func (s *Search) pick(score Score, best, ponder move.Move, opts *Options) (Score, move.Move, move.Move) {
+	if opts.Temperature <= 0 || len(s.lines) < 2 {
+		return score, best, ponder
+	}
+
+	top := math.Inf(-1)
+	for _, line := range s.lines {
+		if len(line.moves) > 0 {
+			top = max(top, float64(line.score))
+		}
+	}
+
+	weights := make([]float64, len(s.lines))
+	sum := 0.0
+	for i, line := range s.lines {
+		if len(line.moves) > 0 {
+			weights[i] = math.Exp((float64(line.score) - top) / opts.Temperature)
+			sum += weights[i]
+		}
+	}
+	if sum == 0 {
+		return score, best, ponder
+	}
+
+	r := rand.Float64
+	if opts.Rand != nil {
+		r = opts.Rand.Float64
+	}
+
+	x := r() * sum
+	for i, line := range s.lines {
+		x -= weights[i]
+		if weights[i] > 0 && x < 0 {
+			ponder = 0
+			if len(line.moves) > 1 {
+				ponder = line.moves[1]
+			}
+			return line.score, line.moves[0], ponder
+		}
+	}
+
+	return score, best, ponder
+}
+
+// maxContempt is the limit of the dynamic contempt.
+const maxContempt = 200
+
+// setContempt sets the draw score of the search on the root position b from
+// opts. With dynamic contempt every pawn worth of material advantage of the
+// root side to move adds 10 to the contempt.
+func (s *Search) setContempt(b *board.Board, opts *Options) {
+	s.us = b.STM
+	s.contempt = opts.Contempt
+
+	if opts.DynamicContempt {
+		balance := Score(0)
+		for pt := Pawn; pt < King; pt++ {
+			balance += heur.PieceValues[pt] * Score(b.Counts[b.STM][pt]-b.Counts[b.STM.Flip()][pt])
+		}
+		s.contempt = Clamp(s.contempt+balance/10, -maxContempt, maxContempt)
+	}
+
+	// draw scores depend on the root side to move and the contempt, the tt
+	// entries of different draw scores must not mix
+	s.ttMask = 0
+	if s.contempt != 0 {
+		s.ttMask = board.Hash(splitMix(uint64(uint16(s.contempt))<<1 | uint64(s.us)))
+	}
+}
+
+// splitMix is the splitmix64 finalizer.
+func splitMix(h uint64) uint64 {
+	h = (h ^ h>>30) * 0xbf58476d1ce4e5b9
+	h = (h ^ h>>27) * 0x94d049bb133111eb
+	return h ^ h>>31
+}
+
+// draw is the draw score in b. Contempt is the penalty of a draw for the root
+// side to move.
+func (s *Search) draw(b *board.Board) Score {
+	if b.STM == s.us {
+		return -s.contempt
+	}
+	return s.contempt
+}
+
+// ttKey is the transposition table key of b.
+func (s *Search) ttKey(b *board.Board) board.Hash {
+	return b.Hashes().Full() ^ s.ttMask
+}
+
+// reportMate reports the outcome of a mate search.
+func (s *Search) reportMate(score Score, opts *Options) {
+	if opts.Mate > 0 && !opts.mateFound(score) && opts.InfoHandler != nil {
+		opts.InfoHandler(Info{Kind: NoMateInfo, Mate: opts.Mate})
+	}
 }
 
 // iterativeDeepen performs an iterative-deepened alpha-beta with aspiration
-// window. depth is iterated between 0 and d inclusive.
+// window. depth is iterated between 0 and d inclusive. In multi PV mode each
+// depth is searched once per PV line, excluding the root moves of the
+// previous lines. With a root move restriction only the allowed root moves
+// are searched. If the root is in the tablebase only the best ranked root
+// moves are searched.
 func (s *Search) iterativeDeepen(b *board.Board, opts *Options) (score Score, move move.Move, ponder move.Move) {
-	// otherwise a checkmate score would always fail high
-	alpha := -Inf - 1
-	beta := Inf + 1
+	s.start = time.Now()
+	base := s.start
+	tm := timeManager{}
+	timeScale := 1.0
+
+	s.eval.Refresh(b)
+
+	rootMoves := s.rootMoves(b)
+
+	// root move restriction, unless none of the allowed moves is legal. The
+	// disallowed moves are permanently excluded.
+	s.excluded = s.excluded[:0]
+	if allowed := allowedRootMoves(rootMoves, opts.RootMoves); len(allowed) > 0 {
+		for _, m := range rootMoves {
+			if !slices.Contains(allowed, m) {
+				s.excluded = append(s.excluded, m)
+			}
+		}
+		rootMoves = allowed
+	}
 
-	start := time.Now()
-	base := start
+	rootMoves, rootInTB, tbScore := s.rankRoot(b, rootMoves)
+	restricted := len(s.excluded)
+	s.resetRoot(rootMoves)
 
-	for idD := Depth(0); idD < MaxPlies && (idD <= opts.Depth || opts.PonderHit != nil); idD++ {
-		awOk := false // aspiration window succeeded
-		factor := Score(1)
-		var scoreSample Score
+	// reported is the score reported for score, the tablebase score takes
+	// precedence over non-mate scores.
+	reported := func(score Score) Score {
+		if rootInTB && !score.IsMate() {
+			return tbScore
+		}
+		return score
+	}
 
-		for !awOk {
-			scoreSample = s.alphaBeta(b, alpha, beta, idD, 0, PVNode, opts)
+	lines := make([]pvLine, max(1, min(opts.MultiPV, len(rootMoves))))
+	s.lines = lines
 
-			switch {
+	maxDepth := opts.maxDepth()
+	for idD := Depth(0); idD < MaxPlies && (idD <= maxDepth || opts.PonderHit != nil); idD++ {
+		if s.skipDepth(idD) {
+			continue
+		}
 
-			case scoreSample <= alpha:
-				alpha -= factor * Score(params.WindowSize)
-				factor *= 2
+		s.excluded = s.excluded[:restricted]
+		s.selDepth = 0
+		s.rootDepth = idD
+		s.sortRoot(move)
 
-			case scoreSample >= beta:
-				beta += factor * Score(params.WindowSize)
-				factor *= 2
+		for pvIx := range lines {
+			line := &lines[pvIx]
 
-			default:
-				awOk = true
+			// otherwise a checkmate score would always fail high
+			alpha := -Inf - 1
+			beta := Inf + 1
+
+			if idD > 0 {
+				alpha = line.score - Score(params.WindowSize)
+				beta = line.score + Score(params.WindowSize)
 			}
 
-			if s.abort(opts) {
-				// have a final node count for debugging purposes
-				if opts.Output != nil {
-					fmt.Fprintf(opts.Output, "info depth %d nodes %d\n", idD, opts.Counters.Nodes)
-				}
+			awOk := false // aspiration window succeeded
+			factor := Score(1)
+			var scoreSample Score
 
-				// we hit hard timeout/abort and we don't have a move. We try to return
-				// the first legal move, regardless of its quality, if there is none we
-				// return null move.
-				if move == 0 {
-					s.ms.Push()
-					defer s.ms.Pop()
+			for !awOk {
+				scoreSample = s.alphaBeta(b, alpha, beta, idD, 0, PVNode, opts)
 
-					// give up on ponder
-					ponder = 0
+				if s.abort(opts) {
+					// have a final node count for debugging purposes
+					if opts.InfoHandler != nil {
+						opts.InfoHandler(Info{Kind: AbortInfo, Depth: idD, Nodes: opts.Counters.Nodes + s.helperNodes()})
+					}
 
-					movegen.Noisy(s.ms, b)
-					movegen.Quiet(s.ms, b)
-					moves := s.ms.Frame()
-
-					for _, pseudo := range moves {
-						r := b.MakeMove(pseudo.Move)
-						if !b.InCheck(b.STM.Flip()) { // legal
-							move = pseudo.Move
-							b.UndoMove(pseudo.Move, r)
-							break
-						}
-						b.UndoMove(pseudo.Move, r)
+					// we hit hard timeout/abort and we don't have a move. We try to return
+					// the first legal move, regardless of its quality, if there is none we
+					// return null move.
+					if move == 0 && len(rootMoves) > 0 {
+						move = rootMoves[0]
+
+						// give up on ponder
+						ponder = 0
 					}
+					return
+				}
+
+				switch {
+
+				case scoreSample <= alpha:
+					s.info(b, opts, idD, pvIx, len(lines), reported(scoreSample), transp.UpperBound, line.moves)
+					alpha -= factor * Score(params.WindowSize)
+					factor *= 2
+
+				case scoreSample >= beta:
+					s.info(b, opts, idD, pvIx, len(lines), reported(scoreSample), transp.LowerBound, s.pv.active())
+					beta += factor * Score(params.WindowSize)
+					factor *= 2
+
+				default:
+					awOk = true
+				}
+			}
+
+			line.score = scoreSample
+			line.moves = append(line.moves[:0], s.pv.active()...)
+
+			if len(line.moves) > 0 {
+				s.excluded = append(s.excluded, line.moves[0])
+			}
+
+			if pvIx == 0 {
+				score = reported(scoreSample)
+				switch len(line.moves) {
+				case 0:
+				case 1:
+					move = line.moves[0]
+					// in case we have a short PV, clear ponder from previous iteration, as
+					// there is no guarantee the ponder move is still legal after move.
+					ponder = 0
+				default:
+					move = line.moves[0]
+					ponder = line.moves[1]
 				}
-				return
 			}
-		}
-		score = scoreSample
-		switch len(s.pv.active()) {
-		case 0:
-		case 1:
-			move = s.pv.active()[0]
-			// in case we have a short PV, clear ponder from previous iteration, as
-			// there is no guarantee the ponder move is still legal after move.
-			ponder = 0
-		default:
-			move = s.pv.active()[0]
-			ponder = s.pv.active()[1]
 		}
 
 		if opts.PonderHit != nil {
 			select {
 			case base = <-opts.PonderHit:
 				opts.PonderHit = nil
+				opts.ponderHit(opts.Counters.Nodes + s.helperNodes())
 			default:
 			}
 		}
 
-		sinceStart := time.Since(start).Milliseconds()
 		sinceBase := time.Since(base).Milliseconds()
-		cnts := opts.Counters
 
-		cnts.Time = sinceStart
-		if opts.Output != nil {
-			fmt.Fprintf(opts.Output, "info depth %d score %s nodes %d time %d hashfull %d pv %s\n",
-				idD, score, cnts.Nodes, sinceStart, s.tt.HashFull(s.gen), pvInfo(s.pv.active()))
+		opts.Counters.Time = time.Since(s.start).Milliseconds()
+		for pvIx, line := range lines {
+			s.info(b, opts, idD, pvIx, len(lines), reported(line.score), transp.Exact, line.moves)
 		}
 
-		if move != 0 && opts.softAbort(sinceBase, opts.Counters.Nodes) {
+		// a mate search is decided without a move if the side to move is mated
+		if opts.PonderHit == nil && opts.mateFound(score) {
 			return
 		}
 
-		alpha = score - Score(params.WindowSize)
-		beta = score + Score(params.WindowSize)
+		if move != 0 {
+			if !opts.FixedTime {
+				timeScale = tm.update(move, score, s.rootNodeFrac(move))
+			}
+
+			// a single legal move is played instantly in timed searches, unless the
+			// time is fixed
+			single := opts.SoftTime > 0 && !opts.FixedTime && len(rootMoves) == 1
+
+			if opts.softAbort(sinceBase, opts.Counters.Nodes+s.helperNodes(), timeScale) ||
+				(opts.PonderHit == nil && single) {
+				return
+			}
+		}
 	}
 	return
 }
 
+// skipSize and skipPhase diversify the iterative deepening of the helper
+// threads. Helper i skips the depths d where (d + skipPhase[i%20]) /
+// skipSize[i%20] is odd, so that the threads work on different depths.
+var (
+	skipSize  = [...]Depth{1, 1, 2, 2, 2, 2, 3, 3, 3, 3, 3, 3, 4, 4, 4, 4, 4, 4, 4, 4}
+	skipPhase = [...]Depth{0, 1, 0, 1, 2, 3, 0, 1, 2, 3, 4, 5, 0, 1, 2, 3, 4, 5, 6, 7}
+)
+
+// skipDepth is whether the iteration of depth d is skipped. The main thread
+// and the depth 0 iteration are never skipped.
+func (s *Search) skipDepth(d Depth) bool {
+	if s.helperIx == 0 || d == 0 {
+		return false
+	}
+
+	i := s.helperIx % len(skipSize)
+	return (d+skipPhase[i])/skipSize[i]%2 != 0
+}
+
+// rankRoot restricts the root moves to the best tablebase ranked moves if the
+// root is in the tablebase, excluding the rest. With DTZ ranking the best
+// ranked moves make progress, and we don't need to probe in the tree. With WDL
+// only ranking we keep probing to find the win.
+func (s *Search) rankRoot(b *board.Board, rootMoves []move.Move) (ranked []move.Move, rootInTB bool, score Score) {
+	s.tbProbe = s.tb != nil
+
+	if s.tb == nil || len(rootMoves) == 0 || b.Castles != 0 ||
+		(b.Colors[White]|b.Colors[Black]).Count() > s.tb.MaxPieces() {
+		return rootMoves, false, 0
+	}
+
+	ranks, dtz, ok := s.tb.RankRootMoves(b, s.ms, rootMoves)
+	if !ok {
+		return rootMoves, false, 0
+	}
+
+	best := slices.Max(ranks)
+	ranked = make([]move.Move, 0, len(rootMoves))
+	for i, m := range rootMoves {
+		if ranks[i] == best {
+			ranked = append(ranked, m)
+		} else {
+			s.excluded = append(s.excluded, m)
+		}
+	}
+
+	s.tbProbe = !dtz && best > 0
+
+	return ranked, true, tbRootScore(best)
+}
+
+// tbRootScore is the score of a tablebase root move rank. Wins that are drawn
+// by the fifty move rule score up to half a pawn.
+func tbRootScore(rank int) Score {
+	const bound = tablebase.MaxDTZ - 100
+
+	switch {
+	case rank >= bound:
+		return TBWin
+	case rank > 0:
+		return Score(max(3, rank-(tablebase.MaxDTZ-200)) * 100 / 200)
+	case rank == 0:
+		return 0
+	case rank > -bound:
+		return Score(min(-3, rank+(tablebase.MaxDTZ-200)) * 100 / 200)
+	}
+	return -TBWin
+}
+
+// allowedRootMoves returns the moves from legal that are also in allowed.
+func allowedRootMoves(legal, allowed []move.Move) []move.Move {
+	result := make([]move.Move, 0, len(allowed))
+	for _, m := range legal {
+		if slices.Contains(allowed, m) {
+			result = append(result, m)
+		}
+	}
+	return result
+}
+
+// rootMoves returns the legal moves in the root position b.
+func (s *Search) rootMoves(b *board.Board) []move.Move {
+	s.ms.Push()
+	defer s.ms.Pop()
+
+	movegen.Noisy(s.ms, b)
+	movegen.Quiet(s.ms, b)
+	pseudos := s.ms.Frame()
+
+	moves := make([]move.Move, 0, len(pseudos))
+	for _, pseudo := range pseudos {
+		r := b.MakeMove(pseudo.Move)
+		if !b.InCheck(b.STM.Flip()) { // legal
+			moves = append(moves, pseudo.Move)
+		}
+		b.UndoMove(pseudo.Move, r)
+	}
+
+	return moves
+}
+
+// makeMove makes the move m on b, notifying the evaluator.
+func (s *Search) makeMove(b *board.Board, m move.Move) board.Reverse {
+	s.eval.MakeMove(b, m)
+	return b.MakeMove(m)
+}
+
+// undoMove undoes the move m made by makeMove.
+func (s *Search) undoMove(b *board.Board, m move.Move, r board.Reverse) {
+	b.UndoMove(m, r)
+	s.eval.UndoMove()
+}
+
 func (s *Search) abort(opts *Options) bool {
 	if s.aborted {
 		return true
@@ -159,27 +500,63 @@ func (s *Search) abort(opts *Options) bool {
 	return false
 }
 
+// nodesPublishMask determines how often the node count is published for the
+// main thread by a helper thread.
+const nodesPublishMask = 1024 - 1
+
 // incrementNodes increments node count in opts.counters, except if it would
-// overrun the alloted nodes in which case it sets abort.
+// overrun the alloted nodes in which case it sets abort. The alloted nodes are
+// shared by all threads, the node count of the other threads is updated on
+// each publish. The nodes are not limited while pondering.
 func (s *Search) incrementNodes(opts *Options) {
-	if opts.Nodes == -1 || opts.Counters.Nodes < opts.Nodes {
-		opts.Counters.Nodes++
-	} else if opts.PonderHit == nil {
+	if opts.Nodes != -1 && opts.PonderHit == nil && opts.Counters.Nodes+s.othersCnt >= opts.Nodes {
 		s.aborted = true
+		return
+	}
+
+	opts.Counters.Nodes++
+
+	if opts.Counters.Nodes&nodesPublishMask == 0 {
+		s.nodes.Store(int64(opts.Counters.Nodes))
+		s.published += nodesPublishMask + 1
+		s.othersCnt = int(s.total.Add(nodesPublishMask+1)) - s.published
 	}
 }
 
-func pvInfo(moves []move.Move) string {
-	sb := strings.Builder{}
-	space := ""
-	for _, m := range moves {
-		sb.WriteString(space)
-		fmt.Fprint(&sb, m)
-		space = " "
+// info reports the PV line pvIx out of lines at depth d with score of bound
+// type and moves in the root position b to the info handler.
+func (s *Search) info(b *board.Board, opts *Options, d Depth, pvIx, lines int, score Score, bound transp.Type, moves []move.Move) {
+	if opts.InfoHandler == nil {
+		return
+	}
+
+	info := Info{
+		Depth:    d,
+		SelDepth: s.selDepth,
+		Score:    score,
+		Bound:    bound,
+		Nodes:    opts.Counters.Nodes + s.helperNodes(),
+		Time:     time.Since(s.start).Milliseconds(),
+		HashFull: s.tt.HashFull(s.gen),
+		TBHits:   opts.Counters.TBHits,
+		PV:       slices.Clone(moves),
 	}
-	return sb.String()
+
+	if lines > 1 {
+		info.MultiPV = pvIx + 1
+	}
+
+	if opts.WDL != nil {
+		w, d, l := opts.WDL.WDL(b, score)
+		info.WDL = &WDL{Win: w, Draw: d, Loss: l}
+	}
+
+	opts.InfoHandler(info)
 }
 
+// maxDoubleExts is the maximal number of double extensions on a path.
+const maxDoubleExts = 6
+
 // Node is the predicted type of the node.
 type Node = byte
 
@@ -203,6 +580,7 @@ func (s *Search) alphaBeta(b *board.Board, alpha, beta Score, d, ply Depth, nTyp
 
 	s.incrementNodes(opts)
 	opts.Counters.ABNodes++
+	s.selDepth = max(s.selDepth, ply)
 
 	if s.abort(opts) {
 		return Inv
@@ -210,13 +588,32 @@ func (s *Search) alphaBeta(b *board.Board, alpha, beta Score, d, ply Depth, nTyp
 
 	tfCnt := b.Threefold()
 	// this condition is trying to avoid returning 0 move on ply 0 if it's the second repetition
-	if b.FiftyCnt >= 100 || tfCnt >= 3-min(ply, 1) {
-		return 0
+	if b.FiftyCnt >= 100 || tfCnt >= 3-min(ply, 1) || (ply > 0 && b.InsufficientMaterial()) {
+		return s.draw(b)
 	}
 
-	var hashMove move.Move
-	if transpE, ok := s.tt.LookUp(b.Hashes().Full()); ok {
+	// singular is the move excluded by the singular extension search of this
+	// node, the tt entry of the node belongs to the full search
+	singular := s.singular[ply]
+
+	// the root score is not the score of the position if root moves are
+	// excluded, in multi PV mode or with a root move restriction
+	ttStore := singular == 0 && (ply > 0 || len(s.excluded) == 0)
+
+	var (
+		hashMove move.Move
+		ttValue  Score
+		ttDepth  Depth
+		ttType   transp.Type
+		ttHit    bool
+	)
+	ttEval := Inv
+	// ttPV is whether the node is or has been a PV node
+	ttPV := nType == PVNode
+	if transpE, ok := s.tt.LookUp(s.ttKey(b)); ok && singular == 0 {
 		hashMove = transpE.Move
+		ttValue, ttDepth, ttType, ttEval, ttHit = transpE.Value(ply), transpE.Depth(), transpE.Type(), transpE.Eval(), true
+		ttPV = ttPV || transpE.PV()
 
 		if nType != PVNode && transpE.Depth() >= d {
 			tpVal := transpE.Value(ply)
@@ -239,12 +636,41 @@ func (s *Search) alphaBeta(b *board.Board, alpha, beta Score, d, ply Depth, nTyp
 		}
 	}
 
+	// tablebase probe right after a zeroing move, the tables don't consider
+	// the fifty move counter
+	if s.tbProbe && ply > 0 && singular == 0 && b.FiftyCnt == 0 && b.Castles == 0 &&
+		(b.Colors[White]|b.Colors[Black]).Count() <= s.tb.MaxPieces() {
+
+		if wdl, ok := s.tb.ProbeWDL(b, s.ms); ok {
+			opts.Counters.TBHits++
+
+			// cursed wins and blessed losses are draws, scored with contempt
+			value, typ := s.draw(b), transp.Exact
+			switch {
+			case wdl > tablebase.CursedWin:
+				value, typ = TBWin-Score(ply), transp.LowerBound
+			case wdl < tablebase.BlessedLoss:
+				value, typ = -TBWin+Score(ply), transp.UpperBound
+			}
+
+			if typ == transp.Exact || (typ == transp.LowerBound && value >= beta) ||
+				(typ == transp.UpperBound && value <= alpha) {
+				s.tt.Insert(s.ttKey(b), s.gen, min(d+6, MaxPlies-1), ply, 0, value, Inv, ttPV, typ)
+				return value
+			}
+		}
+	}
+
 	inCheck := b.InCheck(b.STM)
 	improving := false
-	staticEval := Inv
+	rawEval, staticEval := Inv, Inv
 
 	if !inCheck {
-		staticEval = s.eval.Score(b, &eval.Coefficients)
+		rawEval = ttEval
+		if rawEval == Inv {
+			rawEval = s.eval.Evaluate(b)
+		}
+		staticEval = s.corr.Apply(b, rawEval)
 
 		oldScore := Inv
 		if old, ok := s.hstack.Top(1); ok && old.Score != Inv {
@@ -256,14 +682,14 @@ func (s *Search) alphaBeta(b *board.Board, alpha, beta Score, d, ply Depth, nTyp
 		improving = oldScore < staticEval
 
 		// RFP
-		if d < Depth(params.RFPDepthLimit) &&
+		if singular == 0 && d < Depth(params.RFPDepthLimit) &&
 			staticEval >= beta+Score(d)*Score(params.RFPScoreFactor) &&
 			beta > -Inf+MaxPlies {
 			return staticEval
 		}
 
 		// null move pruning
-		if d > Depth(params.NMPDepthLimit) &&
+		if singular == 0 && d > Depth(params.NMPDepthLimit) &&
 			staticEval >= beta &&
 			b.Colors[b.STM] & ^(b.Pieces[Pawn]|b.Pieces[King]) != 0 {
 
@@ -285,10 +711,18 @@ func (s *Search) alphaBeta(b *board.Board, alpha, beta Score, d, ply Depth, nTyp
 		}
 	}
 
-	pck := picker.NewAllMoves(b, s.ms, &s.ranker, hashMove, s.hstack)
 	s.ms.Push()
 	defer s.ms.Pop()
 
+	// the root moves are ordered by their statistics from the previous
+	// iterations
+	pck := picker.NewAllMoves(b, s.ms, &s.ranker, hashMove, s.hstack)
+	if ply == 0 {
+		if moves, ok := s.rootPicker(); ok {
+			pck = picker.NewRootMoves(s.ms, moves)
+		}
+	}
+
 	// iir
 	if nType != AllNode && d > Depth(params.IIRDepthLimit) && hashMove == 0 {
 		d--
@@ -305,8 +739,14 @@ func (s *Search) alphaBeta(b *board.Board, alpha, beta Score, d, ply Depth, nTyp
 		w := pck.Move()
 		m := w.Move
 
+		// root move restriction and multi PV: moves not allowed or the moves of
+		// the already reported PV lines are not searched
+		if (ply == 0 && slices.Contains(s.excluded, m)) || m == singular {
+			continue
+		}
+
 		moved := b.SquaresToPiece[m.From()]
-		captured := b.SquaresToPiece[b.CaptureSq(m)]
+		captured := b.Captured(m)
 		quiet := captured == NoPiece && m.Promo() == NoPiece
 
 		// SEE pruning
@@ -321,14 +761,61 @@ func (s *Search) alphaBeta(b *board.Board, alpha, beta Score, d, ply Depth, nTyp
 			}
 		}
 
-		r := b.MakeMove(m)
+		// Singular extension. The hash move is extended if all the other moves
+		// fail low against a margin below its score in a reduced search, and
+		// extended twice if they fail low by a large margin outside of PV nodes,
+		// at most maxDoubleExts times on a path. If the other moves also fail
+		// high the node is pruned (multi-cut).
+		ext := Depth(0)
+		if ttHit && m == hashMove && ply > 0 && ply < 2*s.rootDepth && d >= Depth(params.SEDepthLimit) &&
+			ttType != transp.UpperBound && ttDepth >= d-3 && !ttValue.IsMate() {
+
+			sBeta := ttValue - Score(d)*Score(params.SEMarginFactor)
+
+			s.singular[ply] = m
+			value := s.alphaBeta(b, sBeta-1, sBeta, (d-1)/2, ply, CutNode, opts)
+			s.singular[ply] = 0
+
+			if s.abort(opts) {
+				return Inv
+			}
+
+			switch {
+			case value < sBeta-Score(params.SEDoubleMargin) && nType != PVNode && s.doubleExt[ply] < maxDoubleExts:
+				ext = 2
+
+			case value < sBeta:
+				ext = 1
+
+			case sBeta >= beta:
+				return sBeta
+			}
+		}
+
+		r := s.makeMove(b, m)
 		if b.InCheck(b.STM.Flip()) {
-			b.UndoMove(m, r)
+			s.undoMove(b, m, r)
 			continue
 		}
 
 		hasLegal = true
 		moveCnt++
+		rootNodes := opts.Counters.Nodes
+
+		// check extension
+		if ext == 0 && ply < 2*s.rootDepth && b.InCheck(b.STM) {
+			ext = 1
+		}
+
+		s.doubleExt[ply+1] = s.doubleExt[ply]
+		if ext > 1 {
+			s.doubleExt[ply+1]++
+		}
+
+		if ply == 0 && opts.CurrMoveTime > 0 && opts.InfoHandler != nil &&
+			time.Since(s.start).Milliseconds() > opts.CurrMoveTime {
+			opts.InfoHandler(Info{Kind: CurrMoveInfo, Depth: s.rootDepth, CurrMove: m, CurrMoveNumber: moveCnt})
+		}
 
 		s.hstack.Push(heur.StackMove{Piece: moved, To: m.To(), Score: staticEval})
 
@@ -343,19 +830,24 @@ func (s *Search) alphaBeta(b *board.Board, alpha, beta Score, d, ply Depth, nTyp
 		// Late move reduction and null-window search. Skip it on the first legal
 		// move, which is likely to be the hash move.
 		fullSearched := false
+		// reduced is whether value is the result of a reduced depth search
+		reduced := false
 		if d > 1 && quietCnt > params.LMRStart && !inCheck {
-			rd := lmr(d, moveCnt-1, improving, nType)
+			rd := lmr(d, moveCnt-1, improving, ttPV, nType)
 
 			// reduced depth first, then re-try with full depth and null window.
 			if rd < d-1 {
 				value = -s.alphaBeta(b, -alpha-1, -alpha, rd, ply+1, next, opts)
+				reduced = true
 			}
 
 			if value <= alpha {
 				goto Fin
 			}
 
-			value = -s.alphaBeta(b, -alpha-1, -alpha, d-1, ply+1, next, opts)
+			reduced = false
+
+			value = -s.alphaBeta(b, -alpha-1, -alpha, d-1+ext, ply+1, next, opts)
 
 			if value <= alpha {
 				goto Fin
@@ -367,14 +859,24 @@ func (s *Search) alphaBeta(b *board.Board, alpha, beta Score, d, ply Depth, nTyp
 
 		// null window search failed (meaning didn't fail low).
 		if !fullSearched {
-			value = -s.alphaBeta(b, -beta, -alpha, d-1, ply+1, next, opts)
+			value = -s.alphaBeta(b, -beta, -alpha, d-1+ext, ply+1, next, opts)
 		}
 
 	Fin:
 
-		b.UndoMove(m, r)
+		s.undoMove(b, m, r)
 		s.hstack.Pop()
 
+		if ply == 0 {
+			stat := s.rootStat(m)
+			stat.Nodes += opts.Counters.Nodes - rootNodes
+			// only the moves searched to the iteration depth, the root depth
+			// might be reduced by iir
+			if !s.abort(opts) && !reduced && d == s.rootDepth {
+				stat.Score, stat.Depth = value, s.rootDepth
+			}
+		}
+
 		if value > maxim {
 			maxim = value
 		}
@@ -388,8 +890,18 @@ func (s *Search) alphaBeta(b *board.Board, alpha, beta Score, d, ply Depth, nTyp
 
 		if value > alpha {
 			if value >= beta {
+				// the fail high move is reported with the lowerbound at the root
+				if ply == 0 {
+					s.pv.insert(ply, m)
+				}
+
 				// store node as fail high (cut-node)
-				s.tt.Insert(b.Hashes().Full(), s.gen, d, ply, m, value, transp.LowerBound)
+				if ttStore {
+					s.tt.Insert(s.ttKey(b), s.gen, d, ply, m, value, rawEval, ttPV, transp.LowerBound)
+				}
+				if singular == 0 && quiet && staticEval != Inv && value > staticEval && value < Inf-MaxPlies {
+					s.corr.Update(b, d, value-staticEval)
+				}
 				s.ranker.FailHigh(d, b, pck.YieldedMoves(), s.hstack)
 				if opts.Debug {
 					opts.Counters.Moves += moveCnt
@@ -414,7 +926,7 @@ func (s *Search) alphaBeta(b *board.Board, alpha, beta Score, d, ply Depth, nTyp
 
 		// LMP
 		quietLimit := int(d) * int(d)
-		if !improving {
+		if !improving && !ttPV {
 			quietLimit /= 2
 		}
 		if !inCheck && alpha+1 == beta && quietCnt > 1+quietLimit {
@@ -427,7 +939,12 @@ func (s *Search) alphaBeta(b *board.Board, alpha, beta Score, d, ply Depth, nTyp
 	}
 
 	if !hasLegal {
-		maxim = Score(0)
+		// the singular move is the only legal move
+		if singular != 0 {
+			return alpha
+		}
+
+		maxim = s.draw(b)
 
 		if inCheck {
 			maxim = -Inf + Score(ply)
@@ -436,11 +953,24 @@ func (s *Search) alphaBeta(b *board.Board, alpha, beta Score, d, ply Depth, nTyp
 		failLow = false
 	}
 
-	if failLow {
+	if singular != 0 {
+		return maxim
+	}
+
+	switch {
+	case !ttStore:
+	case failLow:
 		// store node as fail low (All-node)
-		s.tt.Insert(b.Hashes().Full(), s.gen, d, ply, 0, maxim, transp.UpperBound)
-	} else {
-		s.tt.Insert(b.Hashes().Full(), s.gen, d, ply, bestMove, maxim, transp.Exact)
+		s.tt.Insert(s.ttKey(b), s.gen, d, ply, 0, maxim, rawEval, ttPV, transp.UpperBound)
+	default:
+		s.tt.Insert(s.ttKey(b), s.gen, d, ply, bestMove, maxim, rawEval, ttPV, transp.Exact)
+	}
+
+	// learn the static evaluation error from quiet best moves, and from fail
+	// lows only if they are below the static evaluation
+	quietBest := bestMove == 0 || (b.Captured(bestMove) == NoPiece && bestMove.Promo() == NoPiece)
+	if hasLegal && staticEval != Inv && !maxim.IsMate() && quietBest && (!failLow || maxim < staticEval) {
+		s.corr.Update(b, d, maxim-staticEval)
 	}
 
 	return maxim
@@ -494,8 +1024,8 @@ var log = [...]int{
 //
 //	x = (1..200).map {|i| (Math.log2(i) * 69).round }.unshift(0)
 //	10.times.map {|d| 30.times.map {|m| (x[d] * x[m] )>>14}}
-func lmr(d Depth, mCount int, improving bool, nType Node) Depth {
-	value := (log[d] * log[min(mCount, len(log)-1)]) >> 14
+func lmr(d Depth, mCount int, improving, ttPV bool, nType Node) Depth {
+	value := (log[min(int(d), len(log)-1)] * log[min(mCount, len(log)-1)]) >> 14
 
 	if nType != PVNode {
 		value++
@@ -505,6 +1035,10 @@ func lmr(d Depth, mCount int, improving bool, nType Node) Depth {
 		value++
 	}
 
+	if ttPV {
+		value--
+	}
+
 	return Clamp(d-1-Depth(value), 0, d-1)
 }
 
@@ -512,18 +1046,24 @@ func lmr(d Depth, mCount int, improving bool, nType Node) Depth {
 func (s *Search) quiescence(b *board.Board, alpha, beta Score, ply Depth, opts *Options) Score {
 
 	s.incrementNodes(opts)
+	s.selDepth = max(s.selDepth, ply)
 
 	if s.abort(opts) {
 		return Inv
 	}
 
-	if b.FiftyCnt >= 100 || b.Threefold() >= 3 {
-		return 0
+	if b.FiftyCnt >= 100 || b.Threefold() >= 3 || b.InsufficientMaterial() {
+		return s.draw(b)
 	}
 
 	transpT := s.tt
-	if transpE, ok := transpT.LookUp(b.Hashes().Full()); ok {
+	// the depth 0 iteration at the root, see alphaBeta
+	ttStore := ply > 0 || len(s.excluded) == 0
+	ttEval := Inv
+	ttPV := false
+	if transpE, ok := transpT.LookUp(s.ttKey(b)); ok {
 		tpVal := transpE.Value(ply)
+		ttEval, ttPV = transpE.Eval(), transpE.PV()
 
 		switch transpE.Type() {
 
@@ -543,15 +1083,19 @@ func (s *Search) quiescence(b *board.Board, alpha, beta Score, ply Depth, opts *
 	}
 
 	checkers := b.Checkers()
-	var standPat, delta Score
+	var delta Score
+	standPat := Inv
 	maxim := -Inf - 1
 
 	if checkers == 0 {
 		if b.IsStalemate() {
-			return 0
+			return s.draw(b)
 		}
 
-		standPat = s.eval.Score(b, &eval.Coefficients)
+		standPat = ttEval
+		if standPat == Inv {
+			standPat = s.eval.Evaluate(b)
+		}
 		if standPat >= beta {
 			return standPat
 		}
@@ -576,13 +1120,13 @@ func (s *Search) quiescence(b *board.Board, alpha, beta Score, ply Depth, opts *
 				break
 			}
 
-			captured = b.SquaresToPiece[b.CaptureSq(m.Move)]
+			captured = b.Captured(m.Move)
 		}
 
-		r := b.MakeMove(m.Move)
+		r := s.makeMove(b, m.Move)
 
 		if b.InCheck(b.STM.Flip()) {
-			b.UndoMove(m.Move, r)
+			s.undoMove(b, m.Move, r)
 			continue
 		}
 
@@ -596,16 +1140,18 @@ func (s *Search) quiescence(b *board.Board, alpha, beta Score, ply Depth, opts *
 			}
 
 			if gain+delta < alpha {
-				b.UndoMove(m.Move, r)
+				s.undoMove(b, m.Move, r)
 				break
 			}
 		}
 
 		curr := -s.quiescence(b, -beta, -alpha, ply+1, opts)
-		b.UndoMove(m.Move, r)
+		s.undoMove(b, m.Move, r)
 
 		if curr >= beta {
-			transpT.Insert(b.Hashes().Full(), s.gen, 0, ply, m.Move, curr, transp.LowerBound)
+			if ttStore {
+				transpT.Insert(s.ttKey(b), s.gen, 0, ply, m.Move, curr, standPat, ttPV, transp.LowerBound)
+			}
 			return curr
 		}
 		maxim = max(maxim, curr)
@@ -620,7 +1166,9 @@ func (s *Search) quiescence(b *board.Board, alpha, beta Score, ply Depth, opts *
 		maxim = -Inf + Score(ply)
 	}
 
-	transpT.Insert(b.Hashes().Full(), s.gen, 0, ply, 0, maxim, transp.UpperBound)
+	if ttStore {
+		transpT.Insert(s.ttKey(b), s.gen, 0, ply, 0, maxim, standPat, ttPV, transp.UpperBound)
+	}
 
 	return maxim
 }
@@ -1,14 +1,23 @@
 package search_test
 
 import (
+	"bytes"
 	"fmt"
+	"math/rand/v2"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/paulsonkoly/chess-3/board"
 	. "github.com/paulsonkoly/chess-3/chess"
 	"github.com/paulsonkoly/chess-3/move"
+	"github.com/paulsonkoly/chess-3/nnue"
 	"github.com/paulsonkoly/chess-3/search"
 	"github.com/paulsonkoly/chess-3/transp"
+	"github.com/paulsonkoly/chess-3/wdl"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -159,3 +168,559 @@ func TestGoFinal(t *testing.T) {
 		})
 	}
 }
+
+// TestGoThreads tests that a multi-threaded search returns a legal move and
+// aggregates the node counts of the helper threads.
+func TestGoThreads(t *testing.T) {
+	b := Must(board.FromFEN("r3k2r/2pb1ppp/2pp1q2/p7/1nP1B3/1P2P3/P2N1PPP/R2QK2R w KQkq a6 0 14"))
+	s := search.New(1 * transp.MegaBytes)
+	s.SetThreads(4)
+
+	counters := search.Counters{}
+	_, move, _ := s.Go(b, search.WithDepth(8), search.WithCounters(&counters), search.WithOutput(nil))
+
+	assert.True(t, b.IsPseudoLegal(move), "not pseudo legal %s", move)
+	assert.Equal(t, "r3k2r/2pb1ppp/2pp1q2/p7/1nP1B3/1P2P3/P2N1PPP/R2QK2R w KQkq a6 0 14", b.FEN())
+	assert.Positive(t, counters.Nodes)
+
+	// the node limit is shared by the threads, the helper counts are sampled
+	// every 1024 nodes
+	counters = search.Counters{}
+	_, move, _ = s.Go(b, search.WithNodes(50000), search.WithCounters(&counters), search.WithOutput(nil))
+
+	assert.True(t, b.IsPseudoLegal(move), "not pseudo legal %s", move)
+	assert.LessOrEqual(t, counters.Nodes, 50000+4*1024)
+
+	s.SetThreads(1)
+
+	_, move, _ = s.Go(b, search.WithDepth(8), search.WithOutput(nil))
+
+	assert.True(t, b.IsPseudoLegal(move), "not pseudo legal %s", move)
+}
+
+// TestGoNetwork tests the search with the NNUE evaluation. With a network of
+// zero weights the search is driven by the mate scores only.
+func TestGoNetwork(t *testing.T) {
+	b := Must(board.FromFEN("6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1"))
+	s := search.New(1 * transp.MegaBytes)
+	net := Must(nnue.Parse(make([]byte, 2*(16*(nnue.Inputs+3)+1))))
+	s.SetEvaluator(func() search.Evaluator { return search.NewNNUE(net) })
+	s.SetThreads(2)
+
+	score, move, _ := s.Go(b, search.WithDepth(4), search.WithOutput(nil))
+
+	assert.Equal(t, "a1a8", move.String())
+	mate, ok := score.MateMoves()
+	assert.True(t, ok)
+	assert.Equal(t, 1, mate)
+}
+
+// materialEval is a material only evaluator counting the hook calls.
+type materialEval struct {
+	refreshes, clears int
+	depth, maxDepth   int
+}
+
+func (m *materialEval) Evaluate(b *board.Board) Score {
+	values := [...]Score{Pawn: 100, Knight: 300, Bishop: 300, Rook: 500, Queen: 900}
+	score := Score(0)
+	for piece := Pawn; piece < King; piece++ {
+		score += values[piece] * Score(b.Counts[b.STM][piece]-b.Counts[b.STM.Flip()][piece])
+	}
+	return score
+}
+
+func (m *materialEval) Refresh(*board.Board) { m.refreshes++ }
+
+func (m *materialEval) MakeMove(*board.Board, move.Move) {
+	m.depth++
+	m.maxDepth = max(m.maxDepth, m.depth)
+}
+
+func (m *materialEval) UndoMove() { m.depth-- }
+func (m *materialEval) Clear()    { m.clears++ }
+
+// TestGoEvaluator tests that the search uses the injected evaluator and calls
+// its hooks.
+func TestGoEvaluator(t *testing.T) {
+	b := Must(board.FromFEN("4k3/8/8/3q4/8/8/3R4/4K3 w - - 0 1"))
+	evals := []*materialEval{}
+	s := search.New(1*transp.MegaBytes, search.WithEvaluator(func() search.Evaluator {
+		e := &materialEval{}
+		evals = append(evals, e)
+		return e
+	}))
+
+	_, move, _ := s.Go(b, search.WithDepth(4), search.WithOutput(nil))
+	s.Clear()
+
+	assert.Equal(t, "d2d5", move.String())
+	assert.Len(t, evals, 1)
+	assert.Equal(t, 1, evals[0].refreshes)
+	assert.Equal(t, 1, evals[0].clears)
+	assert.Equal(t, 0, evals[0].depth)
+	assert.Positive(t, evals[0].maxDepth)
+}
+
+// TestNoisy tests the evaluation noise.
+func TestNoisy(t *testing.T) {
+	e := search.NewNoisy(&materialEval{}, 50)
+	noises := map[Score]bool{}
+	for _, fen := range []string{
+		StartPosFEN,
+		"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - 0 1",
+		"rnbqkbnr/pppppppp/8/8/3P4/8/PPP1PPPP/RNBQKBNR b KQkq - 0 1",
+		"rnbqkbnr/pppppppp/8/8/2P5/8/PP1PPPPP/RNBQKBNR b KQkq - 0 1",
+		"rnbqkbnr/pppppppp/8/8/8/5N2/PPPPPPPP/RNBQKB1R b KQkq - 1 1",
+	} {
+		b := Must(board.FromFEN(fen))
+		noise := e.Evaluate(b)
+
+		assert.Equal(t, noise, e.Evaluate(b))
+		assert.LessOrEqual(t, Abs(noise), Score(50))
+		noises[noise] = true
+	}
+
+	assert.Greater(t, len(noises), 1)
+
+	t.Run("shared by the threads", func(t *testing.T) {
+		newEval := search.NoisyEvaluators(func() search.Evaluator { return &materialEval{} }, 50)
+		e1, e2 := newEval(), newEval()
+		b := Must(board.FromFEN(StartPosFEN))
+
+		assert.Equal(t, e1.Evaluate(b), e2.Evaluate(b))
+	})
+}
+
+// TestGoTemperature tests picking the move among the PV lines.
+func TestGoTemperature(t *testing.T) {
+	s := search.New(1 * transp.MegaBytes)
+	r := rand.New(rand.NewPCG(1, 2))
+
+	// the queen capture is much better than the other moves
+	b := Must(board.FromFEN("4k3/8/8/3q4/8/8/3R4/4K3 w - - 0 1"))
+	for range 20 {
+		s.Clear()
+		_, move, _ := s.Go(b, search.WithDepth(4), search.WithMultiPV(3), search.WithTemperature(10, r),
+			search.WithOutput(nil))
+
+		assert.Equal(t, "d2d5", move.String())
+	}
+
+	b = board.StartPos()
+	picked := map[move.Move]bool{}
+	for range 20 {
+		s.Clear()
+		_, move, _ := s.Go(b, search.WithDepth(4), search.WithMultiPV(3), search.WithTemperature(1e6, r),
+			search.WithOutput(nil))
+
+		assert.True(t, b.IsPseudoLegal(move), "not pseudo legal %s", move)
+		picked[move] = true
+	}
+	assert.Len(t, picked, 3)
+}
+
+// TestGoMultiPV tests that each PV line is reported with a distinct root move.
+func TestGoMultiPV(t *testing.T) {
+	b := board.StartPos()
+	s := search.New(1 * transp.MegaBytes)
+
+	output := &bytes.Buffer{}
+	_, move, _ := s.Go(b, search.WithDepth(6), search.WithMultiPV(3), search.WithOutput(output))
+
+	assert.True(t, b.IsPseudoLegal(move), "not pseudo legal %s", move)
+
+	firstMoves := map[int]string{}
+	for line := range strings.Lines(output.String()) {
+		fields := strings.Fields(line)
+		if !slices.Contains(fields, "depth") || !slices.Contains(fields, "6") || !slices.Contains(fields, "multipv") {
+			continue
+		}
+
+		k, err := strconv.Atoi(fields[slices.Index(fields, "multipv")+1])
+		assert.NoError(t, err)
+
+		firstMoves[k] = fields[slices.Index(fields, "pv")+1]
+	}
+
+	assert.Len(t, firstMoves, 3)
+	assert.Equal(t, move.String(), firstMoves[1])
+	assert.NotEqual(t, firstMoves[1], firstMoves[2])
+	assert.NotEqual(t, firstMoves[1], firstMoves[3])
+	assert.NotEqual(t, firstMoves[2], firstMoves[3])
+}
+
+// TestGoMultiPVFewMoves tests multi PV with less legal moves than PV lines.
+func TestGoMultiPVFewMoves(t *testing.T) {
+	b := Must(board.FromFEN("7k/8/8/8/8/8/6q1/K7 w - - 0 1"))
+	s := search.New(1 * transp.MegaBytes)
+
+	output := &bytes.Buffer{}
+	_, move, _ := s.Go(b, search.WithDepth(4), search.WithMultiPV(3), search.WithOutput(output))
+
+	assert.Equal(t, "a1b1", move.String())
+	assert.NotContains(t, output.String(), "multipv")
+}
+
+func TestGoSingleMove(t *testing.T) {
+	b := Must(board.FromFEN("7k/8/8/8/8/8/6q1/K7 w - - 0 1"))
+	s := search.New(1 * transp.MegaBytes)
+
+	output := &bytes.Buffer{}
+	_, move, _ := s.Go(b, search.WithSoftTime(60_000), search.WithOutput(output))
+
+	assert.Equal(t, "a1b1", move.String())
+	assert.NotContains(t, output.String(), "info depth 2 ")
+
+	// not in untimed searches
+	output.Reset()
+	_, move, _ = s.Go(b, search.WithDepth(3), search.WithOutput(output))
+
+	assert.Equal(t, "a1b1", move.String())
+	assert.Contains(t, output.String(), "info depth 3 ")
+}
+
+func TestRootMoveStats(t *testing.T) {
+	b := board.StartPos()
+	s := search.New(1 * transp.MegaBytes)
+	counters := search.Counters{}
+
+	score, best, _ := s.Go(b, search.WithDepth(5), search.WithOutput(nil), search.WithCounters(&counters))
+
+	stats := s.RootMoves()
+	assert.Len(t, stats, 20)
+
+	// the moves failing low in a reduced search keep the depth and the score
+	// of their last full depth search
+	nodes := 0
+	for _, stat := range stats {
+		assert.Positive(t, stat.Depth, stat.Move.String())
+		assert.LessOrEqual(t, stat.Depth, Depth(5), stat.Move.String())
+		assert.Positive(t, stat.Nodes, stat.Move.String())
+		nodes += stat.Nodes
+
+		switch {
+		case stat.Move == best:
+			assert.Equal(t, Depth(5), stat.Depth)
+			assert.Equal(t, score, stat.Score)
+		case stat.Depth == 5:
+			assert.LessOrEqual(t, stat.Score, score)
+		}
+	}
+	assert.Less(t, nodes, counters.Nodes)
+}
+
+// TestGoRootMoves tests the root move restriction.
+func TestGoRootMoves(t *testing.T) {
+	tests := []struct {
+		name      string
+		fen       string
+		rootMoves []move.Move
+		want      []move.Move
+	}{
+		{
+			name:      "restricted to two moves",
+			fen:       "r3k2r/2pb1ppp/2pp1q2/p7/1nP1B3/1P2P3/P2N1PPP/R2QK2R w KQkq a6 0 14",
+			rootMoves: []move.Move{move.From(A2) | move.To(A3), move.From(H2) | move.To(H3)},
+			want:      []move.Move{move.From(A2) | move.To(A3), move.From(H2) | move.To(H3)},
+		},
+		{
+			name:      "illegal moves are ignored",
+			fen:       "7k/8/8/8/8/8/6q1/K7 w - - 0 1",
+			rootMoves: []move.Move{move.From(A1) | move.To(A2), move.From(A1) | move.To(B1)},
+			want:      []move.Move{move.From(A1) | move.To(B1)},
+		},
+		{
+			name:      "no legal moves allowed",
+			fen:       "7k/8/8/8/8/8/6q1/K7 w - - 0 1",
+			rootMoves: []move.Move{move.From(A1) | move.To(A2)},
+			want:      []move.Move{move.From(A1) | move.To(B1)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := Must(board.FromFEN(tt.fen))
+			s := search.New(1 * transp.MegaBytes)
+
+			_, move, _ := s.Go(b, search.WithDepth(6), search.WithRootMoves(tt.rootMoves), search.WithOutput(nil))
+			assert.Contains(t, tt.want, move)
+
+			// hard abort before the first depth finished
+			_, move, _ = s.Go(b, search.WithNodes(0), search.WithRootMoves(tt.rootMoves), search.WithOutput(nil))
+			assert.Contains(t, tt.want, move)
+		})
+	}
+}
+
+// TestGoPonderNodes tests that the node limits count from the ponder hit.
+func TestGoPonderNodes(t *testing.T) {
+	b := Must(board.FromFEN(StartPosFEN))
+	s := search.New(1 * transp.MegaBytes)
+
+	ponderHit := make(chan time.Time, 1)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		ponderHit <- time.Now()
+	}()
+
+	counters := search.Counters{}
+	_, move, _ := s.Go(b, search.WithPonderHit(ponderHit), search.WithNodes(1000), search.WithSoftNodes(250),
+		search.WithCounters(&counters), search.WithOutput(nil))
+
+	// the pondering went past the node limit, and the search stopped by itself
+	// after the ponder hit
+	assert.Greater(t, counters.Nodes, 1000)
+	assert.True(t, b.IsPseudoLegal(move), "not pseudo legal %s", move)
+}
+
+// TestGoMate tests the mate search.
+func TestGoMate(t *testing.T) {
+	tests := []struct {
+		name       string
+		fen        string
+		mate       int
+		wantMove   move.Move
+		wantOutput string
+	}{
+		{
+			name:     "mate in 1",
+			fen:      "k7/8/1K6/8/8/8/8/7R w - - 0 1",
+			mate:     1,
+			wantMove: move.From(H1) | move.To(H8),
+		},
+		{
+			// the search is decided at depth 0
+			name: "mated",
+			fen:  "rnb1kbnr/pppp1ppp/8/4p3/6Pq/5P2/PPPPP2P/RNBQKBNR w KQkq - 1 3",
+			mate: 2,
+		},
+		{
+			name:       "no mate in 1",
+			fen:        StartPosFEN,
+			mate:       1,
+			wantOutput: "info string no mate in 1 found",
+		},
+		{
+			name:       "no mate in 2",
+			fen:        StartPosFEN,
+			mate:       2,
+			wantOutput: "info string no mate in 2 found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := Must(board.FromFEN(tt.fen))
+			s := search.New(1 * transp.MegaBytes)
+
+			output := &bytes.Buffer{}
+			_, move, _ := s.Go(b, search.WithMate(tt.mate), search.WithOutput(output))
+
+			// without other limits the mate search is depth limited to 2 *
+			// mate plies plus a margin of 4
+			assert.NotContains(t, output.String(), fmt.Sprintf("info depth %d ", 2*tt.mate+5))
+
+			if tt.wantMove != 0 {
+				assert.Equal(t, tt.wantMove, move, "want %s got %s", tt.wantMove, move)
+			}
+			if tt.wantOutput != "" {
+				assert.Contains(t, output.String(), tt.wantOutput)
+				assert.Contains(t, output.String(), fmt.Sprintf("info depth %d ", 2*tt.mate+4))
+			} else {
+				assert.NotContains(t, output.String(), "no mate")
+				// the search stopped before reaching the depth limit.
+				assert.NotContains(t, output.String(), fmt.Sprintf("info depth %d ", 2*tt.mate+4))
+			}
+		})
+	}
+}
+
+// TestGoInfo tests the info line fields.
+func TestGoInfo(t *testing.T) {
+	b := Must(board.FromFEN(StartPosFEN))
+	s := search.New(1 * transp.MegaBytes)
+
+	output := &bytes.Buffer{}
+	s.Go(b, search.WithDepth(10), search.WithCurrMoveTime(1), search.WithWDL(&wdl.Default),
+		search.WithOutput(output))
+
+	pvLine := regexp.MustCompile(`^info depth (\d+) seldepth \d+ score (cp|mate) -?\d+ wdl \d+ \d+ \d+` +
+		`( lowerbound| upperbound)? ` +
+		`nodes \d+ nps \d+ time \d+ hashfull \d+ pv( [a-h][1-8][a-h][1-8][nbrq]?)*$`)
+	currMove := regexp.MustCompile(`^info depth (\d+) currmove [a-h][1-8][a-h][1-8][nbrq]? currmovenumber \d+$`)
+
+	pvLines, currMoves := 0, 0
+	currDepth := ""
+	for line := range strings.Lines(output.String()) {
+		line = strings.TrimSpace(line)
+		switch {
+		case pvLine.MatchString(line):
+			pvLines++
+			// currmove reports the depth of the iteration it belongs to
+			depth := pvLine.FindStringSubmatch(line)[1]
+			if currDepth != "" {
+				assert.Equal(t, depth, currDepth, line)
+			}
+			currDepth = ""
+		case currMove.MatchString(line):
+			currMoves++
+			currDepth = currMove.FindStringSubmatch(line)[1]
+		default:
+			assert.Fail(t, "unexpected info line", line)
+		}
+	}
+
+	assert.Positive(t, pvLines)
+	assert.Positive(t, currMoves)
+}
+
+// TestGoInfoHandler tests the structured search progress reports.
+func TestGoInfoHandler(t *testing.T) {
+	b := Must(board.FromFEN(StartPosFEN))
+	s := search.New(1 * transp.MegaBytes)
+
+	infos := []search.Info{}
+	output := &bytes.Buffer{}
+	score, move, _ := s.Go(b, search.WithDepth(5), search.WithWDL(&wdl.Default), search.WithOutput(output),
+		search.WithInfoHandler(func(info search.Info) { infos = append(infos, info) }))
+
+	assert.NotContains(t, output.String(), "info depth")
+	assert.NotEmpty(t, infos)
+
+	nodes := 0
+	for _, info := range infos {
+		assert.GreaterOrEqual(t, info.Nodes, nodes)
+		assert.Zero(t, info.MultiPV)
+		assert.NotNil(t, info.WDL)
+		nodes = info.Nodes
+	}
+
+	last := infos[len(infos)-1]
+	assert.Equal(t, Depth(5), last.Depth)
+	assert.Equal(t, transp.Exact, last.Bound)
+	assert.Equal(t, score, last.Score)
+	assert.Equal(t, move, last.PV[0])
+	assert.GreaterOrEqual(t, last.SelDepth, last.Depth)
+}
+
+// TestGoInfoHandlerKinds tests that the current move and the mate search
+// reports go to the info handler too, and nothing to the output.
+func TestGoInfoHandlerKinds(t *testing.T) {
+	b := Must(board.FromFEN(StartPosFEN))
+	s := search.New(1 * transp.MegaBytes)
+
+	kinds := map[search.Kind]int{}
+	mate := 0
+	output := &bytes.Buffer{}
+	s.Go(b, search.WithMate(2), search.WithCurrMoveTime(1), search.WithOutput(output),
+		search.WithInfoHandler(func(info search.Info) {
+			kinds[info.Kind]++
+			if info.Kind == search.NoMateInfo {
+				mate = info.Mate
+			}
+		}))
+
+	assert.Empty(t, output.String())
+	assert.Positive(t, kinds[search.PVInfo])
+	assert.Positive(t, kinds[search.CurrMoveInfo])
+	assert.Equal(t, 1, kinds[search.NoMateInfo])
+	assert.Equal(t, 2, mate)
+}
+
+// TestUCIInfoKinds tests the uci info lines of the reports other than the PV
+// lines.
+func TestUCIInfoKinds(t *testing.T) {
+	tests := []struct {
+		name string
+		info search.Info
+		want string
+	}{
+		{"currmove", search.Info{Kind: search.CurrMoveInfo, Depth: 7, CurrMove: move.From(E2) | move.To(E4), CurrMoveNumber: 3},
+			"info depth 7 currmove e2e4 currmovenumber 3\n"},
+		{"abort", search.Info{Kind: search.AbortInfo, Depth: 9, Nodes: 1234}, "info depth 9 nodes 1234\n"},
+		{"no mate", search.Info{Kind: search.NoMateInfo, Mate: 4}, "info string no mate in 4 found\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := &bytes.Buffer{}
+			search.UCIInfo(output, false)(tt.info)
+
+			assert.Equal(t, tt.want, output.String())
+		})
+	}
+}
+
+// TestUCIInfoChess960 tests the castling notation of the info lines.
+func TestUCIInfoChess960(t *testing.T) {
+	info := search.Info{Depth: 1, PV: []move.Move{move.Castling(E1, H1), move.From(E8) | move.To(D8)}}
+
+	for chess960, want := range map[bool]string{false: " pv e1g1 e8d8\n", true: " pv e1h1 e8d8\n"} {
+		output := &bytes.Buffer{}
+		search.UCIInfo(output, chess960)(info)
+
+		assert.True(t, strings.HasSuffix(output.String(), want), output.String())
+	}
+}
+
+// TestGoContempt tests the draw scores.
+func TestGoContempt(t *testing.T) {
+	tests := []struct {
+		name     string
+		fen      string
+		contempt Score
+		dynamic  bool
+		want     Score
+	}{
+		{"no contempt", "8/8/4k3/8/8/2KN4/8/8 w - - 0 1", 0, false, 0},
+		{"contempt", "8/8/4k3/8/8/2KN4/8/8 w - - 0 1", 50, false, -50},
+		{"negative contempt", "8/8/4k3/8/8/2KN4/8/8 w - - 0 1", -50, false, 50},
+		{"dynamic contempt ahead", "8/8/4k3/8/8/2KN4/8/8 w - - 0 1", 50, true, -80},
+		{"dynamic contempt behind", "8/8/4k3/8/8/2KN4/8/8 b - - 0 1", 50, true, -20},
+		{"stalemate", "7k/5Q2/6K1/8/8/8/8/8 b - - 0 1", 50, false, -50},
+		{"fifty move rule", "7k/8/8/8/8/8/8/R5K1 w - - 99 80", 50, false, -50},
+	}
+
+	// the same tt is used for all searches, the tt entries of different draw
+	// scores must not mix
+	s := search.New(1 * transp.MegaBytes)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := Must(board.FromFEN(tt.fen))
+
+			score, _, _ := s.Go(b, search.WithDepth(4), search.WithContempt(tt.contempt, tt.dynamic),
+				search.WithOutput(nil))
+
+			assert.Equal(t, tt.want, score)
+		})
+	}
+}
+
+// BenchmarkSearch searches a set of middle and end game positions to a fixed
+// depth, and reports the search speed in nodes per second.
+func BenchmarkSearch(bm *testing.B) {
+	fens := []string{
+		"r3k2r/2pb1ppp/2pp1q2/p7/1nP1B3/1P2P3/P2N1PPP/R2QK2R w KQkq a6 0 14",
+		"4rrk1/2p1b1p1/p1p3q1/4p3/2P2n1p/1P1NR2P/PB3PP1/3R1QK1 b - - 2 24",
+		"6k1/1R3p2/6p1/2Bp3p/3P2q1/P7/1P2rQ1K/5R2 b - - 4 44",
+		"8/8/1p2k1p1/3p3p/1p1P1P1P/1P2PK2/8/8 w - - 3 54",
+	}
+
+	s := search.New(16 * transp.MegaBytes)
+	nodes := 0
+
+	for bm.Loop() {
+		for _, fen := range fens {
+			b := Must(board.FromFEN(fen))
+			counters := search.Counters{}
+
+			s.Go(b, search.WithDepth(12), search.WithCounters(&counters), search.WithOutput(nil))
+			nodes += counters.Nodes
+			s.Clear()
+		}
+	}
+
+	bm.ReportMetric(float64(nodes)/bm.Elapsed().Seconds(), "nodes/s")
+}
@@ -0,0 +1,145 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/paulsonkoly/chess-3/board"
+	"github.com/paulsonkoly/chess-3/move"
+	"github.com/paulsonkoly/chess-3/params"
+	"github.com/paulsonkoly/chess-3/transp"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/paulsonkoly/chess-3/chess"
+)
+
+// probeEval is an evaluator with the same evaluation for every position,
+// recording the moves made from the search node and the double extension
+// counts of the search.
+type probeEval struct {
+	s            *Search
+	score        Score
+	depth        int
+	moves        []move.Move // moves are the moves made from the search node.
+	maxDoubleExt uint8       // maxDoubleExt is the largest double extension count seen.
+}
+
+func (p *probeEval) Evaluate(*board.Board) Score {
+	for _, cnt := range p.s.doubleExt {
+		p.maxDoubleExt = max(p.maxDoubleExt, cnt)
+	}
+	return p.score
+}
+
+func (p *probeEval) Refresh(*board.Board) {}
+
+func (p *probeEval) MakeMove(_ *board.Board, m move.Move) {
+	if p.depth == 0 {
+		p.moves = append(p.moves, m)
+	}
+	p.depth++
+}
+
+func (p *probeEval) UndoMove() { p.depth-- }
+func (p *probeEval) Clear()    {}
+
+// nodeSearch prepares s for searching b as an inner node at ply 1 of an
+// iteration of depth 10, and returns the search options.
+func nodeSearch(s *Search, b *board.Board, score Score) (*probeEval, *Options) {
+	e := &probeEval{s: s, score: score}
+	s.SetEvaluator(func() Evaluator { return e })
+	s.refresh()
+	s.eval.Refresh(b)
+	s.rootDepth = 10
+
+	return e, &Options{Depth: MaxPlies, Nodes: -1, SoftNodes: -1, Counters: &Counters{}}
+}
+
+// the side to move has only pawns, so null move pruning is off
+const pawnsFEN = "4k3/pppp4/8/8/8/8/PPPP4/4K3 w - - 0 1"
+
+// TestExcludedMoveSearch tests the search excluding the singular move.
+func TestExcludedMoveSearch(t *testing.T) {
+	b := Must(board.FromFEN(pawnsFEN))
+	excluded := move.From(D2) | move.To(D4)
+
+	t.Run("skips the excluded move", func(t *testing.T) {
+		s := New(1 * transp.MegaBytes)
+		e, opts := nodeSearch(s, b, 0)
+
+		// a full window so that all the other moves are searched
+		s.singular[1] = excluded
+		s.alphaBeta(b, -Inf-1, Inf+1, 1, 1, PVNode, opts)
+
+		assert.NotContains(t, e.moves, excluded)
+		assert.Len(t, e.moves, 11)
+	})
+
+	t.Run("tt probe", func(t *testing.T) {
+		s := New(1 * transp.MegaBytes)
+		_, opts := nodeSearch(s, b, 0)
+
+		s.tt.Insert(s.ttKey(b), s.gen, 20, 1, excluded, 777, Inv, false, transp.Exact)
+
+		s.singular[1] = excluded
+		value := s.alphaBeta(b, -1, 0, 3, 1, CutNode, opts)
+
+		assert.NotEqual(t, Score(777), value)
+	})
+
+	t.Run("tt store", func(t *testing.T) {
+		s := New(1 * transp.MegaBytes)
+		_, opts := nodeSearch(s, b, 0)
+
+		s.singular[1] = excluded
+		s.alphaBeta(b, -1, 0, 3, 1, CutNode, opts)
+
+		_, ok := s.tt.LookUp(s.ttKey(b))
+		assert.False(t, ok)
+	})
+}
+
+// TestMultiCut tests that the node is pruned with sBeta if the moves other
+// than the hash move also fail high.
+func TestMultiCut(t *testing.T) {
+	b := Must(board.FromFEN(pawnsFEN))
+	s := New(1 * transp.MegaBytes)
+	_, opts := nodeSearch(s, b, -50)
+
+	d := Depth(8)
+	sBeta := Score(-500)
+	ttValue := sBeta + Score(d)*Score(params.SEMarginFactor)
+	s.tt.Insert(s.ttKey(b), s.gen, d-1, 1, move.From(D2)|move.To(D4), ttValue, Inv, false, transp.LowerBound)
+
+	value := s.alphaBeta(b, sBeta-1, sBeta, d, 1, CutNode, opts)
+
+	assert.Equal(t, sBeta, value)
+}
+
+// TestDoubleExtensionCap tests that the double extensions are limited to
+// maxDoubleExts along a line.
+func TestDoubleExtensionCap(t *testing.T) {
+	b := Must(board.FromFEN(pawnsFEN))
+	d := Depth(8)
+
+	for _, tt := range []struct {
+		name  string
+		prior uint8
+		want  uint8
+	}{
+		{"below the cap", maxDoubleExts - 1, maxDoubleExts},
+		{"at the cap", maxDoubleExts, maxDoubleExts},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(1 * transp.MegaBytes)
+			e, opts := nodeSearch(s, b, 0)
+
+			// the other moves fail low by far
+			s.tt.Insert(s.ttKey(b), s.gen, d-1, 1, move.From(D2)|move.To(D4), 500+Score(d)*Score(params.SEMarginFactor), Inv, false, transp.LowerBound)
+			s.doubleExt[1] = tt.prior
+
+			s.alphaBeta(b, -1, 0, d, 1, CutNode, opts)
+
+			assert.Equal(t, tt.want, e.maxDoubleExt)
+		})
+	}
+}
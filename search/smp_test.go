@@ -0,0 +1,29 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/paulsonkoly/chess-3/chess"
+)
+
+// TestSkipDepth tests the iterative deepening schedule of the threads.
+func TestSkipDepth(t *testing.T) {
+	searched := func(helperIx int) []Depth {
+		s := &Search{helperIx: helperIx}
+		depths := []Depth{}
+		for d := range Depth(9) {
+			if !s.skipDepth(d) {
+				depths = append(depths, d)
+			}
+		}
+		return depths
+	}
+
+	assert.Equal(t, []Depth{0, 1, 2, 3, 4, 5, 6, 7, 8}, searched(0))
+	assert.Equal(t, []Depth{0, 1, 3, 5, 7}, searched(1))
+	assert.Equal(t, []Depth{0, 1, 4, 5, 8}, searched(2))
+	assert.Equal(t, []Depth{0, 3, 4, 7, 8}, searched(3))
+	assert.Equal(t, []Depth{0, 2, 4, 6, 8}, searched(20))
+}
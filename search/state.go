@@ -2,13 +2,18 @@ package search
 
 import (
 	"io"
+	"math/rand/v2"
+	"sync/atomic"
 	"time"
 
-	"github.com/paulsonkoly/chess-3/eval"
+	"github.com/paulsonkoly/chess-3/board"
 	"github.com/paulsonkoly/chess-3/heur"
 	"github.com/paulsonkoly/chess-3/move"
+	"github.com/paulsonkoly/chess-3/nnue"
 	"github.com/paulsonkoly/chess-3/stack"
+	"github.com/paulsonkoly/chess-3/tablebase"
 	"github.com/paulsonkoly/chess-3/transp"
+	"github.com/paulsonkoly/chess-3/wdl"
 
 	. "github.com/paulsonkoly/chess-3/chess"
 )
@@ -16,36 +21,156 @@ import (
 // Search contains the permanent stores such as tt that can be re-used between
 // searches.
 type Search struct {
-	tt      *transp.Table
-	ranker  heur.MoveRanker
-	ms      *move.Store
-	hstack  *stack.Stack[heur.StackMove]
-	pv      *pv
-	eval    *eval.Eval[Score]
-	gen     transp.Gen
-	aborted bool
-}
-
-// New creates a new Search object.
-func New(size int) *Search {
+	tt        *transp.Table
+	ranker    heur.MoveRanker
+	corr      *heur.Correction // corr is the static evaluation correction history.
+	ms        *move.Store
+	hstack    *stack.Stack[heur.StackMove]
+	pv        *pv
+	eval      Evaluator
+	newEval   func() Evaluator // newEval creates the evaluator of each thread.
+	tb        *tablebase.Tablebase
+	excluded  []move.Move         // excluded are the root moves not to be searched.
+	singular  [MaxPlies]move.Move // singular are the moves excluded by the singular extension search by ply.
+	doubleExt [MaxPlies]uint8     // doubleExt is the number of double extensions on the path to the ply.
+	rootStats []RootMove          // rootStats are the statistics of the root moves in the current search.
+	lines     []pvLine            // lines are the PV lines of the last search.
+	helpers   []*Search           // helpers are the lazy SMP helper searchers sharing tt.
+	helperIx  int                 // helperIx is the index of a helper searcher from 1, 0 for the main thread.
+	nodes     atomic.Int64        // nodes is the node count published by a helper searcher.
+	total     *atomic.Int64       // total is the node count published by all threads, shared with the helpers.
+	published int                 // published is the node count added to total by this thread.
+	othersCnt int                 // othersCnt is the node count of the other threads at the last publish.
+	start     time.Time           // start is the start time of the search.
+	gen       transp.Gen
+	ttMask    board.Hash // ttMask separates the tt entries of different draw scores.
+	contempt  Score      // contempt is the draw penalty of us.
+	us        Color      // us is the root side to move.
+	selDepth  Depth      // selDepth is the maximal ply reached in the current depth.
+	rootDepth Depth      // rootDepth is the depth of the current iteration.
+	aborted   bool
+	tbProbe   bool // tbProbe enables tablebase probing in the search tree.
+}
+
+type newOpts struct {
+	newEval func() Evaluator
+}
+
+// NewOption is an option for creating a new Search.
+type NewOption func(*newOpts)
+
+// WithEvaluator makes the search evaluate with the evaluators created by
+// newEval, one for each thread. The default is the embedded network if there
+// is one, and the hand crafted evaluation otherwise.
+func WithEvaluator(newEval func() Evaluator) NewOption {
+	return func(o *newOpts) { o.newEval = newEval }
+}
+
+// New creates a new Search object with a transposition table of size bytes.
+func New(size int, opts ...NewOption) *Search {
+	actual := newOpts{newEval: defaultEvaluator(nnue.Default())}
+	for _, opt := range opts {
+		opt(&actual)
+	}
+
+	return newSearch(transp.New(size), actual.newEval)
+}
+
+// newSearch creates a new Search object using the transposition table tt and
+// the evaluator created by newEval.
+func newSearch(tt *transp.Table, newEval func() Evaluator) *Search {
 	return &Search{
-		tt:     transp.New(size),
-		ms:     move.NewStore(),
-		ranker: heur.NewMoveRanker(),
-		hstack: stack.New[heur.StackMove](),
-		eval:   eval.New[Score](),
-		pv:     newPV(),
+		tt:      tt,
+		ms:      move.NewStore(),
+		ranker:  heur.NewMoveRanker(),
+		corr:    heur.NewCorrection(),
+		hstack:  stack.New[heur.StackMove](),
+		eval:    newEval(),
+		newEval: newEval,
+		pv:      newPV(),
+		total:   &atomic.Int64{},
 	}
 }
 
 // ResizeTT resizes the current tt to new size potentially re-allocating it.
 func (s *Search) ResizeTT(size int) { s.tt.Resize(size) }
 
+// SaveTT writes the transposition table and the search generation to w.
+func (s *Search) SaveTT(w io.Writer) error { return s.tt.Save(w, s.gen) }
+
+// LoadTT reads the transposition table and the search generation saved by
+// SaveTT from r. The transposition table size has to match the saved size. On
+// error the transposition table is cleared. The static evaluations are not
+// kept, they might come from a different evaluator.
+func (s *Search) LoadTT(r io.Reader) error {
+	gen, err := s.tt.Load(r)
+	if err != nil {
+		s.tt.Clear()
+		return err
+	}
+	s.tt.ClearEvals()
+	s.gen = gen
+	return nil
+}
+
+// SetThreads sets the number of search threads to n, counting the main
+// thread. The n-1 helper threads share the transposition table with the main
+// thread, but they have their own move ordering heuristics, move stores and
+// evaluation caches.
+func (s *Search) SetThreads(n int) {
+	n = max(n, 1)
+
+	for len(s.helpers) > n-1 {
+		s.helpers[len(s.helpers)-1] = nil
+		s.helpers = s.helpers[:len(s.helpers)-1]
+	}
+
+	for len(s.helpers) < n-1 {
+		h := newSearch(s.tt, s.newEval)
+		h.tb = s.tb
+		h.total = s.total
+		h.helperIx = len(s.helpers) + 1
+		s.helpers = append(s.helpers, h)
+	}
+}
+
+// SetTablebase sets the Syzygy tablebase used by the search, shared by all
+// threads. nil disables tablebase probing.
+func (s *Search) SetTablebase(tb *tablebase.Tablebase) {
+	s.tb = tb
+	for _, h := range s.helpers {
+		h.tb = tb
+	}
+}
+
+// SetEvaluator replaces the evaluators of all threads with the ones created by
+// newEval. The static evaluations in the transposition table are dropped.
+func (s *Search) SetEvaluator(newEval func() Evaluator) {
+	s.tt.ClearEvals()
+	s.newEval = newEval
+	s.eval = s.newEval()
+	for _, h := range s.helpers {
+		h.newEval = s.newEval
+		h.eval = s.newEval()
+	}
+}
+
+// helperNodes is the sum of the node counts published by the helper threads.
+func (s *Search) helperNodes() int {
+	sum := 0
+	for _, h := range s.helpers {
+		sum += int(h.nodes.Load())
+	}
+	return sum
+}
+
 // refresh prepares the state for a new search.
 func (s *Search) refresh() {
 	s.ms.Clear()
 	s.hstack.Reset()
 	s.aborted = false
+	s.published = 0
+	s.othersCnt = 0
 }
 
 // Clear clears the internal stores in the Search object. Should be called between games only.
@@ -53,7 +178,15 @@ func (s *Search) Clear() {
 	s.gen = 0
 	s.tt.Clear()
 	s.ranker.Clear()
+	s.corr.Clear()
 	s.eval.Clear()
+
+	for _, h := range s.helpers {
+		h.gen = 0
+		h.ranker.Clear()
+		h.corr.Clear()
+		h.eval.Clear()
+	}
 }
 
 // Options structure contains all search options. The functional options
@@ -73,15 +206,55 @@ type Options struct {
 
 	Stop   <-chan struct{} // Stop channel interrupts the search.
 	Output io.Writer       // Info line output. nil for no output.
+	// InfoHandler receives the search progress. nil for the uci info lines
+	// written to Output.
+	InfoHandler func(Info)
 	// Ponderhit channel signals a ponderhit. The sent time should be the time the ponderhit happened.
 	PonderHit <-chan time.Time
+
+	MultiPV   int         // MultiPV is the number of principal variations to report.
+	RootMoves []move.Move // RootMoves restricts the search to these root moves.
+	Mate      int         // Mate stops the search when a mate in at most Mate moves is found.
+	// CurrMoveTime is the time in milliseconds after which the searched root
+	// moves are reported.
+	CurrMoveTime int64
+	// WDL is the model of the win, draw and loss probabilities reported with
+	// the scores. nil for no reporting.
+	WDL *wdl.Model
+	// Temperature picks the returned move among the MultiPV lines at random,
+	// favouring the better scores. The score differences are divided by
+	// Temperature. 0 for the best move.
+	Temperature float64
+	// Rand is the random source of Temperature. nil for the global source.
+	Rand *rand.Rand
+	// Contempt is the penalty of a draw for the root side to move.
+	Contempt Score
+	// DynamicContempt adjusts Contempt by the material balance at the root.
+	DynamicContempt bool
+	// Chess960 prints castling moves in the Chess960 notation.
+	Chess960 bool
+	// FixedTime uses all of SoftTime, the soft time limit is not scaled and a
+	// single legal move is not played instantly. Set for go movetime.
+	FixedTime bool
 }
 
 // softAbort determines if elapsed times or nodes count justify a soft abort;
-// that is aborting after a full completion of a given depth. Limits are
-// ignored while pondering.
-func (o *Options) softAbort(elapsed int64, nodes int) bool {
-	return o.PonderHit == nil && ((o.SoftTime > 0 && elapsed > o.SoftTime) || (o.SoftNodes > 0 && nodes > o.SoftNodes))
+// that is aborting after a full completion of a given depth. The soft time
+// limit is multiplied by scale. Limits are ignored while pondering.
+func (o *Options) softAbort(elapsed int64, nodes int, scale float64) bool {
+	return o.PonderHit == nil &&
+		((o.SoftTime > 0 && elapsed > int64(float64(o.SoftTime)*scale)) || (o.SoftNodes > 0 && nodes > o.SoftNodes))
+}
+
+// ponderHit makes the node limits count from the ponder hit, nodes is the node
+// count of the pondering.
+func (o *Options) ponderHit(nodes int) {
+	if o.Nodes != -1 {
+		o.Nodes += nodes
+	}
+	if o.SoftNodes > 0 {
+		o.SoftNodes += nodes
+	}
 }
 
 // Option modifies how a search runs, this should be set per search.
@@ -97,7 +270,7 @@ func WithStop(stop <-chan struct{}) Option {
 
 // WithPonderHit runs the search with pondering. A signal on this channel
 // indicates that the search should transition to normal search from a ponder
-// search.
+// search. The time and node limits count from the ponder hit.
 func WithPonderHit(ponderhit <-chan time.Time) Option {
 	return func(o *Options) {
 		o.PonderHit = ponderhit
@@ -118,6 +291,15 @@ func WithOutput(out io.Writer) Option {
 	}
 }
 
+// WithInfoHandler runs a search reporting its progress to handler instead of
+// writing the uci info lines to the output. The search writes nothing to the
+// output then.
+func WithInfoHandler(handler func(Info)) Option {
+	return func(o *Options) {
+		o.InfoHandler = handler
+	}
+}
+
 // WithCounters instructs the search to collect statistics in counters.
 func WithCounters(counters *Counters) Option {
 	return func(o *Options) {
@@ -133,30 +315,119 @@ func WithSoftTime(st int64) Option {
 	}
 }
 
+// WithFixedTime makes the soft time limit a fixed time to search. Useful for
+// "go movetime" uci command.
+func WithFixedTime(fixed bool) Option {
+	return func(o *Options) { o.FixedTime = fixed }
+}
+
 // WithDepth runs the search with depth limit. Useful for "go depth" uci command.
 func WithDepth(d Depth) Option {
 	return func(o *Options) { o.Depth = d }
 }
 
 // WithNodes runs the search with hard node count limit. Useful for "go nodes"
-// uci command.
+// uci command. The limit applies to the total node count of all threads, each
+// thread publishes its node count every 1024 nodes.
 func WithNodes(nodes int) Option {
 	return func(o *Options) { o.Nodes = nodes }
 }
 
-// WithSoftNodes sets a soft node count limit. When exceeded after completing
-// a depth, the search will stop. <= 0 for no limit.
+// WithSoftNodes sets a soft node count limit. When the total node count of all
+// threads exceeds it after completing a depth, the search will stop. <= 0 for
+// no limit.
 func WithSoftNodes(nodes int) Option {
 	return func(o *Options) { o.SoftNodes = nodes }
 }
 
+// WithMultiPV runs the search reporting the best n principal variations. Each
+// depth is searched n times, each time excluding the root moves of the
+// already reported lines, thus this is meant for analysis only. The returned
+// move is the best move of the first line.
+func WithMultiPV(n int) Option {
+	return func(o *Options) { o.MultiPV = n }
+}
+
+// WithRootMoves restricts the search to the root moves in moves. Useful for
+// "go searchmoves" uci command. Moves that are not legal are ignored, if none
+// of the moves is legal the search is not restricted.
+func WithRootMoves(moves []move.Move) Option {
+	return func(o *Options) { o.RootMoves = moves }
+}
+
+// WithMate runs the search until it finds a mate in at most n moves. Useful
+// for "go mate" uci command. The search still obeys the other limits, and it
+// does not go deeper than 2n plies plus a small margin. It reports if no such
+// mate was found. <= 0 for no mate search.
+func WithMate(n int) Option {
+	return func(o *Options) { o.Mate = n }
+}
+
+// WithCurrMoveTime reports the root move being searched with its move number
+// once the search has been running for ms milliseconds. <= 0 for no reporting.
+func WithCurrMoveTime(ms int64) Option {
+	return func(o *Options) { o.CurrMoveTime = ms }
+}
+
+// WithWDL reports the win, draw and loss probabilities of the model m with the
+// scores. Useful for UCI_ShowWDL uci option. nil for no reporting.
+func WithWDL(m *wdl.Model) Option {
+	return func(o *Options) { o.WDL = m }
+}
+
+// WithTemperature returns a random move among the MultiPV lines instead of the
+// best move, picking a line with the probability proportional to exp((score -
+// best) / t). r is the random source, nil for the global source. <= 0 for the
+// best move. It is meant for weakening the engine.
+func WithTemperature(t float64, r *rand.Rand) Option {
+	return func(o *Options) {
+		o.Temperature = t
+		o.Rand = r
+	}
+}
+
+// WithChess960 prints the castling moves of the uci output in the Chess960
+// notation, the king capturing its own rook.
+func WithChess960(chess960 bool) Option {
+	return func(o *Options) { o.Chess960 = chess960 }
+}
+
+// WithContempt sets the draw score to -contempt for the root side to move,
+// and contempt for the opponent. With dynamic, contempt grows with the
+// material advantage of the root side to move.
+func WithContempt(contempt Score, dynamic bool) Option {
+	return func(o *Options) {
+		o.Contempt = contempt
+		o.DynamicContempt = dynamic
+	}
+}
+
+// mateDepthMargin is the number of plies a mate search goes beyond 2 * Mate.
+const mateDepthMargin = 4
+
+// maxDepth is the depth limit of the iterative deepening.
+func (o *Options) maxDepth() Depth {
+	if o.Mate > 0 {
+		return min(o.Depth, Depth(min(2*o.Mate+mateDepthMargin, MaxPlies-1)))
+	}
+	return o.Depth
+}
+
+// mateFound determines whether score decides the mate search, either a mate
+// in at most Mate moves or the side to move already mated.
+func (o *Options) mateFound(score Score) bool {
+	mate, ok := score.MateMoves()
+	return o.Mate > 0 && ok && 0 <= mate && mate <= o.Mate
+}
+
 // Counters are various search counters.
 type Counters struct {
-	Nodes   int   // Nodes is the total node count.
+	Nodes   int   // Nodes is the total node count, including the helper threads.
 	ABNodes int   // ABNodes is the total node count limited to alpha-beta not counting leafs (d==0).
 	Time    int64 // Time is the search time in milliseconds.
 	// Moves is the total explored (searched) move count. Moves / ABNodes ~ avg. branching factor
 	// Only counted if debug is set.
 	Moves    int
 	FirstCut int // FirstCut counts how many times AB searched exactly 1 move. Only counted if debug is set.
+	TBHits   int // TBHits counts the successful tablebase probes of the main thread.
 }
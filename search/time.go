@@ -0,0 +1,57 @@
+package search
+
+import (
+	"github.com/paulsonkoly/chess-3/move"
+
+	. "github.com/paulsonkoly/chess-3/chess"
+)
+
+// stabilityScale is the soft time limit multiplier by the number of
+// consecutive iterations the best move didn't change.
+var stabilityScale = [...]float64{2.0, 1.5, 1.2, 1.0, 0.9, 0.8}
+
+const (
+	// scoreDropRange is the score drop in centipawns doubling the soft time
+	// limit.
+	scoreDropRange = 100
+	// minTimeScale bounds the soft time limit multiplier from below.
+	minTimeScale = 0.3
+)
+
+// MaxTimeScale bounds the soft time limit multiplier from above. The caller
+// sets the hard limit somewhat higher than MaxTimeScale times the soft limit,
+// and caps the soft limit so that scaled up it stays within the remaining
+// time.
+const MaxTimeScale = 3.0
+
+// timeManager scales the soft time limit after each iteration by the
+// stability of the best move, the fraction of the nodes spent on the best
+// move and the drop of the score since the previous iteration.
+type timeManager struct {
+	best   move.Move // best is the best move of the previous iteration.
+	score  Score     // score is the score of the previous iteration.
+	stable int       // stable is the number of iterations best didn't change.
+}
+
+// update updates tm with the result of an iteration, score and best move, and
+// the fraction of the root nodes spent on best. It returns the soft time limit
+// multiplier.
+func (tm *timeManager) update(best move.Move, score Score, nodeFrac float64) float64 {
+	drop := Score(0)
+	if tm.best != 0 && !score.IsMate() && !tm.score.IsMate() {
+		drop = Clamp(tm.score-score, 0, scoreDropRange)
+	}
+
+	if best == tm.best {
+		tm.stable++
+	} else {
+		tm.stable = 0
+	}
+	tm.best, tm.score = best, score
+
+	scale := stabilityScale[min(tm.stable, len(stabilityScale)-1)]
+	scale *= 1.5 - nodeFrac
+	scale *= 1 + float64(drop)/scoreDropRange
+
+	return min(max(scale, minTimeScale), MaxTimeScale)
+}
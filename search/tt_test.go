@@ -0,0 +1,71 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/paulsonkoly/chess-3/board"
+	"github.com/paulsonkoly/chess-3/move"
+	"github.com/paulsonkoly/chess-3/transp"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/paulsonkoly/chess-3/chess"
+)
+
+// TestRootTTStore tests that the root entry in the tt is not stored by the
+// searches excluding root moves.
+func TestRootTTStore(t *testing.T) {
+	b := Must(board.FromFEN("r3k2r/2pb1ppp/2pp1q2/p7/1nP1B3/1P2P3/P2N1PPP/R2QK2R w KQkq a6 0 14"))
+
+	t.Run("root move restriction", func(t *testing.T) {
+		s := New(1 * transp.MegaBytes)
+		s.Go(b, WithDepth(6), WithRootMoves([]move.Move{move.From(A2) | move.To(A3)}), WithOutput(nil))
+
+		_, ok := s.tt.LookUp(b.Hashes().Full())
+		assert.False(t, ok)
+	})
+
+	t.Run("multi PV", func(t *testing.T) {
+		s := New(1 * transp.MegaBytes)
+		score, _, _ := s.Go(b, WithDepth(6), WithMultiPV(3), WithOutput(nil))
+
+		// the entry of the first line
+		entry, ok := s.tt.LookUp(b.Hashes().Full())
+		assert.True(t, ok)
+		assert.Equal(t, transp.Exact, entry.Type())
+		assert.Equal(t, score, entry.Value(0))
+	})
+}
+
+// constEval is an evaluator with the same evaluation for every position.
+type constEval Score
+
+func (c constEval) Evaluate(*board.Board) Score    { return Score(c) }
+func (constEval) Refresh(*board.Board)             {}
+func (constEval) MakeMove(*board.Board, move.Move) {}
+func (constEval) UndoMove()                        {}
+func (constEval) Clear()                           {}
+
+// TestTTEvalSwitch tests that the static evaluations stored in the tt are not
+// reused after the evaluator changes.
+func TestTTEvalSwitch(t *testing.T) {
+	b := Must(board.FromFEN("r3k2r/2pb1ppp/2pp1q2/p7/1nP1B3/1P2P3/P2N1PPP/R2QK2R w KQkq a6 0 14"))
+	s := New(1*transp.MegaBytes, WithEvaluator(func() Evaluator { return constEval(100) }))
+
+	s.Go(b, WithDepth(4), WithOutput(nil))
+
+	entry, ok := s.tt.LookUp(b.Hashes().Full())
+	assert.True(t, ok)
+	assert.Equal(t, Score(100), entry.Eval())
+
+	s.SetEvaluator(func() Evaluator { return constEval(-30) })
+
+	entry, ok = s.tt.LookUp(b.Hashes().Full())
+	assert.True(t, ok)
+	assert.Equal(t, Inv, entry.Eval())
+
+	s.Go(b, WithDepth(4), WithOutput(nil))
+
+	entry, ok = s.tt.LookUp(b.Hashes().Full())
+	assert.True(t, ok)
+	assert.Equal(t, Score(-30), entry.Eval())
+}
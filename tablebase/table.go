@@ -0,0 +1,624 @@
+package tablebase
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"slices"
+	"sync"
+
+	"github.com/paulsonkoly/chess-3/attacks"
+	. "github.com/paulsonkoly/chess-3/chess"
+)
+
+// maxPieces is the maximal number of pieces in a Syzygy table.
+const maxPieces = 7
+
+type tableType byte
+
+const (
+	wdlType tableType = iota
+	dtzType
+)
+
+var (
+	magics     = [...][4]byte{wdlType: {0x71, 0xe8, 0x23, 0x5d}, dtzType: {0xd7, 0x66, 0x0c, 0xa5}}
+	extensions = [...]string{wdlType: ".rtbw", dtzType: ".rtbz"}
+)
+
+// table file header flags.
+const (
+	headerSplit    = 1
+	headerHasPawns = 2
+)
+
+// pairsData flags.
+const (
+	flagSTM         = 1
+	flagMapped      = 2
+	flagWinPlies    = 4
+	flagLossPlies   = 8
+	flagWide        = 16
+	flagSingleValue = 128
+)
+
+var errCorrupt = errors.New("corrupt tablebase file")
+
+// pairsData is the decoding information of a single sub-table, that is for a
+// given side to move and, in pawn tables, for a given leading pawn file. All
+// offsets are byte offsets into the table file.
+type pairsData struct {
+	pieces          [maxPieces]byte // table piece codes in the encoding order
+	groupLen        [maxPieces + 1]int
+	groupIdx        [maxPieces + 1]uint64
+	base64          []uint64
+	symlen          []byte
+	mapIdx          [4]int
+	sizeofBlock     uint64
+	span            uint64
+	sparseIndexSize uint64
+	blockLengthSize uint64
+	numBlocks       uint64
+	lowestSym       int
+	btree           int
+	sparseIndex     int
+	blockLength     int
+	data            int
+	flags           byte
+	maxSymLen       byte
+	minSymLen       byte
+}
+
+// table is a single WDL or DTZ table file. The file is mapped and its header
+// is parsed on first use.
+type table struct {
+	path            string
+	key             materialKey // white has the pieces listed first in the file name
+	key2            materialKey // black has the pieces listed first in the file name
+	typ             tableType
+	pieceCount      int
+	pawnCount       [2]int // leading color, other color
+	hasPawns        bool
+	hasUniquePieces bool
+
+	once   sync.Once
+	ready  bool
+	raw    []byte
+	dtzMap int
+	items  [2][4]pairsData // side to move, leading pawn file
+}
+
+func newTable(path string, typ tableType, key materialKey) *table {
+	t := &table{path: path, typ: typ, key: key, key2: key.flip()}
+
+	white, black := key.counts(White), key.counts(Black)
+	t.pieceCount = 2
+	for p := Pawn; p < King; p++ {
+		t.pieceCount += white[p] + black[p]
+		if white[p] == 1 || black[p] == 1 {
+			t.hasUniquePieces = true
+		}
+	}
+	t.hasPawns = white[Pawn]+black[Pawn] > 0
+
+	// The leading color is the side with less pawns, it compresses better.
+	if black[Pawn] == 0 || (white[Pawn] > 0 && black[Pawn] >= white[Pawn]) {
+		t.pawnCount = [2]int{white[Pawn], black[Pawn]}
+	} else {
+		t.pawnCount = [2]int{black[Pawn], white[Pawn]}
+	}
+
+	return t
+}
+
+// mapped maps the table file and parses its header, reporting whether the
+// table is usable. It is safe for concurrent use.
+func (t *table) mapped() bool {
+	t.once.Do(func() {
+		raw, err := mapFile(t.path)
+		if err != nil {
+			return
+		}
+		t.raw = raw
+		if t.init() != nil {
+			_ = unmapFile(t.raw)
+			t.raw = nil
+			return
+		}
+		t.ready = true
+	})
+	return t.ready
+}
+
+func (t *table) close() error {
+	if t.raw == nil {
+		return nil
+	}
+	return unmapFile(t.raw)
+}
+
+func (t *table) sides() int {
+	if t.typ == wdlType && t.key != t.key2 {
+		return 2
+	}
+	return 1
+}
+
+func (t *table) get(stm, file int) *pairsData {
+	if !t.hasPawns {
+		file = 0
+	}
+	return &t.items[stm%t.sides()][file]
+}
+
+func (t *table) u8(off int) int  { return int(t.raw[off]) }
+func (t *table) u16(off int) int { return int(binary.LittleEndian.Uint16(t.raw[off:])) }
+
+// u32BE is the big endian uint32 at off. The decoder reads ahead past the end
+// of a block, bytes past the end of the file read as 0.
+func (t *table) u32BE(off int) uint64 {
+	if off+4 <= len(t.raw) {
+		return uint64(binary.BigEndian.Uint32(t.raw[off:]))
+	}
+
+	var buf [4]byte
+	if off < len(t.raw) {
+		copy(buf[:], t.raw[off:])
+	}
+	return uint64(binary.BigEndian.Uint32(buf[:]))
+}
+
+func (t *table) init() (err error) {
+	// a truncated file would make the parser index out of range
+	defer func() {
+		if recover() != nil {
+			err = errCorrupt
+		}
+	}()
+
+	if len(t.raw) < 5 || !bytes.Equal(t.raw[:4], magics[t.typ][:]) {
+		return errCorrupt
+	}
+	off := 4
+
+	header := t.raw[off]
+	if (header&headerHasPawns != 0) != t.hasPawns || (header&headerSplit != 0) != (t.key != t.key2) {
+		return errCorrupt
+	}
+	off++
+
+	sides := t.sides()
+	maxFile := 0
+	if t.hasPawns {
+		maxFile = int(DFile)
+	}
+	pp := t.hasPawns && t.pawnCount[1] > 0
+
+	for f := 0; f <= maxFile; f++ {
+		order := [2][2]int{{t.u8(off) & 0xf, 0xf}, {t.u8(off) >> 4, 0xf}}
+		off++
+		if pp {
+			order[0][1], order[1][1] = t.u8(off)&0xf, t.u8(off)>>4
+			off++
+		}
+
+		for k := range t.pieceCount {
+			for i := range sides {
+				t.items[i][f].pieces[k] = t.raw[off] >> (4 * i) & 0xf
+			}
+			off++
+		}
+
+		for i := range sides {
+			t.setGroups(&t.items[i][f], order[i], f)
+		}
+	}
+
+	off += off & 1
+
+	for f := 0; f <= maxFile; f++ {
+		for i := range sides {
+			off = t.setSizes(&t.items[i][f], off)
+		}
+	}
+
+	if t.typ == dtzType {
+		off = t.setDTZMap(off, maxFile)
+	}
+
+	for f := 0; f <= maxFile; f++ {
+		for i := range sides {
+			d := &t.items[i][f]
+			d.sparseIndex = off
+			off += int(d.sparseIndexSize) * 6
+		}
+	}
+
+	for f := 0; f <= maxFile; f++ {
+		for i := range sides {
+			d := &t.items[i][f]
+			d.blockLength = off
+			off += int(d.blockLengthSize) * 2
+		}
+	}
+
+	for f := 0; f <= maxFile; f++ {
+		for i := range sides {
+			d := &t.items[i][f]
+			off = (off + 0x3f) &^ 0x3f
+			d.data = off
+			off += int(d.numBlocks * d.sizeofBlock)
+			if d.numBlocks > 0 && off > len(t.raw) {
+				return errCorrupt
+			}
+		}
+	}
+
+	return nil
+}
+
+// setGroups splits the pieces into groups of identical pieces and calculates
+// the index multiplier of each group.
+func (t *table) setGroups(d *pairsData, order [2]int, file int) {
+	firstLen := 2
+	switch {
+	case t.hasPawns:
+		firstLen = 0
+	case t.hasUniquePieces:
+		firstLen = 3
+	}
+
+	n := 0
+	d.groupLen[n] = 1
+	for i := 1; i < t.pieceCount; i++ {
+		firstLen--
+		if firstLen > 0 || d.pieces[i] == d.pieces[i-1] {
+			d.groupLen[n]++
+		} else {
+			n++
+			d.groupLen[n] = 1
+		}
+	}
+	n++
+	d.groupLen[n] = 0
+
+	pp := t.hasPawns && t.pawnCount[1] > 0
+	next := 1
+	freeSquares := 64 - d.groupLen[0]
+	if pp {
+		next = 2
+		freeSquares -= d.groupLen[1]
+	}
+
+	idx := uint64(1)
+	for k := 0; next < n || k == order[0] || k == order[1]; k++ {
+		switch k {
+		case order[0]: // leading pawns or pieces
+			d.groupIdx[0] = idx
+			switch {
+			case t.hasPawns:
+				idx *= leadPawnsSize[d.groupLen[0]][file]
+			case t.hasUniquePieces:
+				idx *= 31332
+			default:
+				idx *= 462
+			}
+
+		case order[1]: // remaining pawns
+			d.groupIdx[1] = idx
+			idx *= binomial[d.groupLen[1]][48-d.groupLen[0]]
+
+		default: // remaining pieces
+			d.groupIdx[next] = idx
+			idx *= binomial[d.groupLen[next]][freeSquares]
+			freeSquares -= d.groupLen[next]
+			next++
+		}
+	}
+
+	d.groupIdx[n] = idx
+}
+
+// setSizes reads the canonical Huffman code and the recursive pairing
+// dictionary of d.
+func (t *table) setSizes(d *pairsData, off int) int {
+	d.flags = t.raw[off]
+	off++
+
+	if d.flags&flagSingleValue != 0 {
+		d.minSymLen = t.raw[off] // the single value
+		return off + 1
+	}
+
+	n := slices.Index(d.groupLen[:], 0)
+	tbSize := d.groupIdx[n]
+
+	d.sizeofBlock = 1 << t.raw[off]
+	d.span = 1 << t.raw[off+1]
+	d.sparseIndexSize = (tbSize + d.span - 1) / d.span
+	padding := uint64(t.raw[off+2])
+	d.numBlocks = uint64(binary.LittleEndian.Uint32(t.raw[off+3:]))
+	d.blockLengthSize = d.numBlocks + padding
+	d.maxSymLen = t.raw[off+7]
+	d.minSymLen = t.raw[off+8]
+	off += 9
+
+	d.lowestSym = off
+	size := int(d.maxSymLen) - int(d.minSymLen) + 1
+	d.base64 = make([]uint64, size)
+
+	// Longer symbols have lower numeric value in the canonical code, base64
+	// is the lowest code of each length left aligned to 64 bits.
+	for i := size - 2; i >= 0; i-- {
+		d.base64[i] = (d.base64[i+1] + uint64(t.u16(d.lowestSym+2*i)) - uint64(t.u16(d.lowestSym+2*i+2))) / 2
+	}
+	for i := range size {
+		d.base64[i] <<= 64 - i - int(d.minSymLen)
+	}
+	off += 2 * size
+
+	symCnt := t.u16(off)
+	off += 2
+	d.btree = off
+	d.symlen = make([]byte, symCnt)
+
+	visited := make([]bool, symCnt)
+	for sym := range symCnt {
+		if !visited[sym] {
+			d.symlen[sym] = t.setSymlen(d, sym, visited)
+		}
+	}
+
+	return off + 3*symCnt + symCnt&1
+}
+
+// setSymlen calculates the number of symbols sym expands to, minus 1.
+func (t *table) setSymlen(d *pairsData, sym int, visited []bool) byte {
+	visited[sym] = true
+
+	right := t.right(d, sym)
+	if right == 0xfff {
+		return 0
+	}
+	left := t.left(d, sym)
+
+	if !visited[left] {
+		d.symlen[left] = t.setSymlen(d, left, visited)
+	}
+	if !visited[right] {
+		d.symlen[right] = t.setSymlen(d, right, visited)
+	}
+
+	return d.symlen[left] + d.symlen[right] + 1
+}
+
+func (t *table) left(d *pairsData, sym int) int {
+	off := d.btree + 3*sym
+	return (t.u8(off+1)&0xf)<<8 | t.u8(off)
+}
+
+func (t *table) right(d *pairsData, sym int) int {
+	off := d.btree + 3*sym
+	return t.u8(off+2)<<4 | t.u8(off+1)>>4
+}
+
+// setDTZMap reads the value maps of the DTZ sub-tables.
+func (t *table) setDTZMap(off, maxFile int) int {
+	t.dtzMap = off
+
+	for f := 0; f <= maxFile; f++ {
+		d := &t.items[0][f]
+		if d.flags&flagMapped == 0 {
+			continue
+		}
+
+		if d.flags&flagWide != 0 {
+			off += off & 1
+			for i := range 4 {
+				d.mapIdx[i] = (off-t.dtzMap)/2 + 1
+				off += 2*t.u16(off) + 2
+			}
+		} else {
+			for i := range 4 {
+				d.mapIdx[i] = off - t.dtzMap + 1
+				off += t.u8(off) + 1
+			}
+		}
+	}
+
+	return off + off&1
+}
+
+// decompressPairs is the value stored at index idx in d.
+func (t *table) decompressPairs(d *pairsData, idx uint64) int {
+	if d.flags&flagSingleValue != 0 {
+		return int(d.minSymLen)
+	}
+
+	// The sparse index entry k points to the block and offset of the value
+	// with index k*span + span/2.
+	k := int(idx / d.span)
+	block := int(binary.LittleEndian.Uint32(t.raw[d.sparseIndex+6*k:]))
+	offset := t.u16(d.sparseIndex + 6*k + 4)
+	offset += int(idx%d.span) - int(d.span/2)
+
+	for offset < 0 {
+		block--
+		offset += t.u16(d.blockLength+2*block) + 1
+	}
+	for offset > t.u16(d.blockLength+2*block) {
+		offset -= t.u16(d.blockLength+2*block) + 1
+		block++
+	}
+
+	ptr := d.data + block*int(d.sizeofBlock)
+	buf := t.u32BE(ptr)<<32 | t.u32BE(ptr+4)
+	ptr += 8
+	bufSize := 64
+
+	var sym uint16
+	for {
+		l := 0
+		for buf < d.base64[l] {
+			l++
+		}
+
+		sym = uint16((buf - d.base64[l]) >> (64 - l - int(d.minSymLen)))
+		sym += uint16(t.u16(d.lowestSym + 2*l))
+
+		if offset < int(d.symlen[sym])+1 {
+			break
+		}
+
+		offset -= int(d.symlen[sym]) + 1
+		l += int(d.minSymLen)
+		buf <<= l
+		bufSize -= l
+
+		if bufSize <= 32 {
+			bufSize += 32
+			buf |= t.u32BE(ptr) << (64 - bufSize)
+			ptr += 4
+		}
+	}
+
+	// expand sym with recursive pairing until we reach the single value
+	for d.symlen[sym] != 0 {
+		left := t.left(d, int(sym))
+		if offset < int(d.symlen[left])+1 {
+			sym = uint16(left)
+		} else {
+			offset -= int(d.symlen[left]) + 1
+			sym = uint16(t.right(d, int(sym)))
+		}
+	}
+
+	return t.left(d, int(sym))
+}
+
+var wdlMap = [...]int{1, 3, 0, 2, 0}
+
+// mapScore converts the decompressed value to a WDL score or to DTZ plies.
+func (t *table) mapScore(file int, value int, wdl WDL) int {
+	if t.typ == wdlType {
+		return value - 2
+	}
+
+	d := t.get(0, file)
+	if d.flags&flagMapped != 0 {
+		idx := d.mapIdx[wdlMap[wdl+2]]
+		if d.flags&flagWide != 0 {
+			value = t.u16(t.dtzMap + 2*(idx+value))
+		} else {
+			value = t.u8(t.dtzMap + idx + value)
+		}
+	}
+
+	if (wdl == Win && d.flags&flagWinPlies == 0) ||
+		(wdl == Loss && d.flags&flagLossPlies == 0) ||
+		wdl == CursedWin || wdl == BlessedLoss {
+		value *= 2
+	}
+
+	return value + 1
+}
+
+// Encoding tables.
+var (
+	mapB1H1H7     [64]int        // squares below the a1-h8 diagonal to 0..27
+	mapA1D1D4     [64]int        // the a1-d1-d4 triangle to 0..9
+	mapKK         [10][64]uint64 // the 462 legal king placements
+	binomial      [6][64]uint64  // binomial[k][n] is n choose k
+	mapPawns      [64]int        // a2-h7 to 0..47, toward the edges and lower ranks is higher
+	leadPawnIdx   [6][64]uint64  // leading pawns count, leading pawn square
+	leadPawnsSize [6][4]uint64   // leading pawns count, leading pawn file
+)
+
+// offA1H8 is positive above the a1-h8 diagonal, negative below it.
+func offA1H8(sq int) int { return sq>>3 - sq&7 }
+
+func init() {
+	code := 0
+	for sq := range 64 {
+		if offA1H8(sq) < 0 {
+			mapB1H1H7[sq] = code
+			code++
+		}
+	}
+
+	code = 0
+	diagonal := []int{}
+	for sq := int(A1); sq <= int(D4); sq++ {
+		switch {
+		case offA1H8(sq) < 0 && sq&7 <= int(DFile):
+			mapA1D1D4[sq] = code
+			code++
+		case offA1H8(sq) == 0 && sq&7 <= int(DFile):
+			diagonal = append(diagonal, sq)
+		}
+	}
+	for _, sq := range diagonal {
+		mapA1D1D4[sq] = code
+		code++
+	}
+
+	// The first king is in the a1-d1-d4 triangle, if it is on the diagonal the
+	// other king is not above the diagonal. Placements with both kings on the
+	// diagonal are encoded last.
+	type placement struct{ idx, sq int }
+	bothOnDiagonal := []placement{}
+	kk := uint64(0)
+	for idx := range 10 {
+		for s1 := int(A1); s1 <= int(D4); s1++ {
+			if mapA1D1D4[s1] != idx || (idx == 0 && s1 != int(B1)) {
+				continue
+			}
+			for s2 := range 64 {
+				switch {
+				case (attacks.KingMoves(Square(s1))|BitBoardFromSquares(Square(s1)))&BitBoardFromSquares(Square(s2)) != 0:
+				case offA1H8(s1) == 0 && offA1H8(s2) > 0:
+				case offA1H8(s1) == 0 && offA1H8(s2) == 0:
+					bothOnDiagonal = append(bothOnDiagonal, placement{idx, s2})
+				default:
+					mapKK[idx][s2] = kk
+					kk++
+				}
+			}
+		}
+	}
+	for _, p := range bothOnDiagonal {
+		mapKK[p.idx][p.sq] = kk
+		kk++
+	}
+
+	binomial[0][0] = 1
+	for n := 1; n < 64; n++ {
+		for k := 0; k < 6 && k <= n; k++ {
+			if k > 0 {
+				binomial[k][n] += binomial[k-1][n-1]
+			}
+			if k < n {
+				binomial[k][n] += binomial[k][n-1]
+			}
+		}
+	}
+
+	available := 47
+	for leadCnt := 1; leadCnt <= 5; leadCnt++ {
+		for f := AFile; f <= DFile; f++ {
+			idx := uint64(0)
+			for r := SecondRank; r <= SeventhRank; r++ {
+				sq := int(SquareAt(f, r))
+				if leadCnt == 1 {
+					mapPawns[sq] = available
+					available--
+					mapPawns[sq^7] = available
+					available--
+				}
+				leadPawnIdx[leadCnt][sq] = idx
+				idx += binomial[leadCnt-1][mapPawns[sq]]
+			}
+			leadPawnsSize[leadCnt][f] = idx
+		}
+	}
+}
@@ -0,0 +1,994 @@
+package tablebase
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/paulsonkoly/chess-3/attacks"
+	"github.com/paulsonkoly/chess-3/board"
+	. "github.com/paulsonkoly/chess-3/chess"
+	"github.com/paulsonkoly/chess-3/move"
+	"github.com/paulsonkoly/chess-3/movegen"
+	"github.com/stretchr/testify/assert"
+)
+
+// The repository has no Syzygy files. These tests solve the three piece
+// endings with a retrograde analysis that shares no code with the prober,
+// write the solutions as compressed Syzygy tables and probe them.
+
+// nodes is the number of positions of a KXvK ending indexed by node.
+const nodes = 2 << 18
+
+func node(stm Color, x, wk, bk Square) int {
+	return int(stm)<<18 | int(x)<<12 | int(wk)<<6 | int(bk)
+}
+
+func unpack(n int) (stm Color, x, wk, bk Square) {
+	return Color(n >> 18), Square(n >> 12 & 63), Square(n >> 6 & 63), Square(n & 63)
+}
+
+// edge is a legal move to child, or if child is -1, to a position of another
+// ending with value wdl from its side to move.
+type edge struct {
+	child   int32
+	wdl     int8
+	zeroing bool
+}
+
+// kxk is the solution of the KXvK ending, white having the piece x.
+type kxk struct {
+	x     Piece
+	valid []bool
+	mated []bool
+	wdl   []WDL
+	dtz   []int
+
+	// the moves of node n are edges[start[n]:start[n+1]]
+	edges []edge
+	start []int32
+}
+
+// attacksOf is the set of squares attacked by the white piece p on sq.
+func attacksOf(p Piece, sq Square, occ BitBoard) BitBoard {
+	switch p {
+	case Queen:
+		return attacks.RookMoves(sq, occ) | attacks.BishopMoves(sq, occ)
+	case Rook:
+		return attacks.RookMoves(sq, occ)
+	case Bishop:
+		return attacks.BishopMoves(sq, occ)
+	case Knight:
+		return attacks.KnightMoves(sq)
+	}
+	return attacks.PawnCaptureMoves(BitBoardFromSquares(sq), White)
+}
+
+// solve solves the KXvK ending. The promotions of a pawn are looked up in
+// promos.
+func solve(x Piece, promos map[Piece]*kxk) *kxk {
+	s := &kxk{
+		x:     x,
+		valid: make([]bool, nodes),
+		mated: make([]bool, nodes),
+		wdl:   make([]WDL, nodes),
+		dtz:   make([]int, nodes),
+		start: make([]int32, nodes+1),
+	}
+
+	for n := range nodes {
+		s.start[n] = int32(len(s.edges))
+
+		stm, x, wk, bk := unpack(n)
+		if !s.isValid(stm, x, wk, bk) {
+			continue
+		}
+		s.valid[n] = true
+
+		if stm == White {
+			s.whiteMoves(x, wk, bk, promos)
+		} else {
+			s.blackMoves(x, wk, bk)
+		}
+	}
+	s.start[nodes] = int32(len(s.edges))
+
+	s.solveWDL()
+	s.solveDTZ()
+	s.edges, s.start = nil, nil
+
+	return s
+}
+
+func (s *kxk) isValid(stm Color, x, wk, bk Square) bool {
+	if x == wk || x == bk || wk == bk || attacks.KingMoves(wk)&BitBoardFromSquares(bk) != 0 {
+		return false
+	}
+	if s.x == Pawn && (x.Rank() == FirstRank || x.Rank() == EighthRank) {
+		return false
+	}
+	// black can't be in check with white to move
+	return stm == Black || !s.check(x, wk, bk)
+}
+
+func (s *kxk) check(x, wk, bk Square) bool {
+	return attacksOf(s.x, x, BitBoardFromSquares(x, wk, bk))&BitBoardFromSquares(bk) != 0
+}
+
+func (s *kxk) whiteMoves(x, wk, bk Square, promos map[Piece]*kxk) {
+	occ := BitBoardFromSquares(x, wk, bk)
+
+	for bb := attacks.KingMoves(wk) &^ attacks.KingMoves(bk) &^ occ; bb != 0; bb &= bb - 1 {
+		s.edges = append(s.edges, edge{child: int32(node(Black, x, bb.LowestSet(), bk))})
+	}
+
+	if s.x != Pawn {
+		for bb := attacksOf(s.x, x, occ) &^ occ; bb != 0; bb &= bb - 1 {
+			s.edges = append(s.edges, edge{child: int32(node(Black, bb.LowestSet(), wk, bk))})
+		}
+		return
+	}
+
+	push := x + 8
+	switch {
+
+	case occ&BitBoardFromSquares(push) != 0:
+
+	case push.Rank() == EighthRank:
+		for _, p := range []Piece{Queen, Rook, Bishop, Knight} {
+			wdl := promos[p].wdl[node(Black, push, wk, bk)]
+			s.edges = append(s.edges, edge{child: -1, wdl: int8(wdl), zeroing: true})
+		}
+
+	default:
+		s.edges = append(s.edges, edge{child: int32(node(Black, push, wk, bk)), zeroing: true})
+		if x.Rank() == SecondRank && occ&BitBoardFromSquares(push+8) == 0 {
+			s.edges = append(s.edges, edge{child: int32(node(Black, push+8, wk, bk)), zeroing: true})
+		}
+	}
+}
+
+func (s *kxk) blackMoves(x, wk, bk Square) {
+	covered := attacks.KingMoves(wk) | attacksOf(s.x, x, BitBoardFromSquares(x, wk))
+
+	for bb := attacks.KingMoves(bk) &^ covered &^ BitBoardFromSquares(wk); bb != 0; bb &= bb - 1 {
+		to := bb.LowestSet()
+		if to == x {
+			s.edges = append(s.edges, edge{child: -1, wdl: int8(Draw), zeroing: true})
+		} else {
+			s.edges = append(s.edges, edge{child: int32(node(White, x, wk, to))})
+		}
+	}
+}
+
+func (s *kxk) moves(n int) []edge { return s.edges[s.start[n]:s.start[n+1]] }
+
+// value is the WDL value after e from the side to move.
+func (s *kxk) value(e edge) WDL {
+	if e.child < 0 {
+		return WDL(e.wdl)
+	}
+	return s.wdl[e.child]
+}
+
+// solveWDL propagates the mates back until nothing changes. Positions not
+// reached are draws.
+func (s *kxk) solveWDL() {
+	known := make([]bool, nodes)
+
+	for n := range nodes {
+		if s.valid[n] && len(s.moves(n)) == 0 {
+			known[n] = true
+			if stm, x, wk, bk := unpack(n); stm == Black && s.check(x, wk, bk) {
+				s.wdl[n], s.mated[n] = Loss, true
+			}
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+
+		for n := range nodes {
+			if !s.valid[n] || known[n] {
+				continue
+			}
+
+			win, loss := false, true
+			for _, e := range s.moves(n) {
+				ok := e.child < 0 || known[e.child]
+				win = win || (ok && s.value(e) == Loss)
+				loss = loss && ok && s.value(e) == Win
+			}
+
+			switch {
+			case win:
+				s.wdl[n], known[n], changed = Win, true, true
+			case loss:
+				s.wdl[n], known[n], changed = Loss, true, true
+			}
+		}
+	}
+}
+
+// solveDTZ finds the distance in plies to the zeroing move or to the mate,
+// level by level. The loser delays the zeroing move as long as possible.
+func (s *kxk) solveDTZ() {
+	type update struct{ n, dtz int }
+
+	for level := 1; ; level++ {
+		var updates []update
+
+		for n := range nodes {
+			if !s.valid[n] || s.dtz[n] != 0 || s.wdl[n] == Draw {
+				continue
+			}
+
+			if s.wdl[n] == Win {
+				for _, e := range s.moves(n) {
+					if s.value(e) != Loss {
+						continue
+					}
+					if (level == 1 && (e.zeroing || s.mated[e.child])) || (level > 1 && !e.zeroing && s.dtz[e.child] == 1-level) {
+						updates = append(updates, update{n, level})
+						break
+					}
+				}
+				continue
+			}
+
+			if s.mated[n] {
+				updates = append(updates, update{n, -1})
+				continue
+			}
+
+			// the only zeroing moves of the loser are captures, that don't lose
+			longest := 0
+			for _, e := range s.moves(n) {
+				if s.dtz[e.child] == 0 {
+					longest = 0
+					break
+				}
+				longest = max(longest, s.dtz[e.child]+1)
+			}
+			if longest == level {
+				updates = append(updates, update{n, -level})
+			}
+		}
+
+		if len(updates) == 0 {
+			return
+		}
+		for _, u := range updates {
+			s.dtz[u.n] = u.dtz
+		}
+	}
+}
+
+// board is the position of node n with only the fields set that the table
+// index needs.
+func (s *kxk) board(n int) *board.Board {
+	stm, x, wk, bk := unpack(n)
+
+	b := &board.Board{STM: stm}
+	put := func(c Color, p Piece, sq Square) {
+		b.SquaresToPiece[sq] = p
+		b.Pieces[p] |= BitBoardFromSquares(sq)
+		b.Colors[c] |= BitBoardFromSquares(sq)
+		b.Counts[c][p]++
+	}
+	put(White, s.x, x)
+	put(White, King, wk)
+	put(Black, King, bk)
+
+	return b
+}
+
+// fen is the FEN of node n, with the colors flipped if flip is set.
+func (s *kxk) fen(n int, flip bool) string {
+	stm, x, wk, bk := unpack(n)
+
+	var squares [64]byte
+	squares[x], squares[wk], squares[bk] = " PNBRQ"[s.x], 'K', 'k'
+	if flip {
+		var flipped [64]byte
+		for sq, c := range squares {
+			if c != 0 {
+				flipped[sq^56] = c ^ 0x20 // swaps the case
+			}
+		}
+		squares = flipped
+		stm = stm.Flip()
+	}
+
+	sb := strings.Builder{}
+	for rank := 7; rank >= 0; rank-- {
+		empty := 0
+		for _, c := range squares[8*rank : 8*rank+8] {
+			if c == 0 {
+				empty++
+				continue
+			}
+			if empty > 0 {
+				fmt.Fprint(&sb, empty)
+				empty = 0
+			}
+			sb.WriteByte(c)
+		}
+		if empty > 0 {
+			fmt.Fprint(&sb, empty)
+		}
+		if rank > 0 {
+			sb.WriteByte('/')
+		}
+	}
+	fmt.Fprintf(&sb, " %c - - 0 1", "wb"[stm])
+
+	return sb.String()
+}
+
+// solutionOf is the solution of the ending of b and the node of b in it.
+func (e endings) solutionOf(b *board.Board) (*kxk, int) {
+	strong, stm, flip := White, b.STM, Square(0)
+	if b.Colors[Black].Count() == 2 {
+		strong, stm, flip = Black, stm.Flip(), 56
+	}
+
+	x := (b.Colors[strong] &^ b.Pieces[King]).LowestSet()
+	wk := (b.Colors[strong] & b.Pieces[King]).LowestSet()
+	bk := (b.Colors[strong.Flip()] & b.Pieces[King]).LowestSet()
+
+	return e.solutions[b.SquaresToPiece[x]], node(stm, x^flip, wk^flip, bk^flip)
+}
+
+// subTable is a compressed sub-table.
+type subTable struct {
+	flags  byte
+	value  byte   // value is the value of single value sub-tables
+	sizes  []byte // sizes are the code and the pairing dictionary
+	sparse []byte // sparse is the sparse index
+	blocks []byte // blocks are the block lengths
+	data   []byte
+}
+
+const (
+	blockSizeLog = 6
+	spanLog      = 6
+	maxSymbols   = 64
+)
+
+// compress compresses values with recursive pairing and a canonical Huffman
+// code.
+func compress(values []byte, flags byte) subTable {
+	if slices.Min(values) == slices.Max(values) {
+		return subTable{flags: flags | flagSingleValue, value: values[0]}
+	}
+
+	// symbols are values if right is 0xfff, pairs of symbols otherwise
+	type symbol struct{ left, right, len int }
+	var syms []symbol
+
+	leaves := map[byte]int{}
+	seq := make([]int, len(values))
+	for i, v := range values {
+		if _, ok := leaves[v]; !ok {
+			leaves[v] = len(syms)
+			syms = append(syms, symbol{int(v), 0xfff, 1})
+		}
+		seq[i] = leaves[v]
+	}
+
+	// pair the most frequent pair of symbols while it pays off
+	for len(syms) < maxSymbols {
+		var counts [maxSymbols][maxSymbols]int
+		for i := 1; i < len(seq); i++ {
+			counts[seq[i-1]][seq[i]]++
+		}
+
+		best, bestCnt := [2]int{}, 3
+		for l := range syms {
+			for r := range syms {
+				if counts[l][r] > bestCnt && syms[l].len+syms[r].len <= 256 {
+					best, bestCnt = [2]int{l, r}, counts[l][r]
+				}
+			}
+		}
+		if bestCnt == 3 {
+			break
+		}
+
+		pair := len(syms)
+		syms = append(syms, symbol{best[0], best[1], syms[best[0]].len + syms[best[1]].len})
+
+		paired := seq[:0]
+		for i := 0; i < len(seq); i++ {
+			if i+1 < len(seq) && seq[i] == best[0] && seq[i+1] == best[1] {
+				paired = append(paired, pair)
+				i++
+			} else {
+				paired = append(paired, seq[i])
+			}
+		}
+		seq = paired
+	}
+
+	// every symbol gets a code, the pairs are needed in the dictionary
+	freqs := make([]int, len(syms))
+	for i := range freqs {
+		freqs[i] = 1
+	}
+	for _, sym := range seq {
+		freqs[sym]++
+	}
+	lengths := huffman(freqs)
+
+	// the canonical code numbers the longer codes first
+	order := make([]int, len(syms))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int { return lengths[b] - lengths[a] })
+	renum := make([]int, len(syms))
+	for i, sym := range order {
+		renum[sym] = i
+	}
+
+	minLen, maxLen := slices.Min(lengths), slices.Max(lengths)
+	counts := make([]int, maxLen+1)
+	for _, l := range lengths {
+		counts[l]++
+	}
+	lowest := make([]int, maxLen+1)
+	base := make([]uint64, maxLen+1)
+	for l := maxLen - 1; l >= minLen; l-- {
+		lowest[l] = lowest[l+1] + counts[l+1]
+		base[l] = (base[l+1] + uint64(counts[l+1])) / 2
+	}
+
+	// the values are split to blocks of whole symbols
+	blockSize := 1 << blockSizeLog
+	st := subTable{flags: flags}
+	starts := []int{} // starts are the index of the first value of each block
+	bits, first := 8*blockSize, 0
+	for _, sym := range seq {
+		l := lengths[sym]
+		if bits+l > 8*blockSize || first+syms[sym].len-starts[len(starts)-1] > 0x10000 {
+			starts = append(starts, first)
+			st.data = append(st.data, make([]byte, blockSize)...)
+			bits = 0
+		}
+
+		block := st.data[len(st.data)-blockSize:]
+		code := base[l] + uint64(renum[sym]-lowest[l])
+		for i := range l {
+			if code>>(l-1-i)&1 != 0 {
+				block[(bits+i)/8] |= 0x80 >> ((bits + i) % 8)
+			}
+		}
+		bits += l
+		first += syms[sym].len
+	}
+	starts = append(starts, first)
+	numBlocks := len(starts) - 1
+
+	st.sizes = []byte{blockSizeLog, spanLog, 0}
+	st.sizes = binary.LittleEndian.AppendUint32(st.sizes, uint32(numBlocks))
+	st.sizes = append(st.sizes, byte(maxLen), byte(minLen))
+	for l := minLen; l <= maxLen; l++ {
+		st.sizes = binary.LittleEndian.AppendUint16(st.sizes, uint16(lowest[l]))
+	}
+	st.sizes = binary.LittleEndian.AppendUint16(st.sizes, uint16(len(syms)))
+	for _, sym := range order {
+		left, right := syms[sym].left, syms[sym].right
+		if right != 0xfff {
+			left, right = renum[left], renum[right]
+		}
+		st.sizes = append(st.sizes, byte(left), byte(left>>8)|byte(right<<4), byte(right>>4))
+	}
+	st.sizes = append(st.sizes, make([]byte, len(syms)&1)...)
+
+	for i := range numBlocks {
+		st.blocks = binary.LittleEndian.AppendUint16(st.blocks, uint16(starts[i+1]-starts[i]-1))
+	}
+
+	// the sparse index entry k is the block and the offset of the value with
+	// index k*span + span/2
+	span := 1 << spanLog
+	for k := range (len(values) + span - 1) / span {
+		target := k*span + span/2
+		block, _ := slices.BinarySearch(starts[:numBlocks], target+1)
+		block--
+		st.sparse = binary.LittleEndian.AppendUint32(st.sparse, uint32(block))
+		st.sparse = binary.LittleEndian.AppendUint16(st.sparse, uint16(target-starts[block]))
+	}
+
+	return st
+}
+
+// huffman is the Huffman code length of the symbols with frequencies freqs.
+func huffman(freqs []int) []int {
+	type tree struct {
+		freq int
+		syms []int
+	}
+
+	lengths := make([]int, len(freqs))
+	trees := make([]tree, len(freqs))
+	for sym, freq := range freqs {
+		trees[sym] = tree{freq, []int{sym}}
+	}
+
+	for len(trees) > 1 {
+		slices.SortStableFunc(trees, func(a, b tree) int { return a.freq - b.freq })
+		merged := tree{trees[0].freq + trees[1].freq, slices.Concat(trees[0].syms, trees[1].syms)}
+		for _, sym := range merged.syms {
+			lengths[sym]++
+		}
+		trees = append(trees[2:], merged)
+	}
+
+	return lengths
+}
+
+// tableFile is a table being written.
+type tableFile struct {
+	*table
+	subs [2][4]subTable // subs are the sub-tables by side to move and file
+	maps [4][4][]byte   // maps are the DTZ value maps by file and map index
+}
+
+func newTableFile(code string, typ tableType, pieces []byte) *tableFile {
+	key, _ := parseCode(code)
+	t := newTable(code+extensions[typ], typ, key)
+
+	for f := range 4 {
+		for i := range 2 {
+			copy(t.items[i][f].pieces[:], pieces)
+			t.setGroups(&t.items[i][f], [2]int{0, 0xf}, f)
+		}
+	}
+
+	return &tableFile{table: t}
+}
+
+func (tf *tableFile) files() int {
+	if tf.hasPawns {
+		return 4
+	}
+	return 1
+}
+
+// size is the number of indices in the sub-tables of file.
+func (tf *tableFile) size(file int) int {
+	d := &tf.items[0][file]
+	return int(d.groupIdx[slices.Index(d.groupLen[:], 0)])
+}
+
+// write writes the table to dir in the layout table.init reads.
+func (tf *tableFile) write(dir string) error {
+	raw := slices.Clone(magics[tf.typ][:])
+
+	header := byte(0)
+	if tf.key != tf.key2 {
+		header |= headerSplit
+	}
+	if tf.hasPawns {
+		header |= headerHasPawns
+	}
+	raw = append(raw, header)
+
+	for f := range tf.files() {
+		raw = append(raw, 0) // the leading group comes first
+		for k := range tf.pieceCount {
+			raw = append(raw, tf.items[0][f].pieces[k]|tf.items[1][f].pieces[k]<<4)
+		}
+	}
+	raw = append(raw, make([]byte, len(raw)&1)...)
+
+	for f := range tf.files() {
+		for i := range tf.sides() {
+			st := tf.subs[i][f]
+			raw = append(raw, st.flags)
+			if st.flags&flagSingleValue != 0 {
+				raw = append(raw, st.value)
+			} else {
+				raw = append(raw, st.sizes...)
+			}
+		}
+	}
+
+	if tf.typ == dtzType {
+		for f := range tf.files() {
+			if tf.subs[0][f].flags&flagMapped == 0 {
+				continue
+			}
+			for _, m := range tf.maps[f] {
+				raw = append(raw, byte(len(m)))
+				raw = append(raw, m...)
+			}
+		}
+		raw = append(raw, make([]byte, len(raw)&1)...)
+	}
+
+	for f := range tf.files() {
+		for i := range tf.sides() {
+			raw = append(raw, tf.subs[i][f].sparse...)
+		}
+	}
+	for f := range tf.files() {
+		for i := range tf.sides() {
+			raw = append(raw, tf.subs[i][f].blocks...)
+		}
+	}
+	for f := range tf.files() {
+		for i := range tf.sides() {
+			raw = append(raw, make([]byte, -len(raw)&0x3f)...)
+			raw = append(raw, tf.subs[i][f].data...)
+		}
+	}
+
+	return os.WriteFile(filepath.Join(dir, tf.path), raw, 0o644)
+}
+
+// writeTables writes the WDL and DTZ tables of s to dir. The DTZ table stores
+// stm with flags, a combination of flagMapped, flagWinPlies and flagLossPlies.
+func writeTables(t *testing.T, dir string, s *kxk, stm Color, flags byte) {
+	t.Helper()
+
+	code := "K" + string(" PNBRQ"[s.x]) + "vK"
+	pieces := []byte{byte(s.x), byte(King), byte(King) | 8}
+	wdl := newTableFile(code, wdlType, pieces)
+	dtz := newTableFile(code, dtzType, pieces)
+	for f := range 4 {
+		dtz.items[0][f].flags = byte(stm) | flags
+	}
+
+	// -1 is an index without a position, it gets the previous value
+	var wdlValues [2][4][]int
+	var dtzValues, dtzMaps [4][]int
+	for f := range wdl.files() {
+		for i := range 2 {
+			wdlValues[i][f] = slices.Repeat([]int{-1}, wdl.size(f))
+		}
+		dtzValues[f] = slices.Repeat([]int{-1}, dtz.size(f))
+		dtzMaps[f] = make([]int, dtz.size(f))
+	}
+
+	set := func(values []int, idx uint64, v int, n int) {
+		if values[idx] >= 0 && values[idx] != v {
+			assert.Failf(t, "index collision", "%s %d %d", s.fen(n, false), values[idx], v)
+		}
+		values[idx] = v
+	}
+
+	for n := range nodes {
+		if !s.valid[n] {
+			continue
+		}
+		b := s.board(n)
+
+		_, file, idx, _ := wdl.index(b)
+		set(wdlValues[b.STM][file], idx, int(s.wdl[n]+2), n)
+
+		if _, file, idx, ok := dtz.index(b); ok && s.wdl[n] != Draw {
+			v := Abs(s.dtz[n]) - 1
+			if (s.wdl[n] == Win && flags&flagWinPlies == 0) || (s.wdl[n] == Loss && flags&flagLossPlies == 0) {
+				assert.Zero(t, v%2, s.fen(n, false))
+				v /= 2
+			}
+			set(dtzValues[file], idx, v, n)
+			dtzMaps[file][idx] = wdlMap[s.wdl[n]+2]
+		}
+	}
+
+	fill := func(values []int) []byte {
+		res := make([]byte, len(values))
+		prev := 0
+		for i, v := range values {
+			if v < 0 {
+				v = prev
+			}
+			res[i], prev = byte(v), v
+		}
+		return res
+	}
+
+	for f := range wdl.files() {
+		for i := range 2 {
+			wdl.subs[i][f] = compress(fill(wdlValues[i][f]), 0)
+		}
+
+		values := dtzValues[f]
+		if flags&flagMapped != 0 {
+			values = dtz.mapValues(f, values, dtzMaps[f])
+		}
+		dtz.subs[0][f] = compress(fill(values), dtz.items[0][f].flags)
+	}
+
+	assert.NoError(t, wdl.write(dir))
+	assert.NoError(t, dtz.write(dir))
+}
+
+// mapValues replaces values by their index in the sorted value map of their
+// map index.
+func (tf *tableFile) mapValues(file int, values, maps []int) []int {
+	for idx, v := range values {
+		if v >= 0 && !slices.Contains(tf.maps[file][maps[idx]], byte(v)) {
+			tf.maps[file][maps[idx]] = append(tf.maps[file][maps[idx]], byte(v))
+		}
+	}
+	for _, m := range tf.maps[file] {
+		slices.Sort(m)
+	}
+
+	mapped := slices.Clone(values)
+	for idx, v := range values {
+		if v >= 0 {
+			mapped[idx] = slices.Index(tf.maps[file][maps[idx]], byte(v))
+		}
+	}
+	return mapped
+}
+
+// endings are the solved endings, written to dir with the DTZ tables and to
+// wdlDir without.
+type endings struct {
+	dir, wdlDir string
+	solutions   map[Piece]*kxk
+}
+
+var (
+	solved     endings
+	solvedOnce sync.Once
+)
+
+// solveEndings solves and writes the three piece endings once for all tests.
+func solveEndings(t *testing.T) endings {
+	t.Helper()
+
+	solvedOnce.Do(func() {
+		dir, err := os.MkdirTemp("", "syzygy")
+		if !assert.NoError(t, err) {
+			return
+		}
+		wdlDir := filepath.Join(dir, "wdl")
+		assert.NoError(t, os.Mkdir(wdlDir, 0o755))
+
+		solutions := map[Piece]*kxk{}
+		for _, p := range []Piece{Queen, Rook, Bishop, Knight, Pawn} {
+			solutions[p] = solve(p, solutions)
+		}
+
+		// the DTZ tables cover both stored sides, value maps and plies
+		writeTables(t, dir, solutions[Queen], White, flagMapped)
+		writeTables(t, dir, solutions[Rook], Black, flagWinPlies|flagLossPlies)
+		writeTables(t, dir, solutions[Bishop], White, 0)
+		writeTables(t, dir, solutions[Knight], White, 0)
+		writeTables(t, dir, solutions[Pawn], White, flagMapped|flagLossPlies)
+
+		for _, code := range []string{"KQvK", "KRvK", "KBvK", "KNvK", "KPvK"} {
+			raw, err := os.ReadFile(filepath.Join(dir, code+".rtbw"))
+			assert.NoError(t, err)
+			assert.NoError(t, os.WriteFile(filepath.Join(wdlDir, code+".rtbw"), raw, 0o644))
+		}
+
+		solved = endings{dir: dir, wdlDir: wdlDir, solutions: solutions}
+	})
+
+	if solved.dir == "" {
+		t.FailNow()
+	}
+	return solved
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if solved.dir != "" {
+		os.RemoveAll(solved.dir)
+	}
+	os.Exit(code)
+}
+
+func TestSolutions(t *testing.T) {
+	e := solveEndings(t)
+
+	// the longest wins are mates in 10 and 16 moves
+	assert.Equal(t, 19, slices.Max(e.solutions[Queen].dtz))
+	assert.Equal(t, 31, slices.Max(e.solutions[Rook].dtz))
+	assert.Equal(t, 0, slices.Max(e.solutions[Bishop].dtz))
+	assert.Equal(t, 0, slices.Max(e.solutions[Knight].dtz))
+
+	tests := []struct {
+		fen string
+		wdl WDL
+		dtz int
+	}{
+		{"k7/8/1K6/8/8/8/8/2Q5 w - - 0 1", Win, 1},
+		{"k1Q5/8/1K6/8/8/8/8/8 b - - 0 1", Loss, -1},
+		{"k7/2Q5/1K6/8/8/8/8/8 b - - 0 1", Draw, 0},
+		{"8/4P3/8/8/8/8/k7/4K3 w - - 0 1", Win, 1},
+		{"8/4P3/8/8/8/8/k7/4K3 b - - 0 1", Loss, -2},
+		{"4k3/4P3/4K3/8/8/8/8/8 b - - 0 1", Draw, 0},
+		{"8/8/8/8/8/8/1k2P3/K7 b - - 0 1", Draw, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fen, func(t *testing.T) {
+			s, n := e.solutionOf(Must(board.FromFEN(tt.fen)))
+
+			assert.Equal(t, tt.wdl, s.wdl[n])
+			assert.Equal(t, tt.dtz, s.dtz[n])
+		})
+	}
+}
+
+func TestDecompressPairs(t *testing.T) {
+	e := solveEndings(t)
+
+	tb, err := Open(e.dir)
+	assert.NoError(t, err)
+	defer tb.Close()
+
+	// every position of the pair compressed tables
+	for _, p := range []Piece{Queen, Rook, Pawn} {
+		s := e.solutions[p]
+		key, _ := parseCode("K" + string(" PNBRQ"[p]) + "vK")
+		wdl := tb.tables[wdlType][key]
+		assert.True(t, wdl.mapped())
+		assert.Zero(t, wdl.items[0][0].flags&flagSingleValue)
+
+		for n := range nodes {
+			if !s.valid[n] {
+				continue
+			}
+			d, _, idx, _ := wdl.index(s.board(n))
+			if !assert.Equal(t, int(s.wdl[n]+2), wdl.decompressPairs(d, idx), s.fen(n, false)) {
+				return
+			}
+		}
+	}
+}
+
+func TestProbeSolutions(t *testing.T) {
+	e := solveEndings(t)
+
+	for _, dir := range []string{e.dir, e.wdlDir} {
+		tb, err := Open(dir)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, tb.MaxPieces())
+
+		for _, p := range []Piece{Queen, Rook, Pawn} {
+			s := e.solutions[p]
+
+			t.Run(fmt.Sprintf("%s %s", p, filepath.Base(dir)), func(t *testing.T) {
+				r := rand.New(rand.NewPCG(uint64(p), 0))
+				ms := move.NewStore()
+
+				for i := 0; i < 2000; {
+					n := r.IntN(nodes)
+					if !s.valid[n] {
+						continue
+					}
+					i++
+					b := Must(board.FromFEN(s.fen(n, i%2 == 0)))
+
+					wdl, ok := tb.ProbeWDL(b, ms)
+					assert.True(t, ok)
+					if !assert.Equal(t, s.wdl[n], wdl, b.FEN()) {
+						return
+					}
+
+					// without DTZ tables only the draws and the zeroing wins are known
+					dtz, ok := tb.ProbeDTZ(b, ms)
+					assert.True(t, ok || dir == e.wdlDir)
+					if ok && !assert.Equal(t, s.dtz[n], dtz, b.FEN()) {
+						return
+					}
+				}
+			})
+		}
+
+		assert.NoError(t, tb.Close())
+	}
+}
+
+func TestRankSolutions(t *testing.T) {
+	e := solveEndings(t)
+
+	tests := []struct {
+		name string
+		fen  string
+	}{
+		{"mate in one", "k7/8/1K6/8/8/8/8/2Q5 w - - 0 1"},
+		{"queen", "8/8/3k4/8/8/8/8/K1Q5 w - - 0 1"},
+		{"rook", "8/8/3k4/8/8/8/8/K1R5 w - - 0 1"},
+		{"rook against", "8/8/3K4/8/8/8/8/k1r5 w - - 0 1"},
+		{"pawn", "8/8/8/3k4/8/8/4P3/4K3 w - - 0 1"},
+		{"pawn against", "4k3/8/4K3/4P3/8/8/8/8 b - - 0 1"},
+	}
+
+	for _, tt := range tests {
+		for _, dir := range []string{e.dir, e.wdlDir} {
+			t.Run(tt.name+" "+filepath.Base(dir), func(t *testing.T) {
+				tb, err := Open(dir)
+				assert.NoError(t, err)
+				defer tb.Close()
+
+				b := Must(board.FromFEN(tt.fen))
+				ms := move.NewStore()
+				moves := legalMoves(b, ms)
+
+				ranks, dtz, ok := tb.RankRootMoves(b, ms, moves)
+
+				assert.True(t, ok)
+				// drawn moves don't need the DTZ tables
+				assert.True(t, dtz || dir == e.wdlDir)
+
+				for i, m := range moves {
+					wdl := Draw
+					r := b.MakeMove(m)
+					if (b.Colors[White] | b.Colors[Black]).Count() == 3 {
+						s, n := e.solutionOf(b)
+						wdl = -s.wdl[n]
+					}
+					b.UndoMove(m, r)
+
+					assert.Equal(t, wdlRanks[wdl+2], ranks[i], m.String())
+				}
+			})
+		}
+	}
+}
+
+func TestRankFiftyMoves(t *testing.T) {
+	e := solveEndings(t)
+
+	tb, err := Open(e.dir)
+	assert.NoError(t, err)
+	defer tb.Close()
+
+	// with the fifty move counter at 90 the best move of a long win is ranked by
+	// the dtz of the position
+	s := e.solutions[Rook]
+	r := rand.New(rand.NewPCG(1, 1))
+	for i := 0; i < 20; {
+		n := r.IntN(nodes)
+		if !s.valid[n] || s.dtz[n] < 10 {
+			continue
+		}
+		i++
+
+		fen := strings.Replace(s.fen(n, i%2 == 0), " 0 1", " 90 1", 1)
+		b := Must(board.FromFEN(fen))
+		ms := move.NewStore()
+
+		ranks, dtz, ok := tb.RankRootMoves(b, ms, legalMoves(b, ms))
+
+		assert.True(t, ok)
+		assert.True(t, dtz)
+		assert.Equal(t, MaxDTZ-(s.dtz[n]+90), slices.Max(ranks), fen)
+	}
+}
+
+func legalMoves(b *board.Board, ms *move.Store) []move.Move {
+	ms.Push()
+	defer ms.Pop()
+
+	movegen.Noisy(ms, b)
+	movegen.Quiet(ms, b)
+
+	var moves []move.Move
+	for _, pseudo := range ms.Frame() {
+		r := b.MakeMove(pseudo.Move)
+		if !b.InCheck(b.STM.Flip()) {
+			moves = append(moves, pseudo.Move)
+		}
+		b.UndoMove(pseudo.Move, r)
+	}
+	return moves
+}
@@ -0,0 +1,662 @@
+// Package tablebase probes Syzygy endgame tablebases.
+//
+// WDL tables tell whether a position is won, drawn or lost with perfect play,
+// DTZ tables tell the distance in plies to the next capture or pawn move
+// (zeroing the fifty move counter) on the optimal path. Neither table type
+// considers castling rights.
+package tablebase
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/paulsonkoly/chess-3/board"
+	. "github.com/paulsonkoly/chess-3/chess"
+	"github.com/paulsonkoly/chess-3/move"
+	"github.com/paulsonkoly/chess-3/movegen"
+)
+
+// WDL is a tablebase win/draw/loss result from the side to move's point of
+// view. Cursed wins and blessed losses are wins and losses that are draws
+// under the fifty move rule.
+type WDL int
+
+const (
+	Loss        = WDL(-2)
+	BlessedLoss = WDL(-1)
+	Draw        = WDL(0)
+	CursedWin   = WDL(1)
+	Win         = WDL(2)
+)
+
+// MaxDTZ is the magnitude of root move ranks of certain wins and losses.
+const MaxDTZ = 1 << 18
+
+// Tablebase is a set of Syzygy table files. It is safe for concurrent use.
+type Tablebase struct {
+	tables    [2]map[materialKey]*table
+	maxPieces int
+}
+
+// Open opens the Syzygy tables found in the directories of paths. paths is a
+// list of directories separated by the OS specific path list separator. The
+// table files are mapped to memory on first use.
+func Open(paths string) (*Tablebase, error) {
+	tb := &Tablebase{tables: [2]map[materialKey]*table{{}, {}}}
+
+	for _, dir := range filepath.SplitList(paths) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			for typ, ext := range extensions {
+				code, ok := strings.CutSuffix(entry.Name(), ext)
+				if !ok {
+					continue
+				}
+				key, ok := parseCode(code)
+				if !ok {
+					continue
+				}
+				if _, ok := tb.tables[typ][key]; ok {
+					continue
+				}
+
+				t := newTable(filepath.Join(dir, entry.Name()), tableType(typ), key)
+				tb.tables[typ][t.key] = t
+				tb.tables[typ][t.key2] = t
+
+				if t.typ == wdlType {
+					tb.maxPieces = max(tb.maxPieces, t.pieceCount)
+				}
+			}
+		}
+	}
+
+	return tb, nil
+}
+
+// Close unmaps the table files.
+func (tb *Tablebase) Close() error {
+	var errs []error
+	for _, tables := range tb.tables {
+		for key, t := range tables {
+			if key == t.key {
+				errs = append(errs, t.close())
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// MaxPieces is the largest piece count, including kings, in the WDL tables.
+func (tb *Tablebase) MaxPieces() int { return tb.maxPieces }
+
+// probeState is the outcome of a probe.
+type probeState byte
+
+const (
+	probeFail        probeState = iota // table missing or corrupt
+	probeOK                            // the probe succeeded
+	probeChangeSTM                     // DTZ table stores the other side to move
+	probeZeroingBest                   // the best move zeroes the fifty move counter
+)
+
+// ProbeWDL probes the WDL tables for b. ok is false if the tables needed are
+// not available. ms is used for the move generation needed by the probe.
+func (tb *Tablebase) ProbeWDL(b *board.Board, ms *move.Store) (wdl WDL, ok bool) {
+	wdl, state := tb.search(b, ms, false)
+	return wdl, state != probeFail
+}
+
+// ProbeDTZ probes the DTZ tables for b. The result is the signed distance in
+// plies to a zeroing move, positive if the side to move wins, 0 for draws.
+// Cursed wins and blessed losses are offset by 100. ok is false if the tables
+// needed are not available.
+func (tb *Tablebase) ProbeDTZ(b *board.Board, ms *move.Store) (dtz int, ok bool) {
+	dtz, state := tb.probeDTZ(b, ms)
+	return dtz, state != probeFail
+}
+
+// RankRootMoves ranks moves, the legal moves of b, with the DTZ tables or, if
+// those are missing, with the WDL tables. Better moves are ranked higher. Wins
+// within the fifty move rule are ranked MaxDTZ and losses are ranked -MaxDTZ
+// unless a fifty move draw is in sight. dtz tells whether the DTZ tables were
+// used. ok is false if neither table is available.
+func (tb *Tablebase) RankRootMoves(b *board.Board, ms *move.Store, moves []move.Move) (ranks []int, dtz bool, ok bool) {
+	if ranks, ok := tb.rankDTZ(b, ms, moves); ok {
+		return ranks, true, true
+	}
+	ranks, ok = tb.rankWDL(b, ms, moves)
+	return ranks, false, ok
+}
+
+func (tb *Tablebase) rankDTZ(b *board.Board, ms *move.Store, moves []move.Move) ([]int, bool) {
+	fifty := int(b.FiftyCnt)
+	// an approximation of whether any position repeated since the last zeroing move
+	rep := b.Threefold() > 1
+	ranks := make([]int, len(moves))
+
+	for i, m := range moves {
+		r := b.MakeMove(m)
+
+		var dtz int
+		state := probeOK
+		switch {
+
+		case b.FiftyCnt == 0:
+			var wdl WDL
+			wdl, state = tb.search(b, ms, false)
+			dtz = dtzBeforeZeroing(-wdl)
+
+		case b.FiftyCnt >= 100 || b.Threefold() >= 3:
+			dtz = 0
+
+		default:
+			dtz, state = tb.probeDTZ(b, ms)
+			dtz = -dtz
+			dtz += Signum(dtz)
+		}
+
+		// a mating move is assigned dtz 1
+		if dtz == 2 && b.InCheck(b.STM) && !hasLegalMove(b, ms) {
+			dtz = 1
+		}
+
+		b.UndoMove(m, r)
+
+		if state == probeFail {
+			return nil, false
+		}
+
+		switch {
+		case dtz > 0 && dtz+fifty <= 99 && !rep:
+			ranks[i] = MaxDTZ
+		case dtz > 0:
+			ranks[i] = MaxDTZ - (dtz + fifty)
+		case dtz < 0 && -dtz*2+fifty < 100:
+			ranks[i] = -MaxDTZ
+		case dtz < 0:
+			ranks[i] = -MaxDTZ + (-dtz + fifty)
+		}
+	}
+
+	return ranks, true
+}
+
+var wdlRanks = [...]int{-MaxDTZ, -MaxDTZ + 101, 0, MaxDTZ - 101, MaxDTZ}
+
+func (tb *Tablebase) rankWDL(b *board.Board, ms *move.Store, moves []move.Move) ([]int, bool) {
+	ranks := make([]int, len(moves))
+
+	for i, m := range moves {
+		r := b.MakeMove(m)
+
+		wdl := Draw
+		state := probeOK
+		if b.FiftyCnt < 100 && b.Threefold() < 3 {
+			wdl, state = tb.search(b, ms, false)
+			wdl = -wdl
+		}
+
+		b.UndoMove(m, r)
+
+		if state == probeFail {
+			return nil, false
+		}
+
+		ranks[i] = wdlRanks[wdl+2]
+	}
+
+	return ranks, true
+}
+
+func dtzBeforeZeroing(wdl WDL) int {
+	switch wdl {
+	case Win:
+		return 1
+	case CursedWin:
+		return 101
+	case BlessedLoss:
+		return -101
+	case Loss:
+		return -1
+	}
+	return 0
+}
+
+// search is the WDL score of b taking into account the captures, and if
+// checkZeroing is set the pawn moves. Tables do not store positions with en
+// passant rights and store "don't care" values for some positions where the
+// best move is zeroing.
+func (tb *Tablebase) search(b *board.Board, ms *move.Store, checkZeroing bool) (WDL, probeState) {
+	ms.Push()
+	defer ms.Pop()
+
+	movegen.Noisy(ms, b)
+	movegen.Quiet(ms, b)
+
+	best := Loss
+	legal, zeroing := 0, 0
+	for _, pseudo := range ms.Frame() {
+		m := pseudo.Move
+		capture := b.Captured(m) != NoPiece
+		pawn := b.SquaresToPiece[m.From()] == Pawn
+
+		r := b.MakeMove(m)
+		if b.InCheck(b.STM.Flip()) {
+			b.UndoMove(m, r)
+			continue
+		}
+		legal++
+
+		if !capture && (!checkZeroing || !pawn) {
+			b.UndoMove(m, r)
+			continue
+		}
+		zeroing++
+
+		value, state := tb.search(b, ms, false)
+		value = -value
+		b.UndoMove(m, r)
+
+		if state == probeFail {
+			return Draw, probeFail
+		}
+
+		if value > best {
+			best = value
+			if value >= Win {
+				return value, probeZeroingBest
+			}
+		}
+	}
+
+	// all legal moves are zeroing, no need to probe
+	noMoreMoves := zeroing > 0 && zeroing == legal
+
+	var value WDL
+	if noMoreMoves {
+		value = best
+	} else {
+		v, state := tb.probeTable(b, wdlType, Draw)
+		if state == probeFail {
+			return Draw, probeFail
+		}
+		value = WDL(v)
+	}
+
+	if best >= value {
+		if best > Draw || noMoreMoves {
+			return best, probeZeroingBest
+		}
+		return best, probeOK
+	}
+
+	return value, probeOK
+}
+
+func (tb *Tablebase) probeDTZ(b *board.Board, ms *move.Store) (int, probeState) {
+	wdl, state := tb.search(b, ms, true)
+	if state == probeFail || wdl == Draw {
+		return 0, state
+	}
+
+	if state == probeZeroingBest {
+		return dtzBeforeZeroing(wdl), state
+	}
+
+	dtz, state := tb.probeTable(b, dtzType, wdl)
+	switch state {
+
+	case probeFail:
+		return 0, state
+
+	case probeChangeSTM:
+
+	default:
+		if wdl == BlessedLoss || wdl == CursedWin {
+			dtz += 100
+		}
+		return dtz * Signum(int(wdl)), state
+	}
+
+	// The table stores the other side to move, find the best move with a 1 ply
+	// search.
+	ms.Push()
+	defer ms.Pop()
+
+	movegen.Noisy(ms, b)
+	movegen.Quiet(ms, b)
+
+	minDTZ := 0xffff
+	for _, pseudo := range ms.Frame() {
+		m := pseudo.Move
+		zeroing := b.Captured(m) != NoPiece || b.SquaresToPiece[m.From()] == Pawn
+
+		r := b.MakeMove(m)
+		if b.InCheck(b.STM.Flip()) {
+			b.UndoMove(m, r)
+			continue
+		}
+
+		if zeroing {
+			var w WDL
+			w, state = tb.search(b, ms, false)
+			dtz = -dtzBeforeZeroing(w)
+		} else {
+			dtz, state = tb.probeDTZ(b, ms)
+			dtz = -dtz
+		}
+
+		if dtz == 1 && b.InCheck(b.STM) && !hasLegalMove(b, ms) {
+			minDTZ = 1
+		}
+
+		if !zeroing {
+			dtz += Signum(dtz)
+		}
+
+		if dtz < minDTZ && Signum(dtz) == Signum(int(wdl)) {
+			minDTZ = dtz
+		}
+
+		b.UndoMove(m, r)
+
+		if state == probeFail {
+			return 0, state
+		}
+	}
+
+	// no legal moves, we are mated
+	if minDTZ == 0xffff {
+		return -1, probeOK
+	}
+	return minDTZ, probeOK
+}
+
+// probeTable looks up b in the table of typ. wdl is the WDL score of b, it is
+// needed for DTZ lookups.
+func (tb *Tablebase) probeTable(b *board.Board, typ tableType, wdl WDL) (int, probeState) {
+	occ := b.Colors[White] | b.Colors[Black]
+	if occ.Count() == 2 {
+		return int(Draw), probeOK
+	}
+
+	key := keyOf(b)
+	t := tb.tables[typ][key]
+	if t == nil || !t.mapped() {
+		return 0, probeFail
+	}
+
+	d, file, idx, ok := t.index(b)
+	if !ok {
+		return 0, probeChangeSTM
+	}
+
+	return t.mapScore(file, t.decompressPairs(d, idx), wdl), probeOK
+}
+
+// index is the sub-table of b in t, the leading pawn file and the index of b
+// in the sub-table. ok is false if t is a DTZ table storing the other side to
+// move.
+func (t *table) index(b *board.Board) (d *pairsData, file int, idx uint64, ok bool) {
+	occ := b.Colors[White] | b.Colors[Black]
+
+	// Tables are stored with the stronger side as white. Symmetric tables are
+	// stored for white to move only. Otherwise we flip colors and squares.
+	flip := keyOf(b) != t.key || (t.key == t.key2 && b.STM == Black)
+	flipColor, flipSquares := byte(0), 0
+	stm := int(b.STM)
+	if flip {
+		flipColor, flipSquares = 8, 56
+		stm ^= 1
+	}
+
+	var (
+		squares   [maxPieces]int
+		pieces    [maxPieces]byte
+		leadPawns BitBoard
+	)
+	size, leadCnt := 0, 0
+
+	// Pawn tables are split by the file of the leading pawn, the pawn with the
+	// highest mapPawns value.
+	if t.hasPawns {
+		color := Color(t.items[0][0].pieces[0]^flipColor) >> 3
+		leadPawns = b.Colors[color] & b.Pieces[Pawn]
+		for bb := leadPawns; bb != 0; bb &= bb - 1 {
+			squares[size] = int(bb.LowestSet()) ^ flipSquares
+			size++
+		}
+		leadCnt = size
+
+		lead := 0
+		for i := 1; i < leadCnt; i++ {
+			if mapPawns[squares[i]] > mapPawns[squares[lead]] {
+				lead = i
+			}
+		}
+		squares[0], squares[lead] = squares[lead], squares[0]
+
+		file = min(squares[0]&7, 7-squares[0]&7)
+	}
+
+	if t.typ == dtzType {
+		flags := t.get(stm, file).flags
+		if int(flags&flagSTM) != stm && (t.key != t.key2 || t.hasPawns) {
+			return nil, 0, 0, false
+		}
+	}
+
+	for bb := occ &^ leadPawns; bb != 0; bb &= bb - 1 {
+		sq := bb.LowestSet()
+		pc := byte(b.SquaresToPiece[sq])
+		if b.Colors[Black]&BitBoardFromSquares(sq) != 0 {
+			pc |= 8
+		}
+		squares[size] = int(sq) ^ flipSquares
+		pieces[size] = pc ^ flipColor
+		size++
+	}
+
+	d = t.get(stm, file)
+
+	// reorder the pieces to the table's piece order
+	for i := leadCnt; i < size-1; i++ {
+		for j := i + 1; j < size; j++ {
+			if d.pieces[i] == pieces[j] {
+				pieces[i], pieces[j] = pieces[j], pieces[i]
+				squares[i], squares[j] = squares[j], squares[i]
+				break
+			}
+		}
+	}
+
+	// the leading piece is mapped to the a-d files
+	if squares[0]&7 > int(DFile) {
+		for i := range size {
+			squares[i] ^= 7
+		}
+	}
+
+	idx = t.encodeLeading(d, squares[:size], leadCnt)
+	idx *= d.groupIdx[0]
+
+	// remaining groups in ascending square order
+	remainingPawns := t.hasPawns && t.pawnCount[1] > 0
+	g := d.groupLen[0]
+	for next := 1; d.groupLen[next] != 0; next++ {
+		group := squares[g : g+d.groupLen[next]]
+		sortInts(group)
+
+		n := uint64(0)
+		for i, sq := range group {
+			adjust := 0
+			for _, prev := range squares[:g] {
+				if sq > prev {
+					adjust++
+				}
+			}
+			if remainingPawns {
+				adjust += 8
+			}
+			n += binomial[i+1][sq-adjust]
+		}
+
+		remainingPawns = false
+		idx += n * d.groupIdx[next]
+		g += d.groupLen[next]
+	}
+
+	return d, file, idx, true
+}
+
+// encodeLeading is the index of the leading group.
+func (t *table) encodeLeading(d *pairsData, squares []int, leadCnt int) uint64 {
+	if t.hasPawns {
+		idx := leadPawnIdx[leadCnt][squares[0]]
+
+		lead := squares[1:leadCnt]
+		for i := 1; i < len(lead); i++ {
+			for j := i; j > 0 && mapPawns[lead[j]] < mapPawns[lead[j-1]]; j-- {
+				lead[j], lead[j-1] = lead[j-1], lead[j]
+			}
+		}
+
+		for i := 1; i < leadCnt; i++ {
+			idx += binomial[i][mapPawns[squares[i]]]
+		}
+		return idx
+	}
+
+	// the leading piece is mapped below rank 5
+	if squares[0]>>3 > int(FourthRank) {
+		for i := range squares {
+			squares[i] ^= 56
+		}
+	}
+
+	// the first piece of the leading group off the a1-h8 diagonal is mapped
+	// below the diagonal
+	for i := range d.groupLen[0] {
+		off := offA1H8(squares[i])
+		if off == 0 {
+			continue
+		}
+		if off > 0 {
+			for j := i; j < len(squares); j++ {
+				squares[j] = (squares[j]>>3 | squares[j]<<3) & 63
+			}
+		}
+		break
+	}
+
+	if !t.hasUniquePieces {
+		return mapKK[mapA1D1D4[squares[0]]][squares[1]]
+	}
+
+	s0, s1, s2 := squares[0], squares[1], squares[2]
+	adjust1 := b2i(s1 > s0)
+	adjust2 := b2i(s2 > s0) + b2i(s2 > s1)
+
+	switch {
+
+	case offA1H8(s0) != 0:
+		return uint64((mapA1D1D4[s0]*63+s1-adjust1)*62 + s2 - adjust2)
+
+	case offA1H8(s1) != 0:
+		return uint64((6*63+(s0>>3)*28+mapB1H1H7[s1])*62 + s2 - adjust2)
+
+	case offA1H8(s2) != 0:
+		return uint64(6*63*62 + 4*28*62 + (s0>>3)*7*28 + ((s1>>3)-adjust1)*28 + mapB1H1H7[s2])
+
+	default:
+		return uint64(6*63*62 + 4*28*62 + 4*7*28 + (s0>>3)*6*7 + ((s1>>3)-adjust1)*6 + (s2 >> 3) - adjust2)
+	}
+}
+
+func sortInts(s []int) {
+	for i := 1; i < len(s); i++ {
+		for j := i; j > 0 && s[j] < s[j-1]; j-- {
+			s[j], s[j-1] = s[j-1], s[j]
+		}
+	}
+}
+
+func b2i(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func hasLegalMove(b *board.Board, ms *move.Store) bool {
+	ms.Push()
+	defer ms.Pop()
+
+	movegen.Noisy(ms, b)
+	movegen.Quiet(ms, b)
+
+	for _, pseudo := range ms.Frame() {
+		r := b.MakeMove(pseudo.Move)
+		legal := !b.InCheck(b.STM.Flip())
+		b.UndoMove(pseudo.Move, r)
+		if legal {
+			return true
+		}
+	}
+	return false
+}
+
+// materialKey identifies a material configuration. It has 4 bits of count for
+// each non-king piece type, white in the low 32 bits, black in the high 32
+// bits.
+type materialKey uint64
+
+func keyOf(b *board.Board) materialKey {
+	var key materialKey
+	for color := White; color <= Black; color++ {
+		for p := Pawn; p < King; p++ {
+			key |= materialKey(b.Counts[color][p]&0xf) << (32*int(color) + 4*int(p))
+		}
+	}
+	return key
+}
+
+func (k materialKey) flip() materialKey { return k>>32 | k<<32 }
+
+func (k materialKey) counts(color Color) (counts [Pieces]int) {
+	for p := Pawn; p < King; p++ {
+		counts[p] = int(k >> (32*int(color) + 4*int(p)) & 0xf)
+	}
+	return
+}
+
+// parseCode parses a table name like KRPvKR into the material key with the
+// first listed pieces as white.
+func parseCode(code string) (materialKey, bool) {
+	white, black, ok := strings.Cut(code, "v")
+	if !ok || !strings.HasPrefix(white, "K") || !strings.HasPrefix(black, "K") {
+		return 0, false
+	}
+
+	var key materialKey
+	count := 0
+	for color, side := range []string{white[1:], black[1:]} {
+		for _, c := range side {
+			p := strings.IndexRune(" PNBRQ", c)
+			if p <= int(NoPiece) {
+				return 0, false
+			}
+			key += 1 << (32*color + 4*p)
+			count++
+		}
+	}
+
+	return key, count+2 <= maxPieces
+}
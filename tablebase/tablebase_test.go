@@ -0,0 +1,232 @@
+package tablebase
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/paulsonkoly/chess-3/board"
+	. "github.com/paulsonkoly/chess-3/chess"
+	"github.com/paulsonkoly/chess-3/move"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodingTables(t *testing.T) {
+	seen := map[uint64]bool{}
+	for idx := range mapKK {
+		for _, code := range mapKK[idx] {
+			seen[code] = true
+		}
+	}
+	assert.Len(t, seen, 462)
+
+	assert.Equal(t, 9, mapA1D1D4[D4])
+	assert.Equal(t, 27, mapB1H1H7[H7])
+	assert.Equal(t, uint64(20), binomial[3][6])
+	assert.Equal(t, 47, mapPawns[A2])
+	assert.Equal(t, 0, mapPawns[E7])
+
+	for f := range 4 {
+		assert.Equal(t, uint64(6), leadPawnsSize[1][f])
+	}
+}
+
+func TestParseCode(t *testing.T) {
+	tests := []struct {
+		code  string
+		white [Pieces]int
+		black [Pieces]int
+		ok    bool
+	}{
+		{"KQvK", [Pieces]int{Queen: 1}, [Pieces]int{}, true},
+		{"KRPvKR", [Pieces]int{Rook: 1, Pawn: 1}, [Pieces]int{Rook: 1}, true},
+		{"KBNvK", [Pieces]int{Bishop: 1, Knight: 1}, [Pieces]int{}, true},
+		{"KPPPPPvKP", [Pieces]int{}, [Pieces]int{}, false},
+		{"KQK", [Pieces]int{}, [Pieces]int{}, false},
+		{"KXvK", [Pieces]int{}, [Pieces]int{}, false},
+		{"KKvK", [Pieces]int{}, [Pieces]int{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			key, ok := parseCode(tt.code)
+
+			assert.Equal(t, tt.ok, ok)
+			if ok {
+				assert.Equal(t, tt.white, key.counts(White))
+				assert.Equal(t, tt.black, key.counts(Black))
+				assert.Equal(t, tt.black, key.flip().counts(White))
+			}
+		})
+	}
+}
+
+// writeKQvK writes single value KQvK tables to dir. WDL values are given for
+// white and black to move, the DTZ table stores white to move.
+func writeKQvK(t *testing.T, dir string, whiteWDL, blackWDL WDL, dtz byte) {
+	t.Helper()
+
+	// magic, split header, piece order, the pieces Q K k, padding
+	header := []byte{0x01, 0x00, 0x55, 0x66, 0xee, 0x00}
+
+	wdl := append(append(magics[wdlType][:], header...),
+		flagSingleValue, byte(whiteWDL+2), flagSingleValue, byte(blackWDL+2))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "KQvK.rtbw"), wdl, 0o644))
+
+	dtzData := append(append(magics[dtzType][:], header...), flagSingleValue, dtz)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "KQvK.rtbz"), dtzData, 0o644))
+}
+
+func TestOpen(t *testing.T) {
+	dir := t.TempDir()
+	writeKQvK(t, dir, Win, Loss, 5)
+	for _, name := range []string{"KRPvKR.rtbw", "KRRvKRR.rtbz", "KQvK.txt", "readme.rtbw"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0o644))
+	}
+
+	tb, err := Open(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, tb.MaxPieces())
+	assert.NoError(t, tb.Close())
+
+	_, err = Open(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
+
+func TestProbeWDL(t *testing.T) {
+	dir := t.TempDir()
+	writeKQvK(t, dir, Win, Loss, 5)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "KRvK.rtbw"), []byte("corrupt"), 0o644))
+
+	tb, err := Open(dir)
+	assert.NoError(t, err)
+	defer tb.Close()
+
+	tests := []struct {
+		name string
+		fen  string
+		wdl  WDL
+		ok   bool
+	}{
+		{"white to move", "7k/8/8/8/8/8/8/KQ6 w - - 0 1", Win, true},
+		{"black to move", "7k/8/8/8/8/8/8/KQ6 b - - 0 1", Loss, true},
+		{"colors flipped", "kq6/8/8/8/8/8/8/7K b - - 0 1", Win, true},
+		{"colors flipped other side", "kq6/8/8/8/8/8/8/7K w - - 0 1", Loss, true},
+		{"hanging queen", "7k/7Q/8/8/8/8/8/K7 b - - 0 1", Draw, true},
+		{"bare kings", "7k/8/8/8/8/8/8/K7 w - - 0 1", Draw, true},
+		{"corrupt table", "7k/8/8/8/8/8/8/KR6 w - - 0 1", Draw, false},
+		{"missing table", "7k/8/8/8/8/8/8/KN6 w - - 0 1", Draw, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := Must(board.FromFEN(tt.fen))
+
+			wdl, ok := tb.ProbeWDL(b, move.NewStore())
+
+			assert.Equal(t, tt.ok, ok)
+			if ok {
+				assert.Equal(t, tt.wdl, wdl)
+			}
+		})
+	}
+}
+
+func TestProbeDTZ(t *testing.T) {
+	dir := t.TempDir()
+	writeKQvK(t, dir, Win, Loss, 5)
+
+	tb, err := Open(dir)
+	assert.NoError(t, err)
+	defer tb.Close()
+
+	tests := []struct {
+		name string
+		fen  string
+		dtz  int
+	}{
+		{"stored side to move", "7k/8/8/8/8/8/8/KQ6 w - - 0 1", 11},
+		{"other side to move", "7k/8/8/8/8/8/8/KQ6 b - - 0 1", -12},
+		{"hanging queen", "7k/7Q/8/8/8/8/8/K7 b - - 0 1", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := Must(board.FromFEN(tt.fen))
+
+			dtz, ok := tb.ProbeDTZ(b, move.NewStore())
+
+			assert.True(t, ok)
+			assert.Equal(t, tt.dtz, dtz)
+		})
+	}
+}
+
+func TestRankRootMoves(t *testing.T) {
+	dir := t.TempDir()
+	writeKQvK(t, dir, Win, Loss, 5)
+
+	tb, err := Open(dir)
+	assert.NoError(t, err)
+	defer tb.Close()
+
+	b := Must(board.FromFEN("7k/8/8/8/8/8/8/KQ6 w - - 0 1"))
+	hang := move.From(B1) | move.To(H7)
+	moves := []move.Move{move.From(B1) | move.To(B7), hang, move.From(A1) | move.To(A2)}
+
+	ranks, dtz, ok := tb.RankRootMoves(b, move.NewStore(), moves)
+
+	assert.True(t, ok)
+	assert.True(t, dtz)
+	assert.Equal(t, []int{MaxDTZ, 0, MaxDTZ}, ranks)
+}
+
+// syzygyDir holds tables made by the Syzygy generator for TestRealTables.
+// make syzygy downloads them.
+const syzygyDir = "testdata/syzygy"
+
+// TestRealTables probes real KRvK and KPvK tables against known results. The
+// promotions probe KQvK.
+func TestRealTables(t *testing.T) {
+	for _, name := range []string{"KQvK.rtbw", "KQvK.rtbz", "KRvK.rtbw", "KRvK.rtbz", "KPvK.rtbw", "KPvK.rtbz"} {
+		if _, err := os.Stat(filepath.Join(syzygyDir, name)); err != nil {
+			t.Skipf("%s is missing, run make syzygy", name)
+		}
+	}
+
+	tb, err := Open(syzygyDir)
+	assert.NoError(t, err)
+	defer tb.Close()
+
+	tests := []struct {
+		name string
+		fen  string
+		wdl  WDL
+		dtz  int
+	}{
+		{"rook mates in one", "k7/8/1K6/8/8/8/8/7R w - - 0 1", Win, 1},
+		{"lone king to move", "k7/8/1K6/8/8/8/8/7R b - - 0 1", Loss, -2},
+		{"hanging rook", "k7/1R6/8/8/8/8/8/7K b - - 0 1", Draw, 0},
+		{"promotion mates", "k7/2P5/1K6/8/8/8/8/8 w - - 0 1", Win, 1},
+		{"stalemate", "k7/2P5/1K6/8/8/8/8/8 b - - 0 1", Draw, 0},
+		{"rook pawn", "k7/8/8/8/8/8/P7/K7 w - - 0 1", Draw, 0},
+		{"king on the sixth", "4k3/8/4K3/4P3/8/8/8/8 w - - 0 1", Win, 3},
+		{"king on the sixth black to move", "4k3/8/4K3/4P3/8/8/8/8 b - - 0 1", Loss, -4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := Must(board.FromFEN(tt.fen))
+
+			wdl, ok := tb.ProbeWDL(b, move.NewStore())
+
+			assert.True(t, ok)
+			assert.Equal(t, tt.wdl, wdl)
+
+			dtz, ok := tb.ProbeDTZ(b, move.NewStore())
+
+			assert.True(t, ok)
+			assert.Equal(t, tt.dtz, dtz)
+		})
+	}
+}
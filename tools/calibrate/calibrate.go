@@ -0,0 +1,393 @@
+// calibrate measures the playing strength of the UCI_Elo handicaps by
+// self-play. Each Elo anchor plays the next stronger anchor, and the strongest
+// anchor plays the full strength engine. The Elo differences are chained down
+// from the strongest anchor, which keeps its nominal Elo.
+//
+// The engines are uci drivers in the same process, playing pairs of games
+// from random openings with colors reversed. The result of each match is
+// printed with a 95% confidence interval, followed by the measured Elo of each
+// anchor in the format of the handicap table.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/paulsonkoly/chess-3/board"
+	"github.com/paulsonkoly/chess-3/chess"
+	"github.com/paulsonkoly/chess-3/move"
+	"github.com/paulsonkoly/chess-3/movegen"
+	"github.com/paulsonkoly/chess-3/uci"
+)
+
+// maxPlies is the game length adjudicated as a draw.
+const maxPlies = 400
+
+func main() {
+	var (
+		elos         string
+		games        int
+		tc           string
+		openingPlies int
+		hash         int
+		seed         uint64
+	)
+
+	flag.StringVar(&elos, "elos", "1000,1200,1400,1600,1800,2000,2200,2400,2600,2800", "comma separated UCI_Elo anchors")
+	flag.IntVar(&games, "games", 200, "number of games per match")
+	flag.StringVar(&tc, "tc", "5+0.05", "time control in seconds, base+increment")
+	flag.IntVar(&openingPlies, "openingPlies", 8, "number of random opening moves")
+	flag.IntVar(&hash, "hash", 16, "hash size in MB")
+	flag.Uint64Var(&seed, "seed", 1, "random seed of the openings")
+
+	flag.Parse()
+
+	anchors, err := parseElos(elos)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	clock, err := parseTC(tc)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	setup := func(elo int) []string {
+		s := []string{fmt.Sprintf("setoption name Hash value %d", hash)}
+		if elo > 0 {
+			s = append(s, "setoption name UCI_LimitStrength value true", fmt.Sprintf("setoption name UCI_Elo value %d", elo))
+		}
+		return s
+	}
+
+	r := rand.New(rand.NewPCG(seed, 0x6a09_e667_f3bc_c908))
+
+	fmt.Printf("tc %s, %d games per match, %d random opening plies\n", tc, games, openingPlies)
+
+	// diffs[i] is the Elo of anchor i+1, or full strength, above anchor i
+	diffs := make([]result, len(anchors))
+	for i, elo := range anchors {
+		stronger := 0 // full strength
+		name := "full"
+		if i+1 < len(anchors) {
+			stronger = anchors[i+1]
+			name = strconv.Itoa(stronger)
+		}
+
+		m := match(setup(stronger), setup(elo), games, openingPlies, clock, r)
+		diffs[i] = m
+
+		lo, mid, hi := m.elo()
+		fmt.Printf("%s vs %d: +%d =%d -%d, %.0f [%.0f, %.0f]\n", name, elo, m.wins, m.draws, m.losses, mid, lo, hi)
+	}
+
+	// chain the differences down from the strongest anchor
+	top := len(anchors) - 1
+	measured := make([]float64, len(anchors))
+	variance := make([]float64, len(anchors))
+	measured[top] = float64(anchors[top])
+	for i := top - 1; i >= 0; i-- {
+		_, d, _ := diffs[i].elo()
+		measured[i] = measured[i+1] - d
+		variance[i] = variance[i+1] + diffs[i].eloVariance()
+	}
+
+	_, full, _ := diffs[top].elo()
+	fmt.Printf("full strength %.0f +- %.0f\n", measured[top]+full, 1.96*math.Sqrt(diffs[top].eloVariance()))
+	for i, elo := range anchors {
+		fmt.Printf("UCI_Elo %d: %.0f +- %.0f\n", elo, measured[i], 1.96*math.Sqrt(variance[i]))
+	}
+}
+
+func parseElos(s string) ([]int, error) {
+	var elos []int
+	for f := range strings.SplitSeq(s, ",") {
+		elo, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil {
+			return nil, err
+		}
+		if len(elos) > 0 && elo <= elos[len(elos)-1] {
+			return nil, fmt.Errorf("elos are not increasing %s", s)
+		}
+		elos = append(elos, elo)
+	}
+	if len(elos) == 0 {
+		return nil, fmt.Errorf("no elos %q", s)
+	}
+	return elos, nil
+}
+
+// timeControl is the base time and the increment per move.
+type timeControl struct {
+	base, inc time.Duration
+}
+
+func parseTC(s string) (timeControl, error) {
+	baseS, incS, _ := strings.Cut(s, "+")
+	base, err := strconv.ParseFloat(baseS, 64)
+	if err != nil {
+		return timeControl{}, err
+	}
+	inc := 0.0
+	if incS != "" {
+		if inc, err = strconv.ParseFloat(incS, 64); err != nil {
+			return timeControl{}, err
+		}
+	}
+	return timeControl{time.Duration(base * float64(time.Second)), time.Duration(inc * float64(time.Second))}, nil
+}
+
+// result is the match result from the first player's point of view.
+type result struct {
+	wins, draws, losses int
+}
+
+func (r result) games() int { return r.wins + r.draws + r.losses }
+
+func (r result) score() float64 {
+	return (float64(r.wins) + float64(r.draws)/2) / float64(r.games())
+}
+
+// elo is the Elo difference of the result with its 95% confidence interval.
+func (r result) elo() (lo, mid, hi float64) {
+	s := r.score()
+	sd := 1.96 * math.Sqrt(r.scoreVariance())
+	return toElo(s - sd), toElo(s), toElo(s + sd)
+}
+
+// scoreVariance is the variance of the mean game score.
+func (r result) scoreVariance() float64 {
+	s, n := r.score(), float64(r.games())
+	v := (float64(r.wins)*(1-s)*(1-s) + float64(r.draws)*(0.5-s)*(0.5-s) + float64(r.losses)*s*s) / n
+	return v / n
+}
+
+// eloVariance is the variance of the Elo difference by the delta method.
+func (r result) eloVariance() float64 {
+	s := min(max(r.score(), 0.01), 0.99)
+	d := 400 / math.Ln10 / (s * (1 - s))
+	return d * d * r.scoreVariance()
+}
+
+// toElo is the Elo difference of the expected score s.
+func toElo(s float64) float64 {
+	s = min(max(s, 0.001), 0.999)
+	return -400 * math.Log10(1/s-1)
+}
+
+// match plays games between players set up with a and b, in pairs of games
+// from the same opening with colors reversed.
+func match(a, b []string, games, openingPlies int, tc timeControl, r *rand.Rand) result {
+	pa, pb := newPlayer(a), newPlayer(b)
+	defer pa.close()
+	defer pb.close()
+
+	res := result{}
+	for g := range games {
+		var opening []move.Move
+		if g%2 == 0 {
+			opening = randomOpening(openingPlies, r)
+		}
+
+		white, black, sign := pa, pb, 1
+		if g%2 == 1 {
+			white, black, sign = pb, pa, -1
+		}
+
+		switch play(white, black, opening, tc) * sign {
+		case 1:
+			res.wins++
+		case -1:
+			res.losses++
+		default:
+			res.draws++
+		}
+	}
+	return res
+}
+
+// play plays a game from the opening moves, and returns 1 if white won, -1 if
+// black won and 0 for a draw.
+func play(white, black *player, opening []move.Move, tc timeControl) int {
+	b := board.StartPos()
+	ms := move.NewStore()
+	moves := make([]string, 0, maxPlies)
+	for _, m := range opening {
+		b.MakeMove(m)
+		moves = append(moves, m.String())
+	}
+
+	white.send("ucinewgame")
+	black.send("ucinewgame")
+
+	clocks := [2]time.Duration{tc.base, tc.base}
+	players := [2]*player{white, black}
+
+	for {
+		if len(legalMoves(ms, b)) == 0 {
+			if b.InCheck(b.STM) {
+				return winner(b.STM.Flip() == chess.White)
+			}
+			return 0
+		}
+		if b.FiftyCnt >= 100 || b.Threefold() >= 3 || b.InsufficientMaterial() || len(moves) >= maxPlies {
+			return 0
+		}
+
+		stm := b.STM
+		p := players[stm]
+		p.send("position startpos moves " + strings.Join(moves, " "))
+
+		start := time.Now()
+		p.send(fmt.Sprintf("go wtime %d btime %d winc %d binc %d",
+			clocks[0].Milliseconds(), clocks[1].Milliseconds(), tc.inc.Milliseconds(), tc.inc.Milliseconds()))
+		uciM := p.bestMove()
+
+		clocks[stm] -= time.Since(start)
+		if clocks[stm] < 0 {
+			return winner(stm.Flip() == chess.White)
+		}
+		clocks[stm] += tc.inc
+
+		m, err := b.ParseUCIMove(uciM)
+		if err != nil || !isLegal(ms, b, m) {
+			fmt.Fprintf(os.Stderr, "illegal move %s in %s\n", uciM, b.FEN())
+			return winner(stm.Flip() == chess.White)
+		}
+
+		b.MakeMove(m)
+		moves = append(moves, uciM)
+	}
+}
+
+// winner is the game result of white winning if white is set, black winning
+// otherwise.
+func winner(white bool) int {
+	if white {
+		return 1
+	}
+	return -1
+}
+
+// randomOpening is a sequence of random legal moves from the start position
+// that doesn't end the game.
+func randomOpening(plies int, r *rand.Rand) []move.Move {
+	ms := move.NewStore()
+	for {
+		b := board.StartPos()
+		opening := make([]move.Move, 0, plies)
+		for range plies {
+			legal := legalMoves(ms, b)
+			if len(legal) == 0 {
+				break
+			}
+			m := legal[r.IntN(len(legal))]
+			b.MakeMove(m)
+			opening = append(opening, m)
+		}
+
+		if len(opening) == plies && len(legalMoves(ms, b)) > 0 {
+			return opening
+		}
+	}
+}
+
+// legalMoves is the legal moves in b.
+func legalMoves(ms *move.Store, b *board.Board) []move.Move {
+	ms.Push()
+	defer ms.Pop()
+
+	movegen.Noisy(ms, b)
+	movegen.Quiet(ms, b)
+
+	legal := []move.Move{}
+	for _, pseudo := range ms.Frame() {
+		r := b.MakeMove(pseudo.Move)
+		if !b.InCheck(b.STM.Flip()) {
+			legal = append(legal, pseudo.Move)
+		}
+		b.UndoMove(pseudo.Move, r)
+	}
+	return legal
+}
+
+func isLegal(ms *move.Store, b *board.Board, m move.Move) bool {
+	for _, l := range legalMoves(ms, b) {
+		if l == m {
+			return true
+		}
+	}
+	return false
+}
+
+// player is a uci driver talking through pipes.
+type player struct {
+	in  io.WriteCloser
+	out *bufio.Scanner
+}
+
+// newPlayer starts a uci driver, and sends it the setup commands.
+func newPlayer(setup []string) *player {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+
+	d := uci.NewDriver(uci.WithInput(inR), uci.WithOutput(outW), uci.WithError(os.Stderr))
+	go func() {
+		d.Run()
+		outW.Close()
+	}()
+
+	p := &player{in: inW, out: bufio.NewScanner(outR)}
+	p.send("uci")
+	p.await("uciok")
+	for _, cmd := range setup {
+		p.send(cmd)
+	}
+	p.send("isready")
+	p.await("readyok")
+
+	return p
+}
+
+func (p *player) send(cmd string) {
+	if _, err := io.WriteString(p.in, cmd+"\n"); err != nil {
+		panic(err)
+	}
+}
+
+// await reads the output until a line starting with prefix, and returns the
+// line.
+func (p *player) await(prefix string) string {
+	for p.out.Scan() {
+		if line := p.out.Text(); strings.HasPrefix(line, prefix) {
+			return line
+		}
+	}
+	panic(fmt.Sprintf("engine output ended waiting for %s", prefix))
+}
+
+// bestMove is the best move of the search started by go.
+func (p *player) bestMove() string {
+	fields := strings.Fields(p.await("bestmove"))
+	if len(fields) < 2 {
+		return ""
+	}
+	return fields[1]
+}
+
+func (p *player) close() {
+	p.send("quit")
+	p.in.Close()
+	for p.out.Scan() {
+	}
+}
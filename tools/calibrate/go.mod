@@ -0,0 +1,9 @@
+module github.com/paulsonkoly/chess-3/tools/calibrate
+
+go 1.26.0
+
+require github.com/paulsonkoly/chess-3 v0.0.0
+
+require golang.org/x/exp v0.0.0-20250218142911-aa4b98e5adaa // indirect
+
+replace github.com/paulsonkoly/chess-3 => ../../
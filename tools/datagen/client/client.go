@@ -1,6 +1,8 @@
 package client
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
@@ -8,10 +10,8 @@ import (
 	"sync"
 
 	"github.com/paulsonkoly/chess-3/chess"
-	"github.com/paulsonkoly/chess-3/move"
-	"github.com/paulsonkoly/chess-3/search"
+	"github.com/paulsonkoly/chess-3/engine"
 	"github.com/paulsonkoly/chess-3/tools/datagen/shim"
-	"github.com/paulsonkoly/chess-3/transp"
 )
 
 const gameLength = 128
@@ -56,15 +56,11 @@ func Run(args []string) {
 }
 
 type Generator struct {
-	search    *search.Search
-	moveStore *move.Store
+	engine *engine.Engine
 }
 
 func NewGenerator() Generator {
-	s := search.New(1 * transp.MegaBytes)
-	ms := move.NewStore()
-
-	return Generator{search: s, moveStore: ms}
+	return Generator{engine: engine.New()}
 }
 
 func (g Generator) Games(config shim.Config, client shim.Client) {
@@ -86,34 +82,48 @@ func (g Generator) Games(config shim.Config, client shim.Client) {
 }
 
 func (g Generator) Game(config shim.Config, client shim.Client) (ok bool, err error) {
-	g.search.Clear()
-
-	b, err := client.RequestOpening()
+	opening, err := client.RequestOpening()
 	if err != nil {
 		return true, err
 	}
-	if b == nil {
+	if opening == nil {
 		return false, nil
 	}
 
+	g.engine.NewGame()
+	if err := g.engine.SetPosition(opening.FEN, opening.Moves); err != nil {
+		return true, err
+	}
+
+	limits := engine.Limits{SoftNodes: config.SoftNodes, Nodes: config.HardNodes}
+
 	positions := make([]shim.Position, 0, gameLength)
 	drawCounter := 0
 	winCounter := 0
 	winSign := chess.Score(1)
 	var score chess.Score
+	var stm chess.Color
 
 	for moveCounter := 0; ; moveCounter++ {
-		var bm move.Move
-		score, bm, _ = g.search.Go(b,
-			search.WithSoftNodes(config.SoftNodes),
-			search.WithNodes(config.HardNodes),
-			search.WithOutput(nil))
-
-		positions = append(positions, shim.Position{FEN: b.FEN(), BM: bm, Score: score})
-
-		if bm == 0 {
+		b := g.engine.Board()
+		stm = b.STM
+
+		result, err := g.engine.Think(context.Background(), limits)
+		if errors.Is(err, engine.ErrNoMoves) {
+			// score the end of the game the way the search scores it
+			score = 0
+			if b.InCheck(stm) {
+				score = -chess.Inf
+			}
+			positions = append(positions, shim.Position{FEN: b.FEN(), Score: score})
 			break
 		}
+		if err != nil {
+			return true, err
+		}
+
+		score = result.Score
+		positions = append(positions, shim.Position{FEN: b.FEN(), BM: result.Move, Score: score})
 
 		if config.Draw && moveCounter >= config.DrawAfter && Range(config.DrawMargin).Contains(score) {
 			drawCounter++
@@ -150,12 +160,14 @@ func (g Generator) Game(config shim.Config, client shim.Client) (ok bool, err er
 			break
 		}
 
-		b.MakeMove(bm)
+		if err := g.engine.Play(result.Move.String()); err != nil {
+			return true, err
+		}
 	}
 
 	// determine the WDL result
 	// conver score to white's perspective
-	if b.STM == chess.Black {
+	if stm == chess.Black {
 		score = -score
 	}
 
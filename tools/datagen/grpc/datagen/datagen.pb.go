@@ -212,6 +212,7 @@ func (*OpeningRequest) Descriptor() ([]byte, []int) {
 type Opening struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Fen           string                 `protobuf:"bytes,1,opt,name=fen,proto3" json:"fen,omitempty"`
+	Moves         []string               `protobuf:"bytes,2,rep,name=moves,proto3" json:"moves,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -253,6 +254,13 @@ func (x *Opening) GetFen() string {
 	return ""
 }
 
+func (x *Opening) GetMoves() []string {
+	if x != nil {
+		return x.Moves
+	}
+	return nil
+}
+
 type Game struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Wdl           int32                  `protobuf:"varint,1,opt,name=wdl,proto3" json:"wdl,omitempty"`
@@ -425,9 +433,10 @@ const file_protos_datagen_proto_rawDesc = "" +
 	"win_margin\x18\t \x01(\x05R\twinMargin\x12\x1b\n" +
 	"\twin_count\x18\n" +
 	" \x01(\x05R\bwinCount\"\x10\n" +
-	"\x0eOpeningRequest\"\x1b\n" +
+	"\x0eOpeningRequest\"1\n" +
 	"\aOpening\x12\x10\n" +
-	"\x03fen\x18\x01 \x01(\tR\x03fen\"I\n" +
+	"\x03fen\x18\x01 \x01(\tR\x03fen\x12\x14\n" +
+	"\x05moves\x18\x02 \x03(\tR\x05moves\"I\n" +
 	"\x04Game\x12\x10\n" +
 	"\x03wdl\x18\x01 \x01(\x05R\x03wdl\x12/\n" +
 	"\tpositions\x18\x02 \x03(\v2\x11.datagen.PositionR\tpositions\"O\n" +
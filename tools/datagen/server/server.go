@@ -1,12 +1,14 @@
 package server
 
 import (
+	"context"
 	"database/sql"
 	"flag"
 	"fmt"
 	"math/rand/v2"
 	"net"
 	"os"
+	"slices"
 	"sync"
 	"time"
 
@@ -17,10 +19,9 @@ import (
 
 	"github.com/paulsonkoly/chess-3/board"
 	"github.com/paulsonkoly/chess-3/chess"
+	"github.com/paulsonkoly/chess-3/engine"
 	"github.com/paulsonkoly/chess-3/move"
 	"github.com/paulsonkoly/chess-3/movegen"
-	"github.com/paulsonkoly/chess-3/search"
-	"github.com/paulsonkoly/chess-3/transp"
 )
 
 const (
@@ -74,7 +75,7 @@ func Run(args []string) {
 	serverConfig.softNodes = config.SoftNodes
 	serverConfig.hardNodes = config.HardNodes
 
-	openings := make(chan *board.Board, OpeningQueueDepth)
+	openings := make(chan shim.Opening, OpeningQueueDepth)
 	games := make(chan shim.Game, GameQueueDepth)
 	finished := make(chan struct{})
 
@@ -110,10 +111,10 @@ func Run(args []string) {
 	close(games)
 }
 
-func generateOpenings(openings chan<- *board.Board, finished <-chan struct{}) {
+func generateOpenings(openings chan<- shim.Opening, finished <-chan struct{}) {
 	generate := OpeningGenerator{
 		ms:     move.NewStore(),
-		search: search.New(1 * transp.MegaBytes),
+		engine: engine.New(),
 		rnd:    rand.New(rand.NewPCG(uint64(time.Now().UnixNano()), 0x82a1_73b1_69cc_df15)),
 	}
 
@@ -128,13 +129,16 @@ func generateOpenings(openings chan<- *board.Board, finished <-chan struct{}) {
 
 type OpeningGenerator struct {
 	ms     *move.Store
-	search *search.Search
+	engine *engine.Engine
 	rnd    *rand.Rand
 }
 
 // TODO make sure the opening is unique
-func (og *OpeningGenerator) Opening() *board.Board {
-	var b *board.Board
+func (og *OpeningGenerator) Opening() shim.Opening {
+	var (
+		b     *board.Board
+		moves []string
+	)
 
 	ms := og.ms
 
@@ -142,31 +146,39 @@ Retry:
 	for {
 		ms.Clear()
 		b = board.StartPos()
+		moves = moves[:0]
 
 		for range serverConfig.openingDepth {
 			ms.Push()
 			movegen.Noisy(ms, b)
 			movegen.Quiet(ms, b)
-			moves := ms.Frame()
+			frame := ms.Frame()
 
-			if len(moves) < 1 {
+			if len(frame) < 1 {
 				goto Retry
 			}
 
-			move := &moves[og.rnd.IntN(len(moves))]
+			move := &frame[og.rnd.IntN(len(frame))]
 			b.MakeMove(move.Move)
 			if b.InCheck(b.STM.Flip()) { // pseudo legality check
 				goto Retry
 			}
+			moves = append(moves, move.Move.UCI(false))
+		}
+
+		// the engine gets the moves for the repetition history
+		if err := og.engine.SetPosition(chess.StartPosFEN, moves); err != nil {
+			goto Retry
 		}
 
-		score, _, _ := og.search.Go(b,
-			search.WithSoftNodes(serverConfig.softNodes),
-			search.WithNodes(serverConfig.hardNodes),
-			search.WithOutput(nil))
+		result, err := og.engine.Think(context.Background(),
+			engine.Limits{SoftNodes: serverConfig.softNodes, Nodes: serverConfig.hardNodes})
+		if err != nil {
+			goto Retry
+		}
 
-		if serverConfig.openingMargin == -1 || Range(serverConfig.openingMargin).Contains(score) {
-			return b
+		if serverConfig.openingMargin == -1 || Range(serverConfig.openingMargin).Contains(result.Score) {
+			return shim.Opening{FEN: chess.StartPosFEN, Moves: slices.Clone(moves)}
 		}
 	}
 }
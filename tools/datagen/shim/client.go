@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 
-	"github.com/paulsonkoly/chess-3/board"
 	pb "github.com/paulsonkoly/chess-3/tools/datagen/grpc/datagen"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
@@ -49,7 +48,7 @@ func (c *Client) RequestConfig() (Config, error) {
 	}, nil
 }
 
-func (c *Client) RequestOpening() (*board.Board, error) {
+func (c *Client) RequestOpening() (*Opening, error) {
 	gOpening, err := c.grpc.RequestOpening(context.Background(), &pb.OpeningRequest{})
 	if err != nil {
 		return nil, err
@@ -59,12 +58,7 @@ func (c *Client) RequestOpening() (*board.Board, error) {
 		return nil, nil
 	}
 
-	b, err := board.FromFEN(gOpening.Fen)
-	if err != nil {
-		return nil, err
-	}
-
-	return b, nil
+	return &Opening{FEN: gOpening.Fen, Moves: gOpening.Moves}, nil
 }
 
 func (c *Client) RegisterGame(g *Game) error {
@@ -18,6 +18,13 @@ const (
 	BlackWins
 )
 
+// Opening is the starting position of a game, the position FEN followed by
+// Moves in uci notation.
+type Opening struct {
+	FEN   string
+	Moves []string
+}
+
 type Position struct {
 	FEN   string
 	BM    move.Move
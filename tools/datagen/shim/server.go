@@ -4,7 +4,6 @@ import (
 	"context"
 	"net"
 
-	"github.com/paulsonkoly/chess-3/board"
 	"github.com/paulsonkoly/chess-3/chess"
 	"github.com/paulsonkoly/chess-3/move"
 	pb "github.com/paulsonkoly/chess-3/tools/datagen/grpc/datagen"
@@ -16,7 +15,7 @@ type Server struct {
 	datagen datagenServer
 }
 
-func NewServer(config *Config, openings <-chan *board.Board, games chan<- Game) *Server {
+func NewServer(config *Config, openings <-chan Opening, games chan<- Game) *Server {
 	var opts []grpc.ServerOption
 	grpcServer := grpc.NewServer(opts...)
 	s := datagenServer{
@@ -38,7 +37,7 @@ func (s *Server) Stop() {
 
 type datagenServer struct {
 	config   *Config
-	openings <-chan *board.Board
+	openings <-chan Opening
 	games    chan<- Game
 	pb.UnimplementedDatagenServer
 }
@@ -59,12 +58,11 @@ func (d datagenServer) RequestConfig(_ context.Context, _ *pb.ConfigRequest) (*p
 }
 
 func (d datagenServer) RequestOpening(_ context.Context, _ *pb.OpeningRequest) (*pb.Opening, error) {
-	b, ok := <-d.openings
-	var fen string
-	if ok {
-		fen = b.FEN()
+	opening, ok := <-d.openings
+	if !ok {
+		return &pb.Opening{}, nil
 	}
-	return &pb.Opening{Fen: fen}, nil
+	return &pb.Opening{Fen: opening.FEN, Moves: opening.Moves}, nil
 }
 
 func (d datagenServer) RegisterGame(_ context.Context, gGame *pb.Game) (*pb.GameAck, error) {
@@ -10,6 +10,7 @@ import (
 	"math"
 	"net"
 	"os"
+	"path/filepath"
 	"runtime"
 	"runtime/pprof"
 	"time"
@@ -49,7 +50,7 @@ func Run(args []string) {
 	sFlags.StringVar(&epdFileName, "epd", "", "epd file name")
 	sFlags.StringVar(&host, "host", "localhost", "host to listen on")
 	sFlags.IntVar(&port, "port", 9001, "port to listen on")
-	sFlags.StringVar(&outFn, "out", "coeffs.go", "coeff output file")
+	sFlags.StringVar(&outFn, "out", "coeffs.go", "coeff output file, .json and .bin write coefficient files")
 	sFlags.StringVar(&minKPProf, "kpprof", "", "filename for gathering cpu profiling data from the mse minimization with k")
 	sFlags.StringVar(&minKMProf, "kmprof", "", "filename for gathering mem profiling data from the mse minimization with k")
 	sFlags.BoolVar(&useTui, "tui", false, "render a tui")
@@ -331,8 +332,19 @@ func epdProcess(
 			slog.Error("coeffs.go", "error", err)
 			os.Exit(app.ExitFailure)
 		}
-		eCoeffs.Save(f, fn, epoch, newMSE)
+		switch filepath.Ext(outFn) {
+		case ".json":
+			err = eCoeffs.WriteJSON(f)
+		case ".bin":
+			err = eCoeffs.WriteBinary(f)
+		default:
+			err = eCoeffs.Save(f, fn, epoch, newMSE)
+		}
 		f.Close()
+		if err != nil {
+			slog.Error("coeffs output", "error", err)
+			os.Exit(app.ExitFailure)
+		}
 
 		tuiQueue <- tui.MSEUpdate{MSE: newMSE}
 
@@ -191,6 +191,18 @@ func setFieldFloats(dst reflect.Value, floats []float64) int {
 	}
 }
 
+// WriteJSON saves e in the output stream out in the engine's JSON coefficient
+// file format.
+func (e *EngineRep) WriteJSON(out io.Writer) error {
+	return (*eval.CoeffSet[float64])(e).WriteJSON(out)
+}
+
+// WriteBinary saves e in the output stream out in the engine's binary
+// coefficient file format.
+func (e *EngineRep) WriteBinary(out io.Writer) error {
+	return (*eval.CoeffSet[float64])(e).WriteBinary(out)
+}
+
 // Save saves e in the output stream out, with the header information
 // containing fn, epoch and mse.
 func (e *EngineRep) Save(out io.Writer, fn string, epoch int, mse float64) error {
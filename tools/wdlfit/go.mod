@@ -0,0 +1,12 @@
+module github.com/paulsonkoly/chess-3/tools/wdlfit
+
+go 1.26.0
+
+require (
+	github.com/mattn/go-sqlite3 v1.14.34
+	github.com/paulsonkoly/chess-3 v0.0.0-20251207110540-03e88390027a
+)
+
+require golang.org/x/exp v0.0.0-20250218142911-aa4b98e5adaa // indirect
+
+replace github.com/paulsonkoly/chess-3 => ../../
@@ -0,0 +1,108 @@
+// wdlfit fits the win, draw and loss model of UCI_ShowWDL to the games of a
+// datagen database. The fitted model is printed in the format of wdl.Default.
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/paulsonkoly/chess-3/board"
+	"github.com/paulsonkoly/chess-3/chess"
+	"github.com/paulsonkoly/chess-3/wdl"
+)
+
+// Game outcomes as stored by datagen.
+const (
+	Draw     = 0
+	WhiteWon = 1
+	BlackWon = 2
+)
+
+func main() {
+	var (
+		dbFn  string
+		iters int
+		lr    float64
+	)
+
+	flag.StringVar(&dbFn, "database", "database.db", "input database file name")
+	flag.IntVar(&iters, "iterations", 2000, "number of optimizer iterations")
+	flag.Float64Var(&lr, "lr", 1, "learning rate")
+
+	flag.Parse()
+
+	db, err := sql.Open("sqlite3", dbFn)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	samples, err := load(db)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("fitting %d positions\n", len(samples))
+
+	m := wdl.Default
+	initial := m.Fit(samples, 0, 0)
+	loss := m.Fit(samples, iters, lr)
+
+	fmt.Printf("negative log likelihood %.6f -> %.6f\n", initial, loss)
+	fmt.Printf("var Default = Model{\n\tA: [Features]float64{%.2f, %.2f, %.2f, %.2f},\n"+
+		"\tB: [Features]float64{%.2f, %.2f, %.2f, %.2f},\n}\n",
+		m.A[0], m.A[1], m.A[2], m.A[3], m.B[0], m.B[1], m.B[2], m.B[3])
+}
+
+func load(db *sql.DB) ([]wdl.Sample, error) {
+	rows, err := db.Query("select games.wdl, positions.fen, positions.eval " +
+		"from games inner join positions on positions.game_id = games.id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	samples := []wdl.Sample{}
+	for rows.Next() {
+		var (
+			result int
+			fen    []byte
+			score  chess.Score
+		)
+
+		if err := rows.Scan(&result, &fen, &score); err != nil {
+			return nil, err
+		}
+
+		b := board.Board{}
+		if err := board.ParseFEN(&b, fen); err != nil {
+			return nil, err
+		}
+
+		samples = append(samples, wdl.Sample{
+			Score:    score,
+			Material: wdl.MaterialCount(&b),
+			Ply:      b.Ply(),
+			Outcome:  outcome(result, b.STM),
+		})
+	}
+
+	return samples, rows.Err()
+}
+
+// outcome is the game result from stm's point of view.
+func outcome(result int, stm chess.Color) wdl.Outcome {
+	switch {
+	case result == Draw:
+		return wdl.Draw
+	case (result == WhiteWon) == (stm == chess.White):
+		return wdl.Win
+	}
+	return wdl.Loss
+}
@@ -0,0 +1,32 @@
+package transp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/paulsonkoly/chess-3/chess"
+)
+
+func TestKeyVerification(t *testing.T) {
+	const hash = 0xbeef_0000_1234_5678
+
+	tt := New(1 * MegaBytes)
+	tt.Insert(hash, 0, 5, 0, 0, 100, Inv, false, Exact)
+
+	e, ok := tt.LookUp(hash)
+	assert.True(t, ok)
+	assert.Equal(t, Score(100), e.Value(0))
+
+	// an entry word written without its key lane, as seen by a reader between
+	// the two writes of another thread
+	bucket := &tt.data[tt.bucketIx(hash)]
+	for i := range bucket.entries {
+		if bucket.entries[i].Load() != 0 {
+			bucket.entries[i].Store(entry{value: -100, depth: 5, meta: newMeta(0, false, Exact)}.pack())
+		}
+	}
+
+	_, ok = tt.LookUp(hash)
+	assert.False(t, ok)
+}
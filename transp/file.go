@@ -0,0 +1,105 @@
+package transp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// The saved table starts with fileMagic, the file format version, the bucket
+// size in bytes and the generation as bytes, followed by the bucket count as
+// little endian uint64. Each bucket is the partial keys XOR-ed with the folded
+// entries as little endian uint64 followed by the entries, each entry is the
+// move, the value and the static evaluation as little endian uint16s then the
+// depth + 1 and the packed generation, PV flag and type bytes.
+
+const (
+	fileMagic = "C3TT"
+	// fileVersion changes with every change of the format, including the
+	// entry layout, which the bucket size doesn't show. 2 has the depth byte
+	// and the packed generation, 3 the static evaluation and the PV flag.
+	fileVersion = 3
+	headerSize  = len(fileMagic) + 3 + 8
+	entrySize   = 8
+)
+
+var (
+	// ErrFormat indicates that the loaded data is not a saved table.
+	ErrFormat = errors.New("invalid transposition table file")
+	// ErrSize indicates that the saved table size differs from the table size.
+	ErrSize = errors.New("transposition table size mismatch")
+)
+
+// Save writes the table with the current generation gen to w.
+func (t *Table) Save(w io.Writer, gen Gen) error {
+	bw := bufio.NewWriter(w)
+
+	header := make([]byte, 0, headerSize)
+	header = append(header, fileMagic...)
+	header = append(header, fileVersion, bucketSize, byte(gen))
+	header = binary.LittleEndian.AppendUint64(header, uint64(len(t.data)))
+	if _, err := bw.Write(header); err != nil {
+		return err
+	}
+
+	buf := make([]byte, bucketSize)
+	for i := range t.data {
+		t.data[i].encode(buf)
+		if _, err := bw.Write(buf); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+// Load reads a table saved by Save from r, and returns its generation. The
+// table size has to match the saved table size. On error the table content is
+// undefined.
+func (t *Table) Load(r io.Reader) (Gen, error) {
+	br := bufio.NewReader(r)
+
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrFormat, err)
+	}
+
+	magic, version, size := string(header[:len(fileMagic)]), header[len(fileMagic)], header[len(fileMagic)+1]
+	if magic != fileMagic || version != fileVersion || size != bucketSize {
+		return 0, ErrFormat
+	}
+	gen := Gen(header[len(fileMagic)+2])
+
+	if cnt := binary.LittleEndian.Uint64(header[len(fileMagic)+3:]); cnt != uint64(len(t.data)) {
+		return 0, fmt.Errorf("%w: saved %d MB, current %d MB",
+			ErrSize, cnt*bucketSize/MegaBytes, len(t.data)*bucketSize/MegaBytes)
+	}
+
+	buf := make([]byte, bucketSize)
+	for i := range t.data {
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return 0, fmt.Errorf("%w: %w", ErrFormat, err)
+		}
+		t.data[i].decode(buf)
+	}
+
+	return gen, nil
+}
+
+// encode encodes b into buf of bucketSize bytes.
+func (b *bucket) encode(buf []byte) {
+	binary.LittleEndian.PutUint64(buf, b.pKeys.Load())
+	for i := range b.entries {
+		binary.LittleEndian.PutUint64(buf[8+entrySize*i:], b.entries[i].Load())
+	}
+}
+
+// decode decodes b from buf of bucketSize bytes.
+func (b *bucket) decode(buf []byte) {
+	b.pKeys.Store(binary.LittleEndian.Uint64(buf))
+	for i := range b.entries {
+		b.entries[i].Store(binary.LittleEndian.Uint64(buf[8+entrySize*i:]))
+	}
+}
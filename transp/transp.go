@@ -1,9 +1,19 @@
 // Package transp is a transposition table.
+//
+// The table is shared by the search threads without locking. Each bucket is a
+// set of 64 bit words accessed atomically, the key word has a 16 bit lane per
+// entry word holding the partial key XOR-ed with the entry. A lane that does
+// not belong to its entry, because the writes of the two words interleaved
+// with a read or with another write, fails the key verification and reads as
+// a miss.
 package transp
 
 import (
 	"fmt"
 	"math/bits"
+	"runtime"
+	"sync"
+	"sync/atomic"
 	"unsafe"
 
 	"github.com/paulsonkoly/chess-3/board"
@@ -19,7 +29,7 @@ const (
 
 const (
 	// bucketEntryCnt is the number of entries per bucket.
-	bucketEntryCnt = 4
+	bucketEntryCnt = 3
 	// bucketSize is the bucket size in bytes.
 	bucketSize = 32
 	// partialKeyBits is the number of bits of the Zobrist-hash stored per entry.
@@ -29,53 +39,112 @@ const (
 // Type represents the stored bound type.
 type Type byte
 
-// Gen is the search counter for aging.
+// Gen is the search counter for aging. Entries store the low genBits bits of
+// the generation.
 type Gen byte
 
+const (
+	// genBits is the number of bits of the generation stored per entry.
+	genBits = 5
+	// genMask masks the stored bits of the generation.
+	genMask = 1<<genBits - 1
+)
+
 const (
 	UpperBound Type = iota // Entry score is upper bound only.
 	LowerBound             // Entry score is lower bound only.
 	Exact                  // Entry score is exact.
 )
 
-// packed depth and type into a single byte.
-type packed byte
+// meta packs generation, PV flag and type into a single byte.
+type meta byte
 
-// Depth is the entry depth.
-func (p packed) Depth() Depth { return Depth(p >> 2) }
+// pvFlag is the bit of the PV flag in meta.
+const pvFlag = meta(4)
 
 // Type indicates the node type / whether the score is exact or bound.
-func (p packed) Type() Type { return Type(p & 3) }
+func (m meta) Type() Type { return Type(m & 3) }
+
+// PV indicates whether the entry was stored in a PV node, or in a node that
+// was a PV node before.
+func (m meta) PV() bool { return m&pvFlag != 0 }
+
+// gen is the stored generation.
+func (m meta) gen() Gen { return Gen(m >> 3) }
+
+func newMeta(gen Gen, pv bool, typ Type) meta {
+	m := meta(gen&genMask)<<3 | meta(typ)
+	if pv {
+		m |= pvFlag
+	}
+	return m
+}
 
 type entry struct {
 	move.Move       // SimpleMove is the hash move. (2 bytes)
 	value     Score // (2 bytes)
-	packed          // packed depth and type. (1 byte)
-	gen       Gen   // (1 byte)
+	eval      Score // static evaluation, Inv if unknown. (2 bytes)
+	depth     uint8 // depth + 1, so a stored entry word is never 0. (1 byte)
+	meta            // packed generation, PV flag and type. (1 byte)
 }
 
-// Value is the score of the entry corrected for current ply in case of mate score.
-func (e *entry) Value(ply Depth) Score {
-	if e.value > Inf-MaxPlies {
+// Depth is the entry depth.
+func (e entry) Depth() Depth { return Depth(e.depth) - 1 }
+
+// Eval is the static evaluation of the position, Inv if unknown.
+func (e entry) Eval() Score { return e.eval }
+
+// distBound is the bound of the scores carrying a distance from the root, the
+// mate and the tablebase win scores.
+const distBound = TBWin - MaxPlies
+
+// Value is the score of the entry corrected for current ply in case of mate or
+// tablebase win score.
+func (e entry) Value(ply Depth) Score {
+	if e.value > distBound {
 		return e.value - Score(ply)
 	}
 
-	if e.value < -Inf+MaxPlies {
+	if e.value < -distBound {
 		return e.value + Score(ply)
 	}
 
 	return e.value
 }
 
-func (e *entry) quality(curr Gen) int { return quality(curr, e.gen, e.Depth()) }
+func (e entry) quality(curr Gen) int { return quality(curr, e.gen(), e.Depth()) }
+
+// pack packs e into an entry word, in the byte order of the entry fields.
+func (e entry) pack() uint64 {
+	return uint64(e.Move) | uint64(uint16(e.value))<<16 | uint64(uint16(e.eval))<<32 |
+		uint64(e.depth)<<48 | uint64(e.meta)<<56
+}
+
+// unpack unpacks the entry word w.
+func unpack(w uint64) entry {
+	return entry{
+		Move:  move.Move(w),
+		value: Score(w >> 16),
+		eval:  Score(w >> 32),
+		depth: uint8(w >> 48),
+		meta:  meta(w >> 56),
+	}
+}
 
 // partialKey is the bits of the Zobrist stored in the table.
 type partialKey uint16
 
-type bucket struct {
-	pKeys   uint64                // pKeys are the partial keys for entries present in this bucket.
-	entries [bucketEntryCnt]entry // entries set of entries that compete in replacement.
+// fold folds the entry word w into a 16 bit lane for the key verification.
+func fold(w uint64) uint64 {
+	w ^= w >> 32
+	return (w ^ w>>16) & (1<<partialKeyBits - 1)
+}
 
+type bucket struct {
+	// pKeys are the partial keys XOR-ed with the folded entry words for
+	// entries present in this bucket, the top 16 bits are unused.
+	pKeys   atomic.Uint64
+	entries [bucketEntryCnt]atomic.Uint64 // entries set of packed entries that compete in replacement.
 }
 
 // Table is the transposition table.
@@ -117,7 +186,7 @@ func (t *Table) Resize(size int) {
 		base := uintptr(unsafe.Pointer(&t.raw[0]))
 		aligned := (base + uintptr(bucketSize-1)) &^ uintptr(bucketSize-1)
 
-		ptr := unsafe.Pointer(aligned)
+		ptr := unsafe.Add(unsafe.Pointer(&t.raw[0]), aligned-base)
 		t.data = unsafe.Slice((*bucket)(ptr), requiredBuckets)
 	}
 }
@@ -134,84 +203,119 @@ func (t Table) HashFull(gen Gen) int {
 	if len(t.data) < 1000 {
 		panic("tt size is too small to measure permill HashFull")
 	}
-	for _, bucket := range t.data[:1000] {
-		for i, entry := range bucket.entries {
-			if (bucket.pKeys>>(i*partialKeyBits))&(1<<partialKeyBits-1) != 0 && entry.gen == gen {
+	for i := range t.data[:1000] {
+		for j := range t.data[i].entries {
+			w := t.data[i].entries[j].Load()
+			if w != 0 && unpack(w).gen() == gen&genMask {
 				cnt++
 			}
 		}
 	}
-	return cnt / 4 // 4 entries per bucket
+	return cnt / bucketEntryCnt
 }
 
-// Clear empties the tt.
-func (t *Table) Clear() {
-	for i, bucket := range t.data {
-		t.data[i].pKeys = 0
+// clearChunk is the number of buckets cleared by a single goroutine in Clear.
+const clearChunk = 64 * MegaBytes / bucketSize
 
-		for j := range bucket.entries {
-			t.data[i].entries[j] = entry{}
+// Clear empties the tt. Large tables are cleared in parallel.
+func (t *Table) Clear() { t.forChunks(func(chunk []bucket) { clear(chunk) }) }
+
+// ClearEvals forgets the static evaluations stored in the tt, keeping the rest
+// of the entries. The evaluations are not valid after the evaluator changes.
+// It must not run concurrently with a search.
+func (t *Table) ClearEvals() {
+	t.forChunks(func(chunk []bucket) {
+		for i := range chunk {
+			chunk[i].clearEvals()
 		}
-	}
+	})
 }
 
-// bucketIx returns the index of the bucket for hash.
-func (t *Table) bucketIx(hash board.Hash) int {
-	// Lemire's fast modulo trick. If the table grows beyond 4GB, only the
-	// collision rate increases; correctness is unaffected. See:
-	// https://lemire.me/blog/2016/06/27/a-fast-alternative-to-the-modulo-reduction/
-	h := uint32(hash)
-	return int(uint64(h) * uint64(len(t.data)) >> 32)
+// forChunks calls f on the buckets of the tt. Large tables are split into
+// chunks processed in parallel.
+func (t *Table) forChunks(f func(chunk []bucket)) {
+	if len(t.data) <= clearChunk {
+		f(t.data)
+		return
+	}
+
+	workers := min(runtime.NumCPU(), (len(t.data)+clearChunk-1)/clearChunk)
+	per := (len(t.data) + workers - 1) / workers
+
+	wg := sync.WaitGroup{}
+	for lo := 0; lo < len(t.data); lo += per {
+		chunk := t.data[lo:min(lo+per, len(t.data))]
+		wg.Go(func() { f(chunk) })
+	}
+	wg.Wait()
 }
 
-const (
-	rep16 = 0x0001_0001_0001_0001
-	hi16  = 0x8000_8000_8000_8000
-)
+// clearEvals sets the evaluations of the entries in b to Inv, re-keying the
+// key lanes for the changed entry words.
+func (b *bucket) clearEvals() {
+	pKeys := b.pKeys.Load()
+	for i := range bucketEntryCnt {
+		w := b.entries[i].Load()
+		if w == 0 {
+			continue
+		}
 
-// match64 finds the index of matching 16 bit lane in the 64 bit word w,
-// comparing each 16 bit lanes with key. If there are no matches it returns ok
-// false.
-func match64(w uint64, key partialKey) (ix int, ok bool) {
-	r := uint64(key) * rep16
-	x := w ^ r
-	mask := (x - rep16) & ^x & hi16
-	if mask == 0 {
-		return
+		e := unpack(w)
+		e.eval = Inv
+		nw := e.pack()
+
+		pKeys ^= (fold(w) ^ fold(nw)) << (i * partialKeyBits)
+		b.entries[i].Store(nw)
 	}
-	return bits.TrailingZeros64(mask) / 16, true
+	b.pKeys.Store(pKeys)
+}
+
+// bucketIx returns the index of the bucket for hash.
+func (t *Table) bucketIx(hash board.Hash) int {
+	// Lemire's fast modulo trick on the 48 bits of hash not stored in the
+	// partial key, so the index and the partial key are independent even for
+	// very large tables. See:
+	// https://lemire.me/blog/2016/06/27/a-fast-alternative-to-the-modulo-reduction/
+	ix, _ := bits.Mul64(uint64(hash)<<partialKeyBits, uint64(len(t.data)))
+	return int(ix)
 }
 
-// LookUp looks up the entry for hash.
-func (t *Table) LookUp(hash board.Hash) (*entry, bool) {
+// LookUp looks up the entry for hash. The entry is a copy, it is not affected
+// by later writes to the table.
+func (t *Table) LookUp(hash board.Hash) (entry, bool) {
 	bucket := &t.data[t.bucketIx(hash)]
-	bucketKeys := bucket.pKeys
+	bucketKeys := bucket.pKeys.Load()
 	hashKey := partialKey(hash >> (64 - partialKeyBits))
 
-	if ix, ok := match64(bucketKeys, hashKey); ok {
-		return &bucket.entries[ix], true
+	for i := range bucketEntryCnt {
+		w := bucket.entries[i].Load()
+		// an empty slot would match a hash with a zero partial key
+		if w != 0 && partialKey(bucketKeys>>(i*partialKeyBits)^fold(w)) == hashKey {
+			return unpack(w), true
+		}
 	}
 
-	return nil, false
+	return entry{}, false
 }
 
-// Insert writes an entry into the transposition table.
-func (t *Table) Insert(hash board.Hash, gen Gen, d, ply Depth, sm move.Move, value Score, typ Type) {
+// Insert writes an entry into the transposition table. pv indicates whether
+// the node is a PV node.
+func (t *Table) Insert(hash board.Hash, gen Gen, d, ply Depth, sm move.Move, value, eval Score, pv bool, typ Type) {
 	bucket := &t.data[t.bucketIx(hash)]
 
 	hashKey := partialKey(hash >> (64 - partialKeyBits))
-	bucketKeys := bucket.pKeys
+	pKeys := bucket.pKeys.Load()
 
 	// sufficiently large start value for minimum search
 	minQ := 1 << 50
 	var replace int
-	var target *entry
 	for i := range bucketEntryCnt {
-		target = &bucket.entries[i]
+		w := bucket.entries[i].Load()
+		target := unpack(w)
 		entryQ := target.quality(gen)
 
-		if partialKey(bucketKeys) == hashKey {
-			if typ != Exact && target.Depth() > d+2 && target.gen == gen {
+		if w != 0 && partialKey(pKeys>>(i*partialKeyBits)^fold(w)) == hashKey {
+			if typ != Exact && target.Depth() > d+2 && target.gen() == gen&genMask {
 				return
 			}
 
@@ -228,28 +332,33 @@ func (t *Table) Insert(hash board.Hash, gen Gen, d, ply Depth, sm move.Move, val
 			minQ = entryQ
 			replace = i
 		}
-
-		bucketKeys >>= partialKeyBits
 	}
 
-	if value < -Inf+MaxPlies {
+	if value < -distBound {
 		value -= Score(ply)
 	}
-	if value > Inf-MaxPlies {
+	if value > distBound {
 		value += Score(ply)
 	}
 
-	bucket.entries[replace] = entry{
-		Move:   sm,
-		value:  value,
-		packed: packed(d)<<2 | packed(typ),
-		gen:    gen,
-	}
+	w := entry{
+		Move:  sm,
+		value: value,
+		eval:  eval,
+		depth: uint8(d + 1),
+		meta:  newMeta(gen, pv, typ),
+	}.pack()
+
+	pKeys &= ^(((1 << partialKeyBits) - 1) << (replace * partialKeyBits))
+	pKeys |= (uint64(hashKey) ^ fold(w)) << (replace * partialKeyBits)
 
-	bucket.pKeys &= ^(((1 << partialKeyBits) - 1) << (replace * partialKeyBits))
-	bucket.pKeys |= uint64(hashKey) << (replace * partialKeyBits)
+	bucket.entries[replace].Store(w)
+	bucket.pKeys.Store(pKeys)
 }
 
+// quality is the replacement priority of an entry of depth d stored in
+// generation g. The generation age wraps around at genBits bits.
 func quality(curr, g Gen, d Depth) int {
-	return int(d) + 2*(int(g)-int(curr))
+	age := (curr - g) & genMask
+	return int(d) - 2*int(age)
 }
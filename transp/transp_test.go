@@ -1,6 +1,9 @@
 package transp_test
 
 import (
+	"bytes"
+	"math/rand/v2"
+	"sync"
 	"testing"
 
 	"github.com/paulsonkoly/chess-3/board"
@@ -22,17 +25,18 @@ func TestTransposition(t *testing.T) {
 	entry, ok := tt.LookUp(key)
 
 	assert.False(t, ok)
-	assert.Nil(t, entry)
+	assert.Zero(t, entry)
 
-	tt.Insert(key, 0, 1, 1, move.From(E1)|move.To(F1), 100, transp.Exact)
+	tt.Insert(key, 0, 1, 1, move.From(E1)|move.To(F1), 100, 40, true, transp.Exact)
 
 	entry, ok = tt.LookUp(key)
 
 	assert.True(t, ok)
-	assert.NotNil(t, entry)
 
 	assert.Equal(t, move.From(E1)|move.To(F1), entry.Move)
 	assert.Equal(t, Score(100), entry.Value(1))
+	assert.Equal(t, Score(40), entry.Eval())
+	assert.True(t, entry.PV())
 	assert.Equal(t, Depth(1), entry.Depth())
 	assert.Equal(t, transp.Exact, entry.Type())
 
@@ -41,18 +45,35 @@ func TestTransposition(t *testing.T) {
 	entry, ok = tt.LookUp(key)
 
 	assert.False(t, ok)
-	assert.Nil(t, entry)
+	assert.Zero(t, entry)
+}
+
+func TestClearEvals(t *testing.T) {
+	tt := transp.New(1 * transp.MegaBytes)
+
+	tt.Insert(key, 0, 1, 1, move.From(E1)|move.To(F1), 100, 40, true, transp.Exact)
+	tt.ClearEvals()
+
+	entry, ok := tt.LookUp(key)
+
+	assert.True(t, ok)
+
+	assert.Equal(t, move.From(E1)|move.To(F1), entry.Move)
+	assert.Equal(t, Score(100), entry.Value(1))
+	assert.Equal(t, Inv, entry.Eval())
+	assert.True(t, entry.PV())
+	assert.Equal(t, Depth(1), entry.Depth())
+	assert.Equal(t, transp.Exact, entry.Type())
 }
 
 func TestMateScores(t *testing.T) {
 	tt := transp.New(1 * transp.MegaBytes)
 
-	tt.Insert(key, 0, 1, 3, move.From(E1)|move.To(F1), -Inf+5, transp.Exact)
+	tt.Insert(key, 0, 1, 3, move.From(E1)|move.To(F1), -Inf+5, Inv, false, transp.Exact)
 
 	entry, ok := tt.LookUp(key)
 
 	assert.True(t, ok)
-	assert.NotNil(t, entry)
 
 	assert.Equal(t, move.From(E1)|move.To(F1), entry.Move)
 	assert.Equal(t, -Inf+9, entry.Value(7))
@@ -60,27 +81,60 @@ func TestMateScores(t *testing.T) {
 	assert.Equal(t, transp.Exact, entry.Type())
 }
 
+func TestTBScores(t *testing.T) {
+	tt := transp.New(1 * transp.MegaBytes)
+
+	tt.Insert(key, 0, 1, 3, 0, TBWin-3, Inv, false, transp.LowerBound)
+
+	entry, ok := tt.LookUp(key)
+
+	assert.True(t, ok)
+	assert.Equal(t, TBWin-7, entry.Value(7))
+	assert.Equal(t, transp.LowerBound, entry.Type())
+
+	tt.Insert(key, 0, 1, 3, 0, -TBWin+3, Inv, false, transp.UpperBound)
+
+	entry, ok = tt.LookUp(key)
+
+	assert.True(t, ok)
+	assert.Equal(t, -TBWin+7, entry.Value(7))
+	assert.Equal(t, transp.UpperBound, entry.Type())
+}
+
+func TestDeepEntry(t *testing.T) {
+	tt := transp.New(1 * transp.MegaBytes)
+
+	tt.Insert(key, 255, MaxPlies-1, 100, move.From(E1)|move.To(F1), Inf-110, Inv, false, transp.LowerBound)
+
+	entry, ok := tt.LookUp(key)
+
+	assert.True(t, ok)
+	assert.Equal(t, Depth(MaxPlies-1), entry.Depth())
+	assert.Equal(t, Inf-20, entry.Value(10))
+	assert.Equal(t, transp.LowerBound, entry.Type())
+}
+
 func TestBucket(t *testing.T) {
 	key1 := board.Hash(0x0000deadbeefdead)
 	key2 := board.Hash(0x0001deadbeefdead)
 	key3 := board.Hash(0x0002deadbeefdead)
 	key4 := board.Hash(0x0003deadbeefdead)
-	key5 := board.Hash(0x0004deadbeefdead)
 
 	tt := transp.New(1 * transp.MegaBytes)
 
 	// key1 is lowest quality, 0 gen depth 1
-	tt.Insert(key1, 0, 1, 3, move.From(E1)|move.To(F1), 0, transp.UpperBound)
-	tt.Insert(key2, 2, 2, 3, move.From(E1)|move.To(G1), 100, transp.Exact)
-	tt.Insert(key3, 2, 5, 2, move.From(E1)|move.To(H1), -50, transp.LowerBound)
-	tt.Insert(key4, 1, 1, 4, move.From(E1)|move.To(H1), 70, transp.Exact)
+	tt.Insert(key1, 0, 1, 3, move.From(E1)|move.To(F1), 0, Inv, false, transp.UpperBound)
+	tt.Insert(key2, 2, 2, 3, move.From(E1)|move.To(G1), 100, Inv, false, transp.Exact)
+	tt.Insert(key3, 2, 5, 2, move.From(E1)|move.To(H1), -50, Inv, false, transp.LowerBound)
 	// no matching key, replace lowest quality
-	tt.Insert(key5, 2, 5, 4, 0, 70, transp.Exact)
+	tt.Insert(key4, 2, 5, 4, 0, 70, Inv, false, transp.Exact)
+
+	_, ok := tt.LookUp(key1)
+	assert.False(t, ok)
 
-	entry, ok := tt.LookUp(key5)
+	entry, ok := tt.LookUp(key4)
 
 	assert.True(t, ok)
-	assert.NotNil(t, entry)
 
 	// move not kept, not the same position.
 	assert.Equal(t, move.Move(0), entry.Move)
@@ -89,12 +143,11 @@ func TestBucket(t *testing.T) {
 	assert.Equal(t, transp.Exact, entry.Type())
 
 	// new gen, lower depth replace keeping move
-	tt.Insert(key3, 3, 3, 4, 0, 70, transp.Exact)
+	tt.Insert(key3, 3, 3, 4, 0, 70, Inv, false, transp.Exact)
 
 	entry, ok = tt.LookUp(key3)
 
 	assert.True(t, ok)
-	assert.NotNil(t, entry)
 
 	// move kept, same position.
 	assert.Equal(t, move.From(E1)|move.To(H1), entry.Move)
@@ -103,15 +156,136 @@ func TestBucket(t *testing.T) {
 	assert.Equal(t, transp.Exact, entry.Type())
 
 	// low quality insert not performed on matching key
-	tt.Insert(key3, 3, 0, 6, 0, 100, transp.LowerBound)
+	tt.Insert(key3, 3, 0, 6, 0, 100, Inv, false, transp.LowerBound)
 
 	entry, ok = tt.LookUp(key3)
 
 	assert.True(t, ok)
-	assert.NotNil(t, entry)
 
 	assert.Equal(t, move.From(E1)|move.To(H1), entry.Move)
 	assert.Equal(t, Score(70), entry.Value(2))
 	assert.Equal(t, Depth(3), entry.Depth())
 	assert.Equal(t, transp.Exact, entry.Type())
 }
+
+func TestSaveLoad(t *testing.T) {
+	tt := transp.New(1 * transp.MegaBytes)
+	tt.Insert(key, 3, 5, 1, move.From(E1)|move.To(F1), 100, 35, true, transp.LowerBound)
+	tt.Insert(key+1, 3, 2, 4, move.From(D2)|move.To(D4), -Inf+9, Inv, false, transp.Exact)
+
+	buf := bytes.Buffer{}
+	assert.NoError(t, tt.Save(&buf, 3))
+	saved := buf.Bytes()
+
+	loaded := transp.New(1 * transp.MegaBytes)
+	gen, err := loaded.Load(bytes.NewReader(saved))
+	assert.NoError(t, err)
+	assert.Equal(t, transp.Gen(3), gen)
+
+	for _, k := range []board.Hash{key, key + 1} {
+		want, ok := tt.LookUp(k)
+		assert.True(t, ok)
+
+		got, ok := loaded.LookUp(k)
+		assert.True(t, ok)
+		assert.Equal(t, want, got)
+	}
+
+	t.Run("size mismatch", func(t *testing.T) {
+		_, err := transp.New(2 * transp.MegaBytes).Load(bytes.NewReader(saved))
+		assert.ErrorIs(t, err, transp.ErrSize)
+	})
+
+	t.Run("bad magic", func(t *testing.T) {
+		bad := bytes.Clone(saved)
+		bad[0] = 'X'
+		_, err := loaded.Load(bytes.NewReader(bad))
+		assert.ErrorIs(t, err, transp.ErrFormat)
+	})
+
+	t.Run("old version", func(t *testing.T) {
+		old := bytes.Clone(saved)
+		old[4] = 1
+		_, err := loaded.Load(bytes.NewReader(old))
+		assert.ErrorIs(t, err, transp.ErrFormat)
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		_, err := loaded.Load(bytes.NewReader(saved[:len(saved)-1]))
+		assert.ErrorIs(t, err, transp.ErrFormat)
+	})
+}
+
+func TestLargeTable(t *testing.T) {
+	tt := transp.New(160 * transp.MegaBytes)
+
+	keys := make([]board.Hash, 1000)
+	r := rand.New(rand.NewPCG(1, 2))
+	for i := range keys {
+		keys[i] = board.Hash(r.Uint64())
+		tt.Insert(keys[i], 0, 1, 1, move.From(E1)|move.To(F1), Score(i), Inv, false, transp.Exact)
+	}
+
+	for i, k := range keys {
+		entry, ok := tt.LookUp(k)
+		assert.True(t, ok)
+		assert.Equal(t, Score(i), entry.Value(1))
+	}
+
+	tt.Clear()
+
+	for _, k := range keys {
+		_, ok := tt.LookUp(k)
+		assert.False(t, ok)
+	}
+}
+
+func TestEmptySlot(t *testing.T) {
+	// the partial key is 0, the same as the key of an empty slot
+	const key = 0x0000_beef_1234_5678
+
+	tt := transp.New(1 * transp.MegaBytes)
+
+	_, ok := tt.LookUp(key)
+	assert.False(t, ok)
+
+	// an entry of all zero fields
+	tt.Insert(key, 0, 0, 0, 0, 0, 0, false, transp.UpperBound)
+
+	entry, ok := tt.LookUp(key)
+	assert.True(t, ok)
+	assert.Equal(t, Depth(0), entry.Depth())
+	assert.Equal(t, transp.UpperBound, entry.Type())
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	// a small table, so the goroutines write the same buckets
+	tt := transp.New(32 * 1024)
+
+	// the entry stored for key i is a function of i, any hit has to return it
+	// in one piece. The partial keys are distinct, so hits are not collisions.
+	keys := make([]board.Hash, 4096)
+	r := rand.New(rand.NewPCG(3, 4))
+	for i := range keys {
+		keys[i] = board.Hash(uint64(i)<<48 | r.Uint64()>>16)
+	}
+
+	wg := sync.WaitGroup{}
+	for w := range 4 {
+		wg.Go(func() {
+			for n := range 20000 {
+				i := (n*7 + w*13) % len(keys)
+				tt.Insert(keys[i], 0, Depth(i%64), 0, move.Move(i), Score(i), Score(-i), false, transp.Exact)
+
+				j := (n*5 + w) % len(keys)
+				if entry, ok := tt.LookUp(keys[j]); ok {
+					assert.Equal(t, move.Move(j), entry.Move)
+					assert.Equal(t, Score(j), entry.Value(0))
+					assert.Equal(t, Score(-j), entry.Eval())
+					assert.Equal(t, Depth(j%64), entry.Depth())
+				}
+			}
+		})
+	}
+	wg.Wait()
+}
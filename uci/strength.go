@@ -0,0 +1,97 @@
+package uci
+
+import (
+	"math"
+
+	. "github.com/paulsonkoly/chess-3/chess"
+)
+
+// The UCI_Elo scale is relative. It is calibrated by self-play between the
+// handicaps, anchored at maximalElo for the strongest one. The levels are not
+// measured against full strength or against other engines, only the strongest
+// one is. It is not on the CCRL or any other rating list scale.
+const (
+	minimalElo   = 1000
+	maximalElo   = 2800
+	defaultElo   = 1500
+	maximalSkill = 20
+)
+
+// handicap is the set of search restrictions weakening the engine.
+type handicap struct {
+	elo         int
+	nodes       int     // nodes is the soft node limit of the search.
+	noise       Score   // noise is the magnitude of the evaluation noise.
+	temperature float64 // temperature of picking among the candidate moves.
+	candidates  int     // candidates is the number of root moves to pick from.
+}
+
+// handicaps is the calibration table of UCI_Elo sorted by elo. Handicaps
+// between the entries are interpolated. The weakest entries are below
+// minimalElo, they are only there for the interpolation.
+//
+// The Elo values are measured by tools/calibrate, with each entry playing the
+// next stronger one, 200 games per match at 5+0.05 from openings of 8 random
+// plies. The differences are chained down from the last entry, which is fixed
+// at 2800. The 95% error bars grow from 46 at 2600 to 179 at the first entry.
+// The full strength engine measured 40 +- 32 above the last entry. Recalibrate
+// if the search or the evaluation changes considerably.
+//
+// The 2800 of the last entry is not measured. It is maximalElo, the top of the
+// UCI_Elo range, and the whole scale is relative to it. It is set below the
+// CCRL rating of the full strength engine, 3039 for version 4.0, because the
+// last entry is limited to 100000 nodes per move, but the gap is not
+// measured, so the values are not on the CCRL scale.
+var handicaps = [...]handicap{
+	{elo: 223, nodes: 200, noise: 120, temperature: 80, candidates: 4},
+	{elo: 481, nodes: 400, noise: 100, temperature: 60, candidates: 4},
+	{elo: 701, nodes: 800, noise: 80, temperature: 45, candidates: 4},
+	{elo: 1103, nodes: 1500, noise: 60, temperature: 35, candidates: 3},
+	{elo: 1394, nodes: 3000, noise: 45, temperature: 25, candidates: 3},
+	{elo: 1709, nodes: 6000, noise: 30, temperature: 18, candidates: 3},
+	{elo: 2101, nodes: 12000, noise: 20, temperature: 12, candidates: 2},
+	{elo: 2409, nodes: 25000, noise: 12, temperature: 8, candidates: 2},
+	{elo: 2632, nodes: 50000, noise: 6, temperature: 4, candidates: 2},
+	{elo: 2800, nodes: 100000, noise: 0, temperature: 0, candidates: 1},
+}
+
+// handicapOf is the handicap of playing strength elo. The node limit is
+// interpolated geometrically, the rest linearly.
+func handicapOf(elo int) handicap {
+	elo = Clamp(elo, handicaps[0].elo, handicaps[len(handicaps)-1].elo)
+
+	i := 0
+	for i < len(handicaps)-2 && handicaps[i+1].elo < elo {
+		i++
+	}
+	lo, hi := handicaps[i], handicaps[i+1]
+	frac := float64(elo-lo.elo) / float64(hi.elo-lo.elo)
+
+	lerp := func(a, b float64) float64 { return a + (b-a)*frac }
+
+	return handicap{
+		elo:         elo,
+		nodes:       int(math.Round(float64(lo.nodes) * math.Pow(float64(hi.nodes)/float64(lo.nodes), frac))),
+		noise:       Score(math.Round(lerp(float64(lo.noise), float64(hi.noise)))),
+		temperature: lerp(lo.temperature, hi.temperature),
+		candidates:  int(math.Round(lerp(float64(lo.candidates), float64(hi.candidates)))),
+	}
+}
+
+// skillElo is the playing strength of Skill Level skill.
+func skillElo(skill int) int {
+	return minimalElo + skill*(maximalElo-minimalElo)/maximalSkill
+}
+
+// handicap is the handicap set by the UCI_LimitStrength, UCI_Elo and Skill
+// Level options. ok is false for full strength. UCI_LimitStrength takes
+// precedence over Skill Level.
+func (d *Driver) handicap() (h handicap, ok bool) {
+	switch {
+	case d.limitStrength:
+		return handicapOf(d.elo), true
+	case d.skill < maximalSkill:
+		return handicapOf(skillElo(d.skill)), true
+	}
+	return handicap{}, false
+}
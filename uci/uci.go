@@ -2,9 +2,9 @@ package uci
 
 import (
 	"bufio"
-	"errors"
 	"fmt"
 	"io"
+	"math/rand/v2"
 	"os"
 	"slices"
 	"strconv"
@@ -13,12 +13,17 @@ import (
 	"time"
 
 	"github.com/paulsonkoly/chess-3/board"
+	"github.com/paulsonkoly/chess-3/book"
 	"github.com/paulsonkoly/chess-3/debug"
+	"github.com/paulsonkoly/chess-3/engine"
 	"github.com/paulsonkoly/chess-3/eval"
 	"github.com/paulsonkoly/chess-3/move"
+	"github.com/paulsonkoly/chess-3/nnue"
 	"github.com/paulsonkoly/chess-3/params"
 	"github.com/paulsonkoly/chess-3/search"
+	"github.com/paulsonkoly/chess-3/tablebase"
 	"github.com/paulsonkoly/chess-3/transp"
+	"github.com/paulsonkoly/chess-3/wdl"
 
 	. "github.com/paulsonkoly/chess-3/chess"
 )
@@ -26,8 +31,25 @@ import (
 const (
 	defaultHash    = 1
 	minimalHash    = 1
-	maximalHash    = 1024
-	OutputBufDepth = 4 // Depth of the output channel.
+	maximalHash    = 65536
+	defaultThreads = 1
+	minimalThreads = 1
+	maximalThreads = 256
+	defaultMultiPV = 1
+	minimalMultiPV = 1
+	maximalMultiPV = 256
+	// CurrMoveTime is in milliseconds.
+	defaultCurrMoveTime = 3000
+	minimalCurrMoveTime = 0
+	maximalCurrMoveTime = 3600000
+	defaultContempt     = 0
+	minimalContempt     = -200
+	maximalContempt     = 200
+	// Move Overhead is in milliseconds.
+	defaultMoveOverhead = 30
+	minimalMoveOverhead = 0
+	maximalMoveOverhead = 5000
+	OutputBufDepth      = 4 // Depth of the output channel.
 )
 
 var GitVersion = "dev"
@@ -44,8 +66,26 @@ type Driver struct {
 	output     *output
 	err        io.Writer
 	inputLines chan string
+	tb         *tablebase.Tablebase
+	book       *book.Book
+	rand       *rand.Rand // rand picks the book moves.
+	net        *nnue.Network
+	coeffs     *eval.CoeffSet[Score]
+	multiPV    int
+	currMove   int64 // currMove is the time in milliseconds after which root moves are reported.
+	overhead   int64 // overhead is the time in milliseconds reserved for communication per move.
 	debug      bool
 	ponder     bool
+	ownBook    bool
+	chess960   bool
+	showWDL    bool
+	contempt   Score
+	dynamic    bool // dynamic is the dynamic contempt.
+	// limitStrength, elo and skill are the strength limiting options, see
+	// handicap.
+	limitStrength bool
+	elo           int
+	skill         int
 }
 
 // output is an io.Writer that synchronizes writes through a write channel
@@ -84,6 +124,11 @@ type Search interface {
 	Go(*board.Board, ...search.Option) (Score, move.Move, move.Move)
 	Clear()
 	ResizeTT(int)
+	SetThreads(int)
+	SetTablebase(*tablebase.Tablebase)
+	SetEvaluator(func() search.Evaluator)
+	SaveTT(io.Writer) error
+	LoadTT(io.Reader) error
 }
 
 type driverOpts struct {
@@ -91,6 +136,7 @@ type driverOpts struct {
 	output io.Writer
 	err    io.Writer
 	search Search
+	rand   *rand.Rand
 }
 
 // WithInput replaces the default os.Stdin in the driver with the user specified io.Reader.
@@ -105,6 +151,10 @@ func WithError(err io.Writer) DriverOpt { return func(o *driverOpts) { o.err = e
 // WithSearch replaces the default Search with the user specified one.
 func WithSearch(s Search) DriverOpt { return func(o *driverOpts) { o.search = s } }
 
+// WithRand replaces the default randomly seeded source of the book move
+// choice with r.
+func WithRand(r *rand.Rand) DriverOpt { return func(o *driverOpts) { o.rand = r } }
+
 // DriverOpt is an option for creating a new UCI driver.
 type DriverOpt func(*driverOpts)
 
@@ -124,12 +174,24 @@ func NewDriver(opts ...DriverOpt) *Driver {
 		actual.search = search.New(1 * transp.MegaBytes)
 	}
 
+	if actual.rand == nil {
+		actual.rand = rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+	}
+
 	return &Driver{
-		board:  board.StartPos(),
-		search: actual.search,
-		input:  bufio.NewScanner(actual.input),
-		output: newOutput(actual.output, nil),
-		err:    actual.err,
+		board:    board.StartPos(),
+		search:   actual.search,
+		input:    bufio.NewScanner(actual.input),
+		output:   newOutput(actual.output, nil),
+		err:      actual.err,
+		rand:     actual.rand,
+		net:      nnue.Default(),
+		coeffs:   &eval.Coefficients,
+		multiPV:  defaultMultiPV,
+		currMove: defaultCurrMoveTime,
+		overhead: defaultMoveOverhead,
+		elo:      defaultElo,
+		skill:    maximalSkill,
 	}
 }
 
@@ -200,9 +262,30 @@ func (d *Driver) handleCommand(command string) {
 		fmt.Fprintf(d.output, "id name chess-3 %s\n", GitVersion)
 		fmt.Fprintln(d.output, "id author Paul Sonkoly")
 		fmt.Fprintf(d.output, "option name Hash type spin default %d min %d max %d\n", defaultHash, minimalHash, maximalHash)
-		// these are here to conform ob. we don't actually support these options.
-		fmt.Fprintln(d.output, "option name Threads type spin default 1 min 1 max 1")
+		fmt.Fprintf(d.output, "option name Threads type spin default %d min %d max %d\n",
+			defaultThreads, minimalThreads, maximalThreads)
 		fmt.Fprintln(d.output, "option name Ponder type check default false")
+		fmt.Fprintf(d.output, "option name MultiPV type spin default %d min %d max %d\n",
+			defaultMultiPV, minimalMultiPV, maximalMultiPV)
+		fmt.Fprintf(d.output, "option name CurrMoveTime type spin default %d min %d max %d\n",
+			defaultCurrMoveTime, minimalCurrMoveTime, maximalCurrMoveTime)
+		fmt.Fprintf(d.output, "option name Move Overhead type spin default %d min %d max %d\n",
+			defaultMoveOverhead, minimalMoveOverhead, maximalMoveOverhead)
+		fmt.Fprintln(d.output, "option name SyzygyPath type string default <empty>")
+		fmt.Fprintln(d.output, "option name OwnBook type check default false")
+		fmt.Fprintln(d.output, "option name BookFile type string default <empty>")
+		fmt.Fprintln(d.output, "option name UCI_Chess960 type check default false")
+		fmt.Fprintln(d.output, "option name UCI_ShowWDL type check default false")
+		fmt.Fprintf(d.output, "option name Contempt type spin default %d min %d max %d\n",
+			defaultContempt, minimalContempt, maximalContempt)
+		fmt.Fprintln(d.output, "option name DynamicContempt type check default false")
+		fmt.Fprintln(d.output, "option name UCI_LimitStrength type check default false")
+		fmt.Fprintf(d.output, "option name UCI_Elo type spin default %d min %d max %d\n",
+			defaultElo, minimalElo, maximalElo)
+		fmt.Fprintf(d.output, "option name Skill Level type spin default %d min 0 max %d\n",
+			maximalSkill, maximalSkill)
+		fmt.Fprintln(d.output, "option name EvalFile type string default <empty>")
+		fmt.Fprintln(d.output, "option name CoeffFile type string default <empty>")
 		// spsa options
 		fmt.Fprint(d.output, params.UCIOptions())
 		fmt.Fprintln(d.output, "uciok")
@@ -252,7 +335,59 @@ func (d *Driver) handleCommand(command string) {
 
 	case "spsa":
 		fmt.Fprint(d.output, params.OpenbenchInfo())
+
+	case "savehash":
+		d.handleSaveHash(parts[1:])
+
+	case "loadhash":
+		d.handleLoadHash(parts[1:])
+	}
+}
+
+// handleSaveHash saves the transposition table to the file given by args.
+func (d *Driver) handleSaveHash(args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(d.err, "file name missing")
+		return
+	}
+
+	f, err := os.Create(strings.Join(args, " "))
+	if err != nil {
+		fmt.Fprintln(d.err, err)
+		return
+	}
+
+	err = d.search.SaveTT(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		fmt.Fprintln(d.err, err)
+		return
+	}
+	fmt.Fprintln(d.output, "info string saved hash")
+}
+
+// handleLoadHash loads the transposition table from the file given by args.
+// The file has to be saved with the current Hash size.
+func (d *Driver) handleLoadHash(args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(d.err, "file name missing")
+		return
 	}
+
+	f, err := os.Open(strings.Join(args, " "))
+	if err != nil {
+		fmt.Fprintln(d.err, err)
+		return
+	}
+	defer f.Close()
+
+	if err := d.search.LoadTT(f); err != nil {
+		fmt.Fprintln(d.err, err)
+		return
+	}
+	fmt.Fprintln(d.output, "info string loaded hash")
 }
 
 func (d *Driver) handlePerft(args []string) {
@@ -280,6 +415,11 @@ func (d *Driver) handlePerft(args []string) {
 }
 
 func (d *Driver) handleSetOption(args []string) {
+	// option names can have spaces
+	if ix := slices.Index(args, "value"); ix > 2 {
+		args = append([]string{args[0], strings.Join(args[1:ix], " ")}, args[ix:]...)
+	}
+
 	if len(args) < 4 {
 		fmt.Fprintln(d.err, "argument missing")
 		return
@@ -297,6 +437,132 @@ func (d *Driver) handleSetOption(args []string) {
 
 		d.search.ResizeTT(val * transp.MegaBytes)
 
+	case "Threads":
+		val, err := strconv.Atoi(args[3])
+		if err != nil || val < minimalThreads || val > maximalThreads {
+			return
+		}
+
+		d.search.SetThreads(val)
+
+	case "MultiPV":
+		val, err := strconv.Atoi(args[3])
+		if err != nil || val < minimalMultiPV || val > maximalMultiPV {
+			return
+		}
+
+		d.multiPV = val
+
+	case "CurrMoveTime":
+		val, err := strconv.Atoi(args[3])
+		if err != nil || val < minimalCurrMoveTime || val > maximalCurrMoveTime {
+			return
+		}
+
+		d.currMove = int64(val)
+
+	case "Move Overhead":
+		val, err := strconv.Atoi(args[3])
+		if err != nil || val < minimalMoveOverhead || val > maximalMoveOverhead {
+			return
+		}
+
+		d.overhead = int64(val)
+
+	case "SyzygyPath":
+		d.setSyzygyPath(strings.Join(args[3:], " "))
+
+	case "OwnBook":
+		switch args[3] {
+		case "true", "True":
+			d.ownBook = true
+		case "false", "False":
+			d.ownBook = false
+
+		default:
+			fmt.Fprintf(d.err, "wrong argument %s", args[3])
+		}
+
+	case "BookFile":
+		d.setBookFile(strings.Join(args[3:], " "))
+
+	case "EvalFile":
+		d.setEvalFile(strings.Join(args[3:], " "))
+
+	case "CoeffFile":
+		d.setCoeffFile(strings.Join(args[3:], " "))
+
+	case "UCI_Chess960":
+		switch args[3] {
+		case "true", "True":
+			d.chess960 = true
+		case "false", "False":
+			d.chess960 = false
+
+		default:
+			fmt.Fprintf(d.err, "wrong argument %s", args[3])
+		}
+
+	case "UCI_LimitStrength":
+		switch args[3] {
+		case "true", "True":
+			d.limitStrength = true
+		case "false", "False":
+			d.limitStrength = false
+
+		default:
+			fmt.Fprintf(d.err, "wrong argument %s", args[3])
+		}
+		d.search.SetEvaluator(d.evaluator())
+
+	case "UCI_Elo":
+		val, err := strconv.Atoi(args[3])
+		if err != nil || val < minimalElo || val > maximalElo {
+			return
+		}
+
+		d.elo = val
+		d.search.SetEvaluator(d.evaluator())
+
+	case "Skill Level":
+		val, err := strconv.Atoi(args[3])
+		if err != nil || val < 0 || val > maximalSkill {
+			return
+		}
+
+		d.skill = val
+		d.search.SetEvaluator(d.evaluator())
+
+	case "Contempt":
+		val, err := strconv.Atoi(args[3])
+		if err != nil || val < minimalContempt || val > maximalContempt {
+			return
+		}
+
+		d.contempt = Score(val)
+
+	case "DynamicContempt":
+		switch args[3] {
+		case "true", "True":
+			d.dynamic = true
+		case "false", "False":
+			d.dynamic = false
+
+		default:
+			fmt.Fprintf(d.err, "wrong argument %s", args[3])
+		}
+
+	case "UCI_ShowWDL":
+		switch args[3] {
+		case "true", "True":
+			d.showWDL = true
+		case "false", "False":
+			d.showWDL = false
+
+		default:
+			fmt.Fprintf(d.err, "wrong argument %s", args[3])
+		}
+
 	case "Ponder":
 		switch args[3] {
 		case "true", "True": // TODO : is lower case needed?
@@ -319,6 +585,100 @@ func (d *Driver) handleSetOption(args []string) {
 	}
 }
 
+// setSyzygyPath replaces the tablebase with the one found in path. An empty
+// path disables the tablebase.
+func (d *Driver) setSyzygyPath(path string) {
+	var tb *tablebase.Tablebase
+
+	if path != "" && path != "<empty>" {
+		var err error
+		if tb, err = tablebase.Open(path); err != nil {
+			fmt.Fprintln(d.err, err)
+			return
+		}
+		fmt.Fprintf(d.output, "info string found %d piece tablebase\n", tb.MaxPieces())
+	}
+
+	d.search.SetTablebase(tb)
+
+	if d.tb != nil {
+		if err := d.tb.Close(); err != nil {
+			fmt.Fprintln(d.err, err)
+		}
+	}
+	d.tb = tb
+}
+
+// setBookFile replaces the opening book with the one in path. An empty path
+// removes the book.
+func (d *Driver) setBookFile(path string) {
+	if path == "" || path == "<empty>" {
+		d.book = nil
+		return
+	}
+
+	bk, err := book.Open(path)
+	if err != nil {
+		fmt.Fprintln(d.err, err)
+		return
+	}
+	d.book = bk
+}
+
+// setEvalFile replaces the NNUE network with the one in path. An empty path
+// reverts to the embedded network, or to the hand crafted evaluation if there
+// is none.
+func (d *Driver) setEvalFile(path string) {
+	net := nnue.Default()
+
+	if path != "" && path != "<empty>" {
+		var err error
+		if net, err = nnue.Load(path); err != nil {
+			fmt.Fprintln(d.err, err)
+			return
+		}
+		fmt.Fprintf(d.output, "info string loaded network with %d hidden neurons\n", net.Hidden())
+	}
+
+	d.net = net
+	d.search.SetEvaluator(d.evaluator())
+}
+
+// setCoeffFile replaces the hand crafted evaluation coefficients with the ones
+// in path. An empty path reverts to the compiled in coefficients.
+func (d *Driver) setCoeffFile(path string) {
+	coeffs := &eval.Coefficients
+
+	if path != "" && path != "<empty>" {
+		var err error
+		if coeffs, err = eval.LoadCoefficients(path); err != nil {
+			fmt.Fprintln(d.err, err)
+			return
+		}
+		fmt.Fprintln(d.output, "info string loaded coefficients")
+	}
+
+	d.coeffs = coeffs
+	d.search.SetEvaluator(d.evaluator())
+}
+
+// evaluator is the evaluator constructor for the search, the NNUE network if
+// there is one, otherwise the hand crafted evaluation. The evaluation is noisy
+// with a strength handicap.
+func (d *Driver) evaluator() func() search.Evaluator {
+	net, coeffs := d.net, d.coeffs
+
+	newEval := func() search.Evaluator { return search.NewHCE(coeffs) }
+	if net != nil {
+		newEval = func() search.Evaluator { return search.NewNNUE(net) }
+	}
+
+	if h, ok := d.handicap(); ok && h.noise > 0 {
+		return search.NoisyEvaluators(newEval, h.noise)
+	}
+	return newEval
+}
+
 func (d *Driver) handlePosition(args []string) {
 	if len(args) == 0 {
 		return
@@ -344,7 +704,11 @@ func (d *Driver) handlePosition(args []string) {
 			fmt.Fprintf(d.err, "invalid fen %v\n", err)
 			return
 		}
-		if err := b.Valid(); err != nil {
+		valid := b.Valid
+		if d.chess960 {
+			valid = b.Valid960
+		}
+		if err := valid(); err != nil {
 			fmt.Fprintln(d.err, err)
 			return
 		}
@@ -359,7 +723,7 @@ func (d *Driver) handlePosition(args []string) {
 func (d *Driver) applyMoves(moves []string) {
 	b := d.board
 	for _, ms := range moves {
-		m, err := parseUCIMove(b, ms)
+		m, err := b.ParseUCIMove(ms)
 
 		if err != nil {
 			fmt.Fprintln(d.err, err)
@@ -370,114 +734,58 @@ func (d *Driver) applyMoves(moves []string) {
 	}
 }
 
-func parseUCIMove(b *board.Board, uciM string) (move.Move, error) {
-	if len(uciM) != 4 && len(uciM) != 5 {
-		return 0, errors.New("invalid uci move")
-	}
-	from := Square((uciM[0] - 'a') + (uciM[1]-'1')*8)
-	to := Square((uciM[2] - 'a') + (uciM[3]-'1')*8)
-	if from < A1 || from > H8 || to < A1 || to > H8 {
-		return 0, errors.New("invalid uci move")
-	}
-	var promo Piece
-	if len(uciM) == 5 {
-		switch uciM[4] {
-		case 'q':
-			promo = Queen
-		case 'r':
-			promo = Rook
-		case 'b':
-			promo = Bishop
-		case 'n':
-			promo = Knight
-		default:
-			return 0, errors.New("invalid uci move")
-		}
-	}
-
-	m := move.From(from) | move.To(to) | move.Promo(promo)
-	if !b.IsPseudoLegal(m) {
-		return 0, errors.New("uci move not pseudo-legal")
-	}
-
-	return m, nil
-}
-
 func (d *Driver) handleEval() {
-	fmt.Fprintln(d.output, eval.New[Score]().Score(d.board, &eval.Coefficients))
-}
-
-type timeControl struct {
-	wtime     int64 // White time in milliseconds
-	btime     int64 // Black time in milliseconds
-	winc      int64 // White increment per move in milliseconds
-	binc      int64 // Black increment per move in milliseconds
-	mtime     int64 // move time
-	movestogo int   // uci movestogo option
-}
-
-func (tc timeControl) timedMode(stm Color) bool {
-	return (stm == White && tc.wtime > 0) || (stm == Black && tc.btime > 0) || tc.mtime > 0
-}
-
-const (
-	TimeSafetyMargin = 30
-	PredictedMoves   = 30
-	TimeInf          = int64(1 << 50)
-)
-
-func (tc timeControl) softLimit(stm Color) int64 {
-	if tc.mtime > 0 {
-		return tc.mtime
-	}
-
-	movestogo := PredictedMoves
-	if 0 < tc.movestogo && tc.movestogo < PredictedMoves {
-		movestogo = tc.movestogo
-	}
-
-	if stm == White && tc.wtime > 0 {
-		return tc.wtime/int64(movestogo) + tc.winc/2
-	}
-
-	if stm == Black && tc.btime > 0 {
-		return tc.btime/int64(movestogo) + tc.binc/2
+	if d.net != nil {
+		fmt.Fprintln(d.output, d.net.Evaluate(d.board))
+		return
 	}
-
-	return TimeInf
+	fmt.Fprintln(d.output, eval.New[Score]().Score(d.board, d.coeffs))
 }
 
-func (tc timeControl) hardLimit(stm Color) int64 {
-	if tc.mtime > 0 {
-		return tc.mtime
-	}
+var goArgsWithVal = [...]string{"wtime", "btime", "winc", "binc", "depth", "nodes", "movetime", "movestogo", "mate"}
 
-	timeLeft := TimeInf
-
-	if stm == White && tc.wtime > 0 {
-		timeLeft = tc.wtime
-	}
+var goArgs = [...]string{
+	"searchmoves", "ponder", "wtime", "btime", "winc", "binc", "movestogo", "depth", "nodes", "mate", "movetime",
+	"infinite",
+}
 
-	if stm == Black && tc.btime > 0 {
-		timeLeft = tc.btime
+// infoHandler is the info handler of a search of multiPV lines. The handicap
+// can widen the search to more lines than the MultiPV option, only the lines
+// asked for are reported.
+func (d *Driver) infoHandler(multiPV int) func(search.Info) {
+	report, reported := search.UCIInfo(d.output, d.chess960), d.multiPV
+	if multiPV <= reported {
+		return report
 	}
 
-	if timeLeft <= TimeSafetyMargin {
-		// we are losing on time anyway, but at least allocate time
-		return timeLeft
+	return func(info search.Info) {
+		if info.MultiPV > reported {
+			return
+		}
+		if reported == 1 {
+			info.MultiPV = 0
+		}
+		report(info)
 	}
-
-	return Clamp(4*tc.softLimit(stm), TimeSafetyMargin, timeLeft-TimeSafetyMargin)
 }
 
-var goArgsWithVal = [...]string{"wtime", "btime", "winc", "binc", "depth", "nodes", "movetime", "movestogo"}
-
 func (d *Driver) handleGo(args []string) (quit bool) {
 	opts := make([]search.Option, 0, 4)
 
 	ponder := false
+	infinite := false
+	// restricted is whether the go command asks for something a book move
+	// does not answer
+	restricted := false
+
+	tc := engine.Limits{Overhead: time.Duration(d.overhead) * time.Millisecond}
 
-	tc := timeControl{}
+	multiPV := d.multiPV
+	h, limited := d.handicap()
+	if limited && h.candidates > 1 {
+		opts = append(opts, search.WithTemperature(h.temperature, nil))
+		multiPV = max(multiPV, h.candidates)
+	}
 
 	for i := range args {
 		if slices.Contains(goArgsWithVal[:], args[i]) && len(args) <= i+1 {
@@ -488,30 +796,70 @@ func (d *Driver) handleGo(args []string) (quit bool) {
 		switch args[i] {
 		case "ponder":
 			ponder = d.ponder
+		case "infinite":
+			infinite = true
 		case "wtime":
-			tc.wtime = parseInt64(args[i+1])
+			tc.WTime = parseDuration(args[i+1])
 		case "btime":
-			tc.btime = parseInt64(args[i+1])
+			tc.BTime = parseDuration(args[i+1])
 		case "winc":
-			tc.winc = parseInt64(args[i+1])
+			tc.WInc = parseDuration(args[i+1])
 		case "binc":
-			tc.binc = parseInt64(args[i+1])
+			tc.BInc = parseDuration(args[i+1])
 		case "depth":
+			restricted = true
 			depth := Depth(parseInt(args[i+1]))
 			opts = append(opts, search.WithDepth(depth))
 		case "nodes":
 			nodes := parseInt(args[i+1])
 			opts = append(opts, search.WithNodes(nodes))
+		case "mate":
+			restricted = true
+			mate := parseInt(args[i+1])
+			opts = append(opts, search.WithMate(mate))
 		case "movetime":
-			tc.mtime = parseInt64(args[i+1])
+			tc.MoveTime = parseDuration(args[i+1])
 		case "movestogo":
-			tc.movestogo = parseInt(args[i+1])
+			tc.MovesToGo = parseInt(args[i+1])
+		case "searchmoves":
+			restricted = true
+			moves := make([]move.Move, 0, len(args)-i-1)
+			for _, uciM := range args[i+1:] {
+				if slices.Contains(goArgs[:], uciM) {
+					break
+				}
+
+				m, err := d.board.ParseUCIMove(uciM)
+				if err != nil {
+					fmt.Fprintln(d.err, err)
+					break
+				}
+				moves = append(moves, m)
+			}
+			opts = append(opts, search.WithRootMoves(moves))
+		}
+	}
+
+	// the node limit of the go command overrides the hard node limit of the
+	// handicap. The node limits apply to all threads together. go infinite
+	// runs until stop, and pondering applies the limits from the ponder hit.
+	if limited && !infinite {
+		opts = append([]search.Option{search.WithSoftNodes(h.nodes), search.WithNodes(4 * h.nodes)}, opts...)
+	}
+
+	// book moves are played instantly, unless we are analysing, pondering,
+	// searching for a depth, a mate or among some moves, or playing Chess960
+	if d.ownBook && d.book != nil && !ponder && !infinite && !restricted && !d.chess960 {
+		if m, ok := d.book.Pick(d.board, d.rand); ok {
+			fmt.Fprintf(d.output, "bestmove %s\n", m.UCI(d.chess960))
+			return false
 		}
 	}
 
 	stm := d.board.STM
-	if tc.timedMode(stm) {
-		opts = append(opts, search.WithSoftTime(tc.softLimit(stm)))
+	if tc.Timed(stm) {
+		opts = append(opts, search.WithSoftTime(tc.SoftTime(stm).Milliseconds()))
+		opts = append(opts, search.WithFixedTime(tc.MoveTime > 0))
 	}
 
 	var ponderHit chan time.Time
@@ -525,7 +873,17 @@ func (d *Driver) handleGo(args []string) (quit bool) {
 		opts = append(opts, search.WithDebug(true))
 	}
 
+	opts = append(opts, search.WithMultiPV(multiPV))
+	opts = append(opts, search.WithCurrMoveTime(d.currMove))
+	opts = append(opts, search.WithContempt(d.contempt, d.dynamic))
+	opts = append(opts, search.WithChess960(d.chess960))
+
+	if d.showWDL {
+		opts = append(opts, search.WithWDL(&wdl.Default))
+	}
+
 	opts = append(opts, search.WithOutput(d.output))
+	opts = append(opts, search.WithInfoHandler(d.infoHandler(multiPV)))
 
 	// stop is always needed in order to support stop command, regardless of timeouts.
 	stop := make(chan struct{})
@@ -541,8 +899,8 @@ func (d *Driver) handleGo(args []string) (quit bool) {
 
 		var hardTimer *time.Timer
 		var hardC <-chan time.Time
-		if !ponder && tc.timedMode(stm) {
-			hardTimer = time.NewTimer(time.Duration(tc.hardLimit(stm)) * time.Millisecond)
+		if !ponder && tc.Timed(stm) {
+			hardTimer = time.NewTimer(tc.HardTime(stm))
 			hardC = hardTimer.C
 			defer hardTimer.Stop()
 		}
@@ -576,8 +934,8 @@ func (d *Driver) handleGo(args []string) (quit bool) {
 						ponderHit <- time.Now()
 						ponderHit = nil
 					}
-					if ponder && tc.timedMode(stm) {
-						hardTimer = time.NewTimer(time.Duration(tc.hardLimit(stm)) * time.Millisecond)
+					if ponder && tc.Timed(stm) {
+						hardTimer = time.NewTimer(tc.HardTime(stm))
 						hardC = hardTimer.C
 						defer hardTimer.Stop()
 					}
@@ -608,9 +966,9 @@ func (d *Driver) handleGo(args []string) (quit bool) {
 	// defined as the duration starting with receiving a go command and ending
 	// with responding with "bestmove".
 	if pm != 0 && d.ponder {
-		fmt.Fprintf(d.output, "bestmove %s ponder %s\n", bm, pm)
+		fmt.Fprintf(d.output, "bestmove %s ponder %s\n", bm.UCI(d.chess960), pm.UCI(d.chess960))
 	} else {
-		fmt.Fprintf(d.output, "bestmove %s\n", bm)
+		fmt.Fprintf(d.output, "bestmove %s\n", bm.UCI(d.chess960))
 	}
 
 	return quit
@@ -632,6 +990,11 @@ func parseInt64(value string) int64 {
 	return result
 }
 
+// parseDuration parses value in milliseconds.
+func parseDuration(value string) time.Duration {
+	return time.Duration(parseInt64(value)) * time.Millisecond
+}
+
 func firstWord(s string) string {
 	i := 0
 	for i < len(s) && (s[i] == ' ' || s[i] == '\t') {
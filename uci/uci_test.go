@@ -2,13 +2,22 @@ package uci_test
 
 import (
 	"bytes"
+	"encoding/binary"
+	"io"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/paulsonkoly/chess-3/board"
 	. "github.com/paulsonkoly/chess-3/chess"
+	"github.com/paulsonkoly/chess-3/eval"
 	"github.com/paulsonkoly/chess-3/move"
+	"github.com/paulsonkoly/chess-3/nnue"
 	"github.com/paulsonkoly/chess-3/search"
+	"github.com/paulsonkoly/chess-3/tablebase"
 	"github.com/paulsonkoly/chess-3/transp"
 	"github.com/paulsonkoly/chess-3/uci"
 	"github.com/stretchr/testify/assert"
@@ -17,7 +26,12 @@ import (
 type MockSearch struct {
 	Cleared bool
 	TTSize  int
+	Threads int
+	TB      *tablebase.Tablebase
+	Eval    search.Evaluator
 	Options search.Options
+	Hash    string
+	Infos   []search.Info // Infos are reported by Go.
 	move    move.Move
 	score   Score
 }
@@ -30,11 +44,44 @@ func (ms *MockSearch) ResizeTT(size int) {
 	ms.TTSize = size
 }
 
+func (ms *MockSearch) SetThreads(n int) {
+	ms.Threads = n
+}
+
+func (ms *MockSearch) SetTablebase(tb *tablebase.Tablebase) {
+	ms.TB = tb
+}
+
+func (ms *MockSearch) SetEvaluator(newEval func() search.Evaluator) {
+	ms.Eval = newEval()
+}
+
+func (ms *MockSearch) SaveTT(w io.Writer) error {
+	_, err := io.WriteString(w, ms.Hash)
+	return err
+}
+
+func (ms *MockSearch) LoadTT(r io.Reader) error {
+	hash, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if len(hash) == 0 {
+		return transp.ErrFormat
+	}
+	ms.Hash = string(hash)
+	return nil
+}
+
 func (ms *MockSearch) Go(_ *board.Board, opts ...search.Option) (Score, move.Move, move.Move) {
 	for _, opt := range opts {
 		opt(&ms.Options)
 	}
 
+	for _, info := range ms.Infos {
+		ms.Options.InfoHandler(info)
+	}
+
 	return ms.score, ms.move, 0
 }
 
@@ -128,9 +175,9 @@ func TestHashSettings(t *testing.T) {
 		{"dangling tokens", "setoption name Hash value 17 extra", 17 * transp.MegaBytes, ""},
 		{"arguments missing", "setoption name Hash", 0, "argument missing"},
 		{"hash at minimum", "setoption name Hash value 1", 1 * transp.MegaBytes, ""},
-		{"hash at maximum", "setoption name Hash value 1024", 1024 * transp.MegaBytes, ""},
+		{"hash at maximum", "setoption name Hash value 65536", 65536 * transp.MegaBytes, ""},
 		{"hash below minimum", "setoption name Hash value 0", 0, ""},
-		{"hash above maximum", "setoption name Hash value 2048", 0, ""},
+		{"hash above maximum", "setoption name Hash value 65537", 0, ""},
 		{"invalid hash value", "setoption name Hash value invalid", 0, ""},
 		{"malformed setoption - missing value", "setoption name Hash", 0, "argument missing"},
 		{"malformed setoption - wrong structure", "setoption whops Hash value 16", 0, ""},
@@ -166,6 +213,403 @@ func TestHashSettings(t *testing.T) {
 	}
 }
 
+func TestSaveLoadHash(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "hash files")
+	assert.NoError(t, os.Mkdir(dir, 0o755))
+	saved := filepath.Join(dir, "saved.tt")
+	assert.NoError(t, os.WriteFile(saved, []byte("saved"), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "empty.tt"), nil, 0o644))
+
+	tests := []struct {
+		name   string
+		inputs string
+		hash   string
+		output string
+		err    bool
+	}{
+		{"loadhash", "loadhash " + saved, "saved", "info string loaded hash", false},
+		{"round trip", "loadhash " + saved + "\nsavehash " + filepath.Join(dir, "new.tt") +
+			"\nloadhash " + filepath.Join(dir, "new.tt"), "saved", "info string saved hash", false},
+		{"missing file", "loadhash " + filepath.Join(dir, "missing.tt"), "", "", true},
+		{"invalid file", "loadhash " + filepath.Join(dir, "empty.tt"), "", "", true},
+		{"missing file name", "savehash", "", "", true},
+		{"invalid path", "savehash " + filepath.Join(dir, "missing", "new.tt"), "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputs := &bytes.Buffer{}
+			errors := &bytes.Buffer{}
+			search := &MockSearch{}
+
+			d := uci.NewDriver(
+				uci.WithInput(strings.NewReader(tt.inputs)),
+				uci.WithOutput(outputs),
+				uci.WithError(errors),
+				uci.WithSearch(search),
+			)
+
+			d.Run()
+
+			assert.Equal(t, tt.err, errors.Len() > 0)
+			assert.Equal(t, tt.hash, search.Hash)
+			assert.Contains(t, outputs.String(), tt.output)
+		})
+	}
+}
+
+func TestThreadsSettings(t *testing.T) {
+	tests := []struct {
+		name   string
+		inputs string
+		want   int
+	}{
+		{"set threads to 4", "setoption name Threads value 4", 4},
+		{"threads at minimum", "setoption name Threads value 1", 1},
+		{"threads at maximum", "setoption name Threads value 256", 256},
+		{"threads below minimum", "setoption name Threads value 0", 0},
+		{"threads above maximum", "setoption name Threads value 257", 0},
+		{"invalid threads value", "setoption name Threads value invalid", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputs := &bytes.Buffer{}
+			errors := &bytes.Buffer{}
+			search := &MockSearch{}
+
+			prelude := "uci\n"
+
+			inputs := prelude + tt.inputs
+
+			d := uci.NewDriver(
+				uci.WithInput(strings.NewReader(inputs)),
+				uci.WithOutput(outputs),
+				uci.WithError(errors),
+				uci.WithSearch(search),
+			)
+
+			d.Run()
+
+			assert.Empty(t, errors)
+			assert.Equal(t, tt.want, search.Threads)
+		})
+	}
+}
+
+func TestSyzygyPath(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "syzygy tables")
+	assert.NoError(t, os.Mkdir(dir, 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "KRvK.rtbw"), nil, 0o644))
+
+	tests := []struct {
+		name   string
+		inputs string
+		tb     bool
+		output string
+		err    bool
+	}{
+		{"path with space", "setoption name SyzygyPath value " + dir, true, "info string found 3 piece tablebase", false},
+		{"missing path", "setoption name SyzygyPath value " + filepath.Join(dir, "missing"), false, "", true},
+		{"empty path", "setoption name SyzygyPath value <empty>", false, "", false},
+		{"path reset", "setoption name SyzygyPath value " + dir + "\nsetoption name SyzygyPath value <empty>",
+			false, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputs := &bytes.Buffer{}
+			errors := &bytes.Buffer{}
+			search := &MockSearch{}
+
+			d := uci.NewDriver(
+				uci.WithInput(strings.NewReader(tt.inputs)),
+				uci.WithOutput(outputs),
+				uci.WithError(errors),
+				uci.WithSearch(search),
+			)
+
+			d.Run()
+
+			assert.Equal(t, tt.err, errors.Len() > 0)
+			assert.Equal(t, tt.tb, search.TB != nil)
+			assert.Contains(t, outputs.String(), tt.output)
+		})
+	}
+}
+
+func TestEvalFile(t *testing.T) {
+	dir := t.TempDir()
+	net := filepath.Join(dir, "zero.nnue")
+	assert.NoError(t, os.WriteFile(net, make([]byte, 2*(16*(nnue.Inputs+3)+1)), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "bad.nnue"), []byte("bad"), 0o644))
+
+	tests := []struct {
+		name   string
+		inputs string
+		net    bool
+		output string
+		err    bool
+	}{
+		{"network", "setoption name EvalFile value " + net + "\neval", true,
+			"info string loaded network with 16 hidden neurons\ncp 0\n", false},
+		{"missing file", "setoption name EvalFile value " + filepath.Join(dir, "missing.nnue"), false, "", true},
+		{"invalid file", "setoption name EvalFile value " + filepath.Join(dir, "bad.nnue"), false, "", true},
+		{"reset", "setoption name EvalFile value " + net + "\nsetoption name EvalFile value <empty>", false, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputs := &bytes.Buffer{}
+			errors := &bytes.Buffer{}
+			mock := &MockSearch{}
+
+			d := uci.NewDriver(
+				uci.WithInput(strings.NewReader(tt.inputs)),
+				uci.WithOutput(outputs),
+				uci.WithError(errors),
+				uci.WithSearch(mock),
+			)
+
+			d.Run()
+
+			assert.Equal(t, tt.err, errors.Len() > 0)
+			if tt.net {
+				assert.IsType(t, &search.NNUE{}, mock.Eval)
+			} else if mock.Eval != nil {
+				assert.IsType(t, &search.HCE{}, mock.Eval)
+			}
+			assert.Contains(t, outputs.String(), tt.output)
+		})
+	}
+}
+
+func TestCoeffFile(t *testing.T) {
+	dir := t.TempDir()
+	coeffs := filepath.Join(dir, "coeffs.json")
+	f, err := os.Create(coeffs)
+	assert.NoError(t, err)
+	assert.NoError(t, eval.Coefficients.WriteJSON(f))
+	assert.NoError(t, f.Close())
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "bad.json"), []byte(`{"PSqT": 1}`), 0o644))
+
+	tests := []struct {
+		name   string
+		inputs string
+		output string
+		err    bool
+	}{
+		{"coefficients", "setoption name CoeffFile value " + coeffs, "info string loaded coefficients\n", false},
+		{"missing file", "setoption name CoeffFile value " + filepath.Join(dir, "missing.json"), "", true},
+		{"invalid file", "setoption name CoeffFile value " + filepath.Join(dir, "bad.json"), "", true},
+		{"reset", "setoption name CoeffFile value <empty>", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputs := &bytes.Buffer{}
+			errors := &bytes.Buffer{}
+			mock := &MockSearch{}
+
+			d := uci.NewDriver(
+				uci.WithInput(strings.NewReader(tt.inputs)),
+				uci.WithOutput(outputs),
+				uci.WithError(errors),
+				uci.WithSearch(mock),
+			)
+
+			d.Run()
+
+			assert.Equal(t, tt.err, errors.Len() > 0)
+			assert.Equal(t, tt.err, mock.Eval == nil)
+			assert.Contains(t, outputs.String(), tt.output)
+		})
+	}
+}
+
+func TestBookOptions(t *testing.T) {
+	tests := []struct {
+		name   string
+		inputs string
+		err    bool
+	}{
+		{"own book", "setoption name OwnBook value true", false},
+		{"own book invalid", "setoption name OwnBook value yes", true},
+		{"missing book file", "setoption name BookFile value " + filepath.Join(t.TempDir(), "book.bin"), true},
+		{"empty book file", "setoption name BookFile value <empty>", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputs := &bytes.Buffer{}
+			errors := &bytes.Buffer{}
+
+			d := uci.NewDriver(
+				uci.WithInput(strings.NewReader(tt.inputs)),
+				uci.WithOutput(outputs),
+				uci.WithError(errors),
+				uci.WithSearch(&MockSearch{}),
+			)
+
+			d.Run()
+
+			assert.Equal(t, tt.err, errors.Len() > 0)
+		})
+	}
+}
+
+// writeBook writes a book of e2e4 and d2d4 from the start position.
+func writeBook(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "book.bin")
+	key := uint64(board.StartPos().PolyglotKey())
+	data := []byte{}
+	for _, pm := range []uint16{uint16(E4) | uint16(E2)<<6, uint16(D4) | uint16(D2)<<6} {
+		data = binary.BigEndian.AppendUint64(data, key)
+		data = binary.BigEndian.AppendUint16(data, pm)
+		data = binary.BigEndian.AppendUint16(data, 1)
+		data = binary.BigEndian.AppendUint32(data, 0)
+	}
+	assert.NoError(t, os.WriteFile(path, data, 0o644))
+	return path
+}
+
+func TestBookMove(t *testing.T) {
+	path := writeBook(t)
+
+	inputs := "setoption name OwnBook value true\nsetoption name BookFile value " + path + "\n" +
+		strings.Repeat("go movetime 10\n", 16)
+
+	bestMoves := func() string {
+		outputs := &bytes.Buffer{}
+		errors := &bytes.Buffer{}
+
+		d := uci.NewDriver(
+			uci.WithInput(strings.NewReader(inputs)),
+			uci.WithOutput(outputs),
+			uci.WithError(errors),
+			uci.WithSearch(&MockSearch{}),
+			uci.WithRand(rand.New(rand.NewPCG(1, 2))),
+		)
+
+		d.Run()
+
+		assert.Empty(t, errors)
+		return outputs.String()
+	}
+
+	// the book moves are picked from the injected source
+	want := bestMoves()
+	assert.Equal(t, 16, strings.Count(want, "bestmove "))
+	assert.Contains(t, want, "bestmove e2e4")
+	assert.Contains(t, want, "bestmove d2d4")
+	assert.Equal(t, want, bestMoves())
+}
+
+// TestBookMoveSkipped tests that the go commands asking for something else
+// than the best move are searched.
+func TestBookMoveSkipped(t *testing.T) {
+	path := writeBook(t)
+
+	tests := []struct {
+		name   string
+		inputs string
+	}{
+		{"searchmoves", "go movetime 10 searchmoves g1f3"},
+		{"mate", "go mate 3"},
+		{"depth", "go depth 5"},
+		{"chess960", "setoption name UCI_Chess960 value true\ngo movetime 10"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputs := &bytes.Buffer{}
+			errors := &bytes.Buffer{}
+
+			d := uci.NewDriver(
+				uci.WithInput(strings.NewReader("setoption name OwnBook value true\nsetoption name BookFile value "+path+"\n"+
+					"position startpos\n"+tt.inputs+"\n")),
+				uci.WithOutput(outputs),
+				uci.WithError(errors),
+				uci.WithSearch(&MockSearch{move: move.From(G1) | move.To(F3)}),
+			)
+
+			d.Run()
+
+			assert.Empty(t, errors)
+			assert.Contains(t, outputs.String(), "bestmove g1f3")
+		})
+	}
+}
+
+func TestChess960(t *testing.T) {
+	tests := []struct {
+		name     string
+		inputs   string
+		bestMove move.Move
+		want     string
+		err      bool
+	}{
+		{
+			"standard castling",
+			"position fen r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1 moves e1g1\nfen",
+			0, "r3k2r/8/8/8/8/8/8/R4RK1 b kq - 1 1", false,
+		},
+		{
+			"king takes rook castling",
+			"position fen r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1 moves e1h1\nfen",
+			0, "r3k2r/8/8/8/8/8/8/R4RK1 b kq - 1 1", false,
+		},
+		{
+			"chess960 castling",
+			"setoption name UCI_Chess960 value true\n" +
+				"position fen 1r4kr/8/8/8/8/8/8/1R4KR w BHbh - 0 1 moves g1b1\nfen",
+			0, "1r4kr/8/8/8/8/8/8/2KR3R b kq - 1 1", false,
+		},
+		{
+			"chess960 position in standard chess",
+			"position fen 1r4kr/8/8/8/8/8/8/1R4KR w BHbh - 0 1",
+			0, "", true,
+		},
+		{
+			"standard bestmove",
+			"position fen r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1\ngo depth 1",
+			move.Castling(E1, H1), "bestmove e1g1", false,
+		},
+		{
+			"chess960 bestmove",
+			"setoption name UCI_Chess960 value true\n" +
+				"position fen r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1\ngo depth 1",
+			move.Castling(E1, H1), "bestmove e1h1", false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputs := &bytes.Buffer{}
+			errors := &bytes.Buffer{}
+
+			search := &MockSearch{}
+			search.MockMove(tt.bestMove)
+
+			d := uci.NewDriver(
+				uci.WithInput(strings.NewReader(tt.inputs)),
+				uci.WithOutput(outputs),
+				uci.WithError(errors),
+				uci.WithSearch(search),
+			)
+
+			d.Run()
+
+			assert.Equal(t, tt.err, errors.Len() > 0)
+			assert.Contains(t, outputs.String(), tt.want)
+			if tt.bestMove != 0 {
+				// the search prints the info lines in the same notation
+				assert.Equal(t, strings.Contains(tt.inputs, "UCI_Chess960 value true"), search.Options.Chess960)
+			}
+		})
+	}
+}
+
 func TestInitialFen(t *testing.T) {
 	inputs := `uci
 
@@ -295,6 +739,406 @@ go depth 5
 	assert.Equal(t, Depth(5), search.Options.Depth)
 }
 
+// closeOnBestMove is an output buffer closing closer on the first bestmove.
+type closeOnBestMove struct {
+	bytes.Buffer
+	closer io.Closer
+}
+
+func (c *closeOnBestMove) Write(p []byte) (int, error) {
+	if bytes.Contains(p, []byte("bestmove")) {
+		defer c.closer.Close()
+	}
+	return c.Buffer.Write(p)
+}
+
+// TestGoMoveTime tests that go movetime uses all of the time, even when the
+// best move is stable or forced.
+func TestGoMoveTime(t *testing.T) {
+	tests := []struct {
+		name     string
+		position string
+	}{
+		{"stable best move", "position fen 4k3/8/8/3q4/8/8/8/3QK3 w - - 0 1"},
+		{"single legal move", "position fen 7k/8/8/8/8/8/6q1/K7 w - - 0 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the input is kept open until the search finishes, the end of the
+			// input would stop the search
+			in, inW := io.Pipe()
+			outputs := &closeOnBestMove{closer: inW}
+			errors := &bytes.Buffer{}
+
+			go io.WriteString(inW, tt.position+"\ngo movetime 500\n")
+
+			d := uci.NewDriver(
+				uci.WithInput(in),
+				uci.WithOutput(outputs),
+				uci.WithError(errors),
+			)
+
+			start := time.Now()
+			d.Run()
+			elapsed := time.Since(start)
+
+			assert.Empty(t, errors)
+			assert.Contains(t, outputs.String(), "bestmove")
+			// movetime less the default move overhead
+			assert.Greater(t, elapsed, 450*time.Millisecond)
+			assert.Less(t, elapsed, 1000*time.Millisecond)
+		})
+	}
+}
+
+func TestGoSearchMoves(t *testing.T) {
+	tests := []struct {
+		name      string
+		inputs    string
+		want      []move.Move
+		wantError string
+	}{
+		{
+			"searchmoves",
+			"go searchmoves e2e4 d2d4",
+			[]move.Move{move.From(E2) | move.To(E4), move.From(D2) | move.To(D4)},
+			"",
+		},
+		{"searchmoves followed by depth", "go searchmoves e2e4 depth 5", []move.Move{move.From(E2) | move.To(E4)}, ""},
+		{"searchmoves after depth", "go depth 5 searchmoves g1f3", []move.Move{move.From(G1) | move.To(F3)}, ""},
+		{"invalid move", "go searchmoves e2e4 e2e5", []move.Move{move.From(E2) | move.To(E4)}, "uci move not pseudo-legal"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputs := &bytes.Buffer{}
+			errors := &bytes.Buffer{}
+			search := &MockSearch{}
+
+			prelude := "uci\n"
+
+			inputs := prelude + tt.inputs
+
+			d := uci.NewDriver(
+				uci.WithInput(strings.NewReader(inputs)),
+				uci.WithOutput(outputs),
+				uci.WithError(errors),
+				uci.WithSearch(search),
+			)
+
+			d.Run()
+
+			if tt.wantError == "" {
+				assert.Empty(t, errors)
+			} else {
+				assert.Contains(t, errors.String(), tt.wantError)
+			}
+			assert.Equal(t, tt.want, search.Options.RootMoves)
+		})
+	}
+}
+
+func TestMultiPV(t *testing.T) {
+	tests := []struct {
+		name   string
+		inputs string
+		want   int
+	}{
+		{"default", "go depth 5", 1},
+		{"multipv 3", "setoption name MultiPV value 3\ngo depth 5", 3},
+		{"multipv below minimum", "setoption name MultiPV value 0\ngo depth 5", 1},
+		{"invalid multipv value", "setoption name MultiPV value invalid\ngo depth 5", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputs := &bytes.Buffer{}
+			errors := &bytes.Buffer{}
+			search := &MockSearch{}
+
+			prelude := "uci\n"
+
+			inputs := prelude + tt.inputs
+
+			d := uci.NewDriver(
+				uci.WithInput(strings.NewReader(inputs)),
+				uci.WithOutput(outputs),
+				uci.WithError(errors),
+				uci.WithSearch(search),
+			)
+
+			d.Run()
+
+			assert.Empty(t, errors)
+			assert.Equal(t, tt.want, search.Options.MultiPV)
+		})
+	}
+}
+
+func TestCurrMoveTime(t *testing.T) {
+	tests := []struct {
+		name   string
+		inputs string
+		want   int64
+	}{
+		{"default", "go depth 5", 3000},
+		{"disabled", "setoption name CurrMoveTime value 0\ngo depth 5", 0},
+		{"invalid value", "setoption name CurrMoveTime value -1\ngo depth 5", 3000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputs := &bytes.Buffer{}
+			errors := &bytes.Buffer{}
+			search := &MockSearch{}
+
+			d := uci.NewDriver(
+				uci.WithInput(strings.NewReader(tt.inputs)),
+				uci.WithOutput(outputs),
+				uci.WithError(errors),
+				uci.WithSearch(search),
+			)
+
+			d.Run()
+
+			assert.Empty(t, errors)
+			assert.Equal(t, tt.want, search.Options.CurrMoveTime)
+		})
+	}
+}
+
+func TestMoveOverhead(t *testing.T) {
+	tests := []struct {
+		name   string
+		inputs string
+		want   int64
+	}{
+		{"default", "go wtime 3030 btime 3030", 100},
+		{"overhead", "setoption name Move Overhead value 330\ngo wtime 3030 btime 3030", 90},
+		{"movetime", "setoption name Move Overhead value 100\ngo movetime 1000", 900},
+		{"invalid value", "setoption name Move Overhead value -1\ngo wtime 3030 btime 3030", 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputs := &bytes.Buffer{}
+			errors := &bytes.Buffer{}
+			search := &MockSearch{}
+
+			d := uci.NewDriver(
+				uci.WithInput(strings.NewReader(tt.inputs)),
+				uci.WithOutput(outputs),
+				uci.WithError(errors),
+				uci.WithSearch(search),
+			)
+
+			d.Run()
+
+			assert.Empty(t, errors)
+			assert.Equal(t, tt.want, search.Options.SoftTime)
+		})
+	}
+}
+
+func TestShowWDL(t *testing.T) {
+	tests := []struct {
+		name   string
+		inputs string
+		want   bool
+		err    bool
+	}{
+		{"default", "go depth 5", false, false},
+		{"enabled", "setoption name UCI_ShowWDL value true\ngo depth 5", true, false},
+		{"disabled", "setoption name UCI_ShowWDL value true\nsetoption name UCI_ShowWDL value false\ngo depth 5",
+			false, false},
+		{"invalid value", "setoption name UCI_ShowWDL value maybe\ngo depth 5", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputs := &bytes.Buffer{}
+			errors := &bytes.Buffer{}
+			search := &MockSearch{}
+
+			d := uci.NewDriver(
+				uci.WithInput(strings.NewReader(tt.inputs)),
+				uci.WithOutput(outputs),
+				uci.WithError(errors),
+				uci.WithSearch(search),
+			)
+
+			d.Run()
+
+			assert.Equal(t, tt.err, errors.Len() > 0)
+			assert.Equal(t, tt.want, search.Options.WDL != nil)
+		})
+	}
+}
+
+func TestContempt(t *testing.T) {
+	tests := []struct {
+		name     string
+		inputs   string
+		contempt Score
+		dynamic  bool
+		err      bool
+	}{
+		{"default", "go depth 5", 0, false, false},
+		{"contempt", "setoption name Contempt value 20\ngo depth 5", 20, false, false},
+		{"negative contempt", "setoption name Contempt value -20\ngo depth 5", -20, false, false},
+		{"out of range", "setoption name Contempt value 300\ngo depth 5", 0, false, false},
+		{"dynamic", "setoption name Contempt value 20\nsetoption name DynamicContempt value true\ngo depth 5",
+			20, true, false},
+		{"invalid dynamic", "setoption name DynamicContempt value maybe\ngo depth 5", 0, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputs := &bytes.Buffer{}
+			errors := &bytes.Buffer{}
+			mock := &MockSearch{}
+
+			d := uci.NewDriver(
+				uci.WithInput(strings.NewReader(tt.inputs)),
+				uci.WithOutput(outputs),
+				uci.WithError(errors),
+				uci.WithSearch(mock),
+			)
+
+			d.Run()
+
+			assert.Equal(t, tt.err, errors.Len() > 0)
+			assert.Equal(t, tt.contempt, mock.Options.Contempt)
+			assert.Equal(t, tt.dynamic, mock.Options.DynamicContempt)
+		})
+	}
+}
+
+func TestStrength(t *testing.T) {
+	tests := []struct {
+		name        string
+		inputs      string
+		softNodes   int
+		nodes       int
+		multiPV     int
+		temperature float64
+		noisy       bool
+	}{
+		{"full strength", "go", 0, 0, 1, 0, false},
+		{"limit strength", "setoption name UCI_LimitStrength value true\ngo", 3788, 15152, 3, 22.6444, true},
+		{"elo", "setoption name UCI_LimitStrength value true\nsetoption name UCI_Elo value 1100\ngo",
+			1493, 5972, 3, 35.0746, true},
+		{"elo out of range", "setoption name UCI_LimitStrength value true\nsetoption name UCI_Elo value 900\ngo",
+			3788, 15152, 3, 22.6444, true},
+		{"elo without limit", "setoption name UCI_Elo value 1100\ngo", 0, 0, 1, 0, false},
+		{"skill level", "setoption name Skill Level value 0\ngo", 1277, 5108, 3, 37.5622, true},
+		{"full skill level", "setoption name Skill Level value 20\ngo", 0, 0, 1, 0, false},
+		{"limit over skill level",
+			"setoption name Skill Level value 0\nsetoption name UCI_LimitStrength value true\ngo",
+			3788, 15152, 3, 22.6444, true},
+		{"go nodes", "setoption name UCI_LimitStrength value true\ngo nodes 100", 3788, 100, 3, 22.6444, true},
+		{"go infinite", "setoption name UCI_LimitStrength value true\ngo infinite", 0, 0, 3, 22.6444, true},
+		{"go ponder", "setoption name Ponder value true\nsetoption name UCI_LimitStrength value true\ngo ponder",
+			3788, 15152, 3, 22.6444, true},
+		{"strongest limit", "setoption name UCI_LimitStrength value true\nsetoption name UCI_Elo value 2800\ngo",
+			100000, 400000, 1, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputs := &bytes.Buffer{}
+			errors := &bytes.Buffer{}
+			mock := &MockSearch{}
+
+			d := uci.NewDriver(
+				uci.WithInput(strings.NewReader(tt.inputs)),
+				uci.WithOutput(outputs),
+				uci.WithError(errors),
+				uci.WithSearch(mock),
+			)
+
+			d.Run()
+
+			assert.Empty(t, errors)
+			assert.Equal(t, tt.softNodes, mock.Options.SoftNodes)
+			assert.Equal(t, tt.nodes, mock.Options.Nodes)
+			assert.Equal(t, tt.multiPV, mock.Options.MultiPV)
+			assert.InDelta(t, tt.temperature, mock.Options.Temperature, 0.001)
+			if tt.noisy {
+				assert.IsType(t, &search.Noisy{}, mock.Eval)
+			} else if mock.Eval != nil {
+				assert.IsType(t, &search.HCE{}, mock.Eval)
+			}
+		})
+	}
+}
+
+func TestStrengthInfo(t *testing.T) {
+	tests := []struct {
+		name   string
+		inputs string
+		want   []string
+	}{
+		{"full strength", "go", []string{"multipv 1 ", "multipv 2 ", "multipv 3 ", "multipv 4 "}},
+		{"limit strength", "setoption name UCI_LimitStrength value true\ngo", []string{"info depth 5 seldepth 0 score "}},
+		{"limit strength multipv",
+			"setoption name MultiPV value 2\nsetoption name UCI_LimitStrength value true\ngo",
+			[]string{"info depth 5 seldepth 0 multipv 1 ", "info depth 5 seldepth 0 multipv 2 "}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputs := &bytes.Buffer{}
+			errors := &bytes.Buffer{}
+			// the weakest handicap searches 4 lines, only the lines asked for are
+			// reported
+			mock := &MockSearch{}
+			for i := range 4 {
+				mock.Infos = append(mock.Infos, search.Info{Depth: 5, MultiPV: i + 1})
+			}
+
+			d := uci.NewDriver(
+				uci.WithInput(strings.NewReader(tt.inputs)),
+				uci.WithOutput(outputs),
+				uci.WithError(errors),
+				uci.WithSearch(mock),
+			)
+
+			d.Run()
+
+			assert.Empty(t, errors)
+			assert.Equal(t, len(tt.want), strings.Count(outputs.String(), "info depth"))
+			for _, want := range tt.want {
+				assert.Contains(t, outputs.String(), want)
+			}
+		})
+	}
+}
+
+func TestGoMate(t *testing.T) {
+	inputs := `uci
+go mate 3
+`
+
+	outputs := &bytes.Buffer{}
+	errors := &bytes.Buffer{}
+
+	search := &MockSearch{}
+
+	d := uci.NewDriver(
+		uci.WithInput(strings.NewReader(inputs)),
+		uci.WithOutput(outputs),
+		uci.WithError(errors),
+		uci.WithSearch(search),
+	)
+
+	d.Run()
+
+	assert.Empty(t, errors)
+	assert.Equal(t, 3, search.Options.Mate)
+}
+
 func TestDebug(t *testing.T) {
 	tests := []struct {
 		name      string
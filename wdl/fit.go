@@ -0,0 +1,123 @@
+package wdl
+
+import (
+	"math"
+
+	. "github.com/paulsonkoly/chess-3/chess"
+)
+
+// Outcome is the game outcome from the side to move's point of view.
+type Outcome byte
+
+const (
+	Loss = Outcome(iota)
+	Draw
+	Win
+)
+
+// Sample is a searched position with the outcome of its game.
+type Sample struct {
+	Score    Score // Score is the search score from the side to move's point of view.
+	Material int   // Material is the material count, see MaterialCount.
+	Ply      int   // Ply is the game ply.
+	Outcome  Outcome
+}
+
+// Adam optimizer parameters of Fit.
+const (
+	beta1   = 0.9
+	beta2   = 0.999
+	epsilon = 1e-8
+)
+
+// Fit fits the model m to samples by maximizing the likelihood of the
+// outcomes with iters full batch Adam steps of learning rate lr, starting from
+// the parameters in m. Samples with mate scores are ignored. It returns the
+// average negative log likelihood of the fitted model.
+func (m *Model) Fit(samples []Sample, iters int, lr float64) float64 {
+	type point struct {
+		x       float64
+		f       [Features]float64
+		outcome Outcome
+	}
+
+	points := make([]point, 0, len(samples))
+	for _, s := range samples {
+		if !s.Score.IsMate() {
+			points = append(points, point{float64(s.Score), features(s.Material, s.Ply), s.Outcome})
+		}
+	}
+	if len(points) == 0 {
+		return 0
+	}
+
+	var mom, vel [2][Features]float64
+
+	for it := 1; it <= iters; it++ {
+		var grad [2][Features]float64
+
+		for _, p := range points {
+			dA, dB := m.gradient(p.x, p.f, p.outcome)
+			for i := range Features {
+				grad[0][i] += dA * p.f[i]
+				grad[1][i] += dB * p.f[i]
+			}
+		}
+
+		params := [2]*[Features]float64{&m.A, &m.B}
+		for j := range params {
+			for i := range Features {
+				g := grad[j][i] / float64(len(points))
+				mom[j][i] = beta1*mom[j][i] + (1-beta1)*g
+				vel[j][i] = beta2*vel[j][i] + (1-beta2)*g*g
+
+				mHat := mom[j][i] / (1 - math.Pow(beta1, float64(it)))
+				vHat := vel[j][i] / (1 - math.Pow(beta2, float64(it)))
+				params[j][i] -= lr * mHat / (math.Sqrt(vHat) + epsilon)
+			}
+		}
+	}
+
+	loss := 0.0
+	for _, p := range points {
+		loss -= math.Log(m.likelihood(p.x, p.f, p.outcome))
+	}
+	return loss / float64(len(points))
+}
+
+// minP is the smallest outcome probability considered, for numerical
+// stability.
+const minP = 1e-9
+
+// likelihood is the model probability of outcome with score x and features f.
+func (m *Model) likelihood(x float64, f [Features]float64, outcome Outcome) float64 {
+	a, b := m.params(f)
+	w, d, l := probabilities(x, a, b)
+	return max([...]float64{Loss: l, Draw: d, Win: w}[outcome], minP)
+}
+
+// gradient is the gradient of the negative log likelihood of outcome by the
+// model parameters a and b, with score x and features f.
+func (m *Model) gradient(x float64, f [Features]float64, outcome Outcome) (dA, dB float64) {
+	a, b := m.params(f)
+	w, d, l := probabilities(x, a, b)
+
+	// derivatives of the win and loss probabilities by a and b
+	dwA := -w * (1 - w) / b
+	dwB := -w * (1 - w) * (x - a) / (b * b)
+	dlA := -l * (1 - l) / b
+	dlB := -l * (1 - l) * (-x - a) / (b * b)
+
+	var p, dpA, dpB float64
+	switch outcome {
+	case Win:
+		p, dpA, dpB = w, dwA, dwB
+	case Loss:
+		p, dpA, dpB = l, dlA, dlB
+	default:
+		p, dpA, dpB = d, -dwA-dlA, -dwB-dlB
+	}
+
+	p = max(p, minP)
+	return -dpA / p, -dpB / p
+}
@@ -0,0 +1,108 @@
+// Package wdl converts search scores to win, draw and loss probabilities.
+package wdl
+
+import (
+	"math"
+
+	"github.com/paulsonkoly/chess-3/board"
+
+	. "github.com/paulsonkoly/chess-3/chess"
+)
+
+// Feature indices of the model parameters.
+const (
+	Constant = iota
+	Material
+	MaterialSq
+	Ply
+
+	Features
+)
+
+// Model is a logistic model of the game outcome. The win probability of a
+// score x is 1 / (1 + exp((a - x) / b)), the loss probability is the win
+// probability of -x, and the rest is the draw probability. a and b are linear
+// in the features of the position, the material on the board and the game
+// ply.
+type Model struct {
+	A [Features]float64 // A are the weights of a, the score of a 50% win.
+	B [Features]float64 // B are the weights of b, the spread of the scores.
+}
+
+// Default is the model used by the engine.
+//
+// The parameters are fitted with chess-3/tools/wdlfit -iterations 6000 to 1501
+// datagen games of 145736 positions.
+var Default = Model{
+	A: [Features]float64{204.51, -285.81, 157.63, 89.05},
+	B: [Features]float64{72.37, -42.87, 40.33, 9.15},
+}
+
+// minB is the smallest spread of the scores the model accepts.
+const minB = 1
+
+// features are the feature values of a position with material and ply.
+// Material is normalized to the 17..78 range of Stockfish's model, ply is in
+// 100s capped at 240.
+func features(material, ply int) [Features]float64 {
+	m := float64(Clamp(material, 17, 78)) / 58
+	return [Features]float64{
+		Constant:   1,
+		Material:   m,
+		MaterialSq: m * m,
+		Ply:        float64(Clamp(ply, 0, 240)) / 100,
+	}
+}
+
+// params are the a and b model parameters of features f.
+func (m *Model) params(f [Features]float64) (a, b float64) {
+	for i := range f {
+		a += m.A[i] * f[i]
+		b += m.B[i] * f[i]
+	}
+	return a, max(b, minB)
+}
+
+// probabilities are the win, draw and loss probabilities of score x with the
+// model parameters a and b.
+func probabilities(x, a, b float64) (w, d, l float64) {
+	w = 1 / (1 + math.Exp((a-x)/b))
+	l = 1 / (1 + math.Exp((a+x)/b))
+	return w, 1 - w - l, l
+}
+
+// Probabilities are the win, draw and loss probabilities in per mille of the
+// score s with material and ply. The probabilities sum to 1000.
+func (m *Model) Probabilities(s Score, material, ply int) (w, d, l int) {
+	if s.IsMate() {
+		if s > 0 {
+			return 1000, 0, 0
+		}
+		return 0, 0, 1000
+	}
+
+	a, b := m.params(features(material, ply))
+	pw, _, pl := probabilities(float64(s), a, b)
+
+	w = int(math.Round(1000 * pw))
+	l = int(math.Round(1000 * pl))
+	return w, 1000 - w - l, l
+}
+
+// WDL are the win, draw and loss probabilities in per mille of the score s in
+// the position b.
+func (m *Model) WDL(b *board.Board, s Score) (w, d, l int) {
+	return m.Probabilities(s, MaterialCount(b), b.Ply())
+}
+
+var pieceValues = [...]int{Pawn: 1, Knight: 3, Bishop: 3, Rook: 5, Queen: 9}
+
+// MaterialCount is the material on the board, counting pawns 1, minors 3,
+// rooks 5 and queens 9.
+func MaterialCount(b *board.Board) int {
+	cnt := 0
+	for pt := Pawn; pt < King; pt++ {
+		cnt += b.Pieces[pt].Count() * pieceValues[pt]
+	}
+	return cnt
+}
@@ -0,0 +1,108 @@
+package wdl
+
+import (
+	"math/rand/v2"
+	"testing"
+
+	"github.com/paulsonkoly/chess-3/board"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/paulsonkoly/chess-3/chess"
+)
+
+func TestProbabilities(t *testing.T) {
+	tests := []struct {
+		name     string
+		score    Score
+		material int
+		ply      int
+	}{
+		{"even opening", 0, 78, 10},
+		{"winning opening", 300, 78, 10},
+		{"losing endgame", -150, 20, 120},
+		{"material out of range", 50, 100, 500},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, d, l := Default.Probabilities(tt.score, tt.material, tt.ply)
+
+			assert.Equal(t, 1000, w+d+l)
+			assert.GreaterOrEqual(t, d, 0)
+
+			// the model is symmetric
+			w2, d2, l2 := Default.Probabilities(-tt.score, tt.material, tt.ply)
+			assert.Equal(t, []int{w, d, l}, []int{l2, d2, w2})
+
+			// better scores win more
+			w3, _, l3 := Default.Probabilities(tt.score+50, tt.material, tt.ply)
+			assert.Greater(t, w3, w)
+			assert.LessOrEqual(t, l3, l)
+		})
+	}
+
+	w, d, l := Default.Probabilities(Inf-3, 78, 10)
+	assert.Equal(t, []int{1000, 0, 0}, []int{w, d, l})
+
+	w, d, l = Default.Probabilities(-Inf+4, 78, 10)
+	assert.Equal(t, []int{0, 0, 1000}, []int{w, d, l})
+}
+
+func TestWDL(t *testing.T) {
+	b := Must(board.FromFEN("4k3/8/8/8/8/8/4P3/R3K3 b - - 0 31"))
+
+	assert.Equal(t, 6, MaterialCount(b))
+	assert.Equal(t, 61, b.Ply())
+
+	w, d, l := Default.WDL(b, 100)
+	ew, ed, el := Default.Probabilities(100, 6, 61)
+	assert.Equal(t, []int{ew, ed, el}, []int{w, d, l})
+}
+
+func TestFit(t *testing.T) {
+	want := Model{
+		A: [Features]float64{120, 80, -20, 20},
+		B: [Features]float64{60, 20, 0, 5},
+	}
+
+	r := rand.New(rand.NewPCG(1, 2))
+	samples := make([]Sample, 20000)
+	for i := range samples {
+		s := Sample{
+			Score:    Score(r.IntN(1000) - 500),
+			Material: 10 + r.IntN(70),
+			Ply:      r.IntN(200),
+		}
+
+		a, b := want.params(features(s.Material, s.Ply))
+		w, d, _ := probabilities(float64(s.Score), a, b)
+		switch p := r.Float64(); {
+		case p < w:
+			s.Outcome = Win
+		case p < w+d:
+			s.Outcome = Draw
+		default:
+			s.Outcome = Loss
+		}
+
+		samples[i] = s
+	}
+	samples = append(samples, Sample{Score: Inf - 1, Outcome: Loss})
+
+	m := Default
+	initial := m.Fit(samples, 0, 0)
+	loss := m.Fit(samples, 500, 2)
+	assert.Less(t, loss, initial)
+
+	truth := want
+	assert.InDelta(t, truth.Fit(samples, 0, 0), loss, 0.005)
+
+	for _, tt := range []struct{ score, material, ply int }{{0, 78, 10}, {200, 40, 60}, {-100, 20, 150}} {
+		w, d, l := m.Probabilities(Score(tt.score), tt.material, tt.ply)
+		ew, ed, el := want.Probabilities(Score(tt.score), tt.material, tt.ply)
+
+		assert.InDelta(t, ew, w, 30)
+		assert.InDelta(t, ed, d, 30)
+		assert.InDelta(t, el, l, 30)
+	}
+}
@@ -0,0 +1,49 @@
+package xboard
+
+import (
+	"time"
+
+	"github.com/paulsonkoly/chess-3/engine"
+
+	. "github.com/paulsonkoly/chess-3/chess"
+)
+
+// timeControl is the time control of the game set by the level, st and sd
+// commands, and the clocks set by the time and otim commands.
+type timeControl struct {
+	mps   int           // mps is the number of moves per session, 0 for incremental.
+	base  time.Duration // base is the time per session.
+	inc   time.Duration // inc is the increment per move.
+	st    time.Duration // st is the exact time per move, 0 for none.
+	depth Depth         // depth is the depth limit, 0 for none.
+	own   time.Duration // own is the engine's clock.
+	opp   time.Duration // opp is the opponent's clock.
+}
+
+// defaultTimeControl is the time control until the GUI sets one, 40 moves in
+// 5 minutes.
+var defaultTimeControl = timeControl{mps: 40, base: 5 * time.Minute, own: 5 * time.Minute, opp: 5 * time.Minute}
+
+// limits are the search limits of the engine playing stm at ply, reserving
+// overhead per move for communication.
+func (tc timeControl) limits(stm Color, ply int, overhead time.Duration) engine.Limits {
+	limits := engine.Limits{Depth: tc.depth, Overhead: overhead}
+
+	if tc.st > 0 {
+		limits.MoveTime = tc.st
+		return limits
+	}
+
+	if tc.mps > 0 {
+		limits.MovesToGo = tc.mps - (ply/2)%tc.mps
+	}
+
+	limits.WInc, limits.BInc = tc.inc, tc.inc
+	if stm == White {
+		limits.WTime, limits.BTime = tc.own, tc.opp
+	} else {
+		limits.WTime, limits.BTime = tc.opp, tc.own
+	}
+
+	return limits
+}
@@ -0,0 +1,77 @@
+package xboard
+
+import (
+	"testing"
+	"time"
+
+	"github.com/paulsonkoly/chess-3/engine"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/paulsonkoly/chess-3/chess"
+)
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		name string
+		tc   timeControl
+		stm  Color
+		ply  int
+		want engine.Limits
+	}{
+		{
+			"exact time",
+			timeControl{st: 5 * time.Second, depth: 7},
+			White, 0,
+			engine.Limits{MoveTime: 5 * time.Second, Depth: 7, Overhead: DefaultMoveOverhead},
+		},
+		{
+			"incremental",
+			timeControl{base: time.Minute, inc: time.Second, own: 40 * time.Second, opp: 50 * time.Second},
+			Black, 21,
+			engine.Limits{
+				WTime: 50 * time.Second, BTime: 40 * time.Second, WInc: time.Second, BInc: time.Second,
+				Overhead: DefaultMoveOverhead,
+			},
+		},
+		{
+			"conventional",
+			timeControl{mps: 40, base: 5 * time.Minute, own: time.Minute, opp: 2 * time.Minute},
+			White, 90,
+			engine.Limits{WTime: time.Minute, BTime: 2 * time.Minute, MovesToGo: 35, Overhead: DefaultMoveOverhead},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.tc.limits(tt.stm, tt.ply, DefaultMoveOverhead))
+		})
+	}
+}
+
+func TestParseBase(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"5", 5 * time.Minute, false},
+		{"0:30", 30 * time.Second, false},
+		{"2:05", 2*time.Minute + 5*time.Second, false},
+		{"2:60", 0, true},
+		{"x", 0, true},
+		{"-1", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseBase(tt.value)
+
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,529 @@
+// Package xboard is the XBoard (chess engine communication protocol version 2)
+// driver of the engine.
+package xboard
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/paulsonkoly/chess-3/engine"
+	"github.com/paulsonkoly/chess-3/search"
+	"github.com/paulsonkoly/chess-3/transp"
+
+	. "github.com/paulsonkoly/chess-3/chess"
+)
+
+const (
+	// DefaultMoveOverhead is the default time reserved for communication per
+	// move.
+	DefaultMoveOverhead = 30 * time.Millisecond
+	// mateScore is the base of the mate scores in the thinking output.
+	mateScore = 100_000
+)
+
+var GitVersion = "dev"
+
+// Driver is an XBoard driver for the underlying chess engine. It receives and
+// interprets the protocol commands, and runs the engine asynchronously, so
+// commands can interrupt it.
+//
+// Pondering is not supported, hard and easy are accepted and ignored.
+type Driver struct {
+	engine *engine.Engine
+	input  *bufio.Scanner
+	output *output
+	err    io.Writer
+	lines  chan string
+	tc     timeControl
+	think  *thinking // think is the running search, nil if the engine is idle.
+	side   Color     // side is the side played by the engine.
+	force  bool      // force is the force mode, the engine plays neither side.
+	post   atomic.Bool
+	// analyze is the analyze mode, the engine searches the position without
+	// playing.
+	analyze atomic.Bool
+	// overhead is the time reserved for communication per move.
+	overhead time.Duration
+}
+
+// output is an io.Writer synchronizing the writes of the driver and the
+// search.
+type output struct {
+	writer io.Writer
+	mu     sync.Mutex
+}
+
+// Write implements io.Writer.
+func (o *output) Write(buf []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.writer.Write(buf)
+}
+
+// thinking is a search running in the background.
+type thinking struct {
+	cancel context.CancelFunc
+	done   chan result
+}
+
+// result is the outcome of a search.
+type result struct {
+	engine.Result
+	err error
+}
+
+type driverOpts struct {
+	input    io.Reader
+	output   io.Writer
+	err      io.Writer
+	overhead time.Duration
+}
+
+// WithInput replaces the default os.Stdin in the driver with the user specified io.Reader.
+func WithInput(input io.Reader) DriverOpt { return func(o *driverOpts) { o.input = input } }
+
+// WithOutput replaces the default os.Stdout in the driver with the user specified io.Writer.
+func WithOutput(output io.Writer) DriverOpt { return func(o *driverOpts) { o.output = output } }
+
+// WithError replaces the default os.Stderr in the driver with the user specified io.Writer.
+func WithError(err io.Writer) DriverOpt { return func(o *driverOpts) { o.err = err } }
+
+// WithMoveOverhead sets the time reserved for communication per move, instead
+// of the default DefaultMoveOverhead.
+func WithMoveOverhead(overhead time.Duration) DriverOpt {
+	return func(o *driverOpts) { o.overhead = overhead }
+}
+
+// DriverOpt is an option for creating a new XBoard driver.
+type DriverOpt func(*driverOpts)
+
+// NewDriver creates a new XBoard driver based on opts.
+func NewDriver(opts ...DriverOpt) *Driver {
+	actual := driverOpts{
+		input:    os.Stdin,
+		output:   os.Stdout,
+		err:      os.Stderr,
+		overhead: DefaultMoveOverhead,
+	}
+
+	for _, opt := range opts {
+		opt(&actual)
+	}
+
+	d := &Driver{
+		input:    bufio.NewScanner(actual.input),
+		output:   &output{writer: actual.output},
+		err:      actual.err,
+		tc:       defaultTimeControl,
+		side:     Black,
+		overhead: actual.overhead,
+	}
+	d.engine = engine.New(engine.WithInfoHandler(d.info))
+
+	return d
+}
+
+// Run executes an input loop reading from the input and in parallel running
+// and controlling the search.
+func (d *Driver) Run() {
+	d.lines = make(chan string)
+
+	wg := sync.WaitGroup{}
+	wg.Go(func() {
+		d.readInput()
+		close(d.lines)
+	})
+
+	d.handleInput()
+
+	wg.Wait()
+}
+
+func (d *Driver) readInput() {
+	for d.input.Scan() {
+		line := d.input.Text()
+		d.lines <- line
+
+		if strings.TrimSpace(line) == "quit" {
+			return
+		}
+	}
+}
+
+func (d *Driver) handleInput() {
+	for {
+		var done <-chan result
+		if d.think != nil {
+			done = d.think.done
+		}
+
+		select {
+		case line, ok := <-d.lines:
+			if !ok || d.handleCommand(line) {
+				d.stop()
+				return
+			}
+
+		case r := <-done:
+			d.finish(r)
+		}
+	}
+}
+
+func (d *Driver) handleCommand(command string) (quit bool) {
+	parts := strings.Fields(command)
+	if len(parts) == 0 {
+		return false
+	}
+
+	switch parts[0] {
+	case "xboard", "accepted", "rejected", "random", "computer", "name", "rating", "ics", "draw", "hard", "easy", ".":
+
+	case "protover":
+		fmt.Fprintf(d.output, "feature myname=\"chess-3 %s\" setboard=1 usermove=1 ping=1 analyze=1 colors=0 "+
+			"sigint=0 sigterm=0 san=0 done=1\n", GitVersion)
+
+	case "new":
+		d.stop()
+		d.engine.NewGame()
+		d.force = false
+		d.side = Black
+		d.tc.depth = 0
+		d.tc.own, d.tc.opp = d.tc.base, d.tc.base
+		d.restartAnalysis()
+
+	case "force":
+		d.stop()
+		d.force = true
+
+	case "go":
+		d.stop()
+		d.force = false
+		d.side = d.engine.Board().STM
+		d.startThinking()
+
+	case "playother":
+		d.stop()
+		d.force = false
+		d.side = d.engine.Board().STM.Flip()
+
+	case "usermove":
+		d.handleUserMove(parts[1:])
+
+	case "?":
+		if d.think != nil && !d.analyze.Load() {
+			d.think.cancel()
+		}
+
+	case "ping":
+		fmt.Fprintf(d.output, "pong %s\n", strings.Join(parts[1:], " "))
+
+	case "level":
+		d.handleLevel(parts[1:])
+
+	case "st":
+		d.handleSt(parts[1:])
+
+	case "sd":
+		if len(parts) < 2 {
+			fmt.Fprintln(d.err, "depth missing")
+			break
+		}
+		d.tc.depth = Depth(Clamp(parseInt(parts[1]), 0, MaxPlies-1))
+
+	case "time":
+		d.tc.own = parseCentiseconds(parts[1:])
+
+	case "otim":
+		d.tc.opp = parseCentiseconds(parts[1:])
+
+	case "undo":
+		d.handleUndo(1)
+
+	case "remove":
+		d.handleUndo(2)
+
+	case "post":
+		d.post.Store(true)
+
+	case "nopost":
+		d.post.Store(false)
+
+	case "analyze":
+		d.stop()
+		d.analyze.Store(true)
+		d.restartAnalysis()
+
+	case "exit":
+		d.stop()
+		d.analyze.Store(false)
+
+	case "setboard":
+		d.stop()
+		if err := d.engine.SetPosition(strings.Join(parts[1:], " "), nil); err != nil {
+			fmt.Fprintln(d.output, "tellusererror Illegal position")
+			fmt.Fprintln(d.err, err)
+		}
+		d.restartAnalysis()
+
+	case "result":
+		d.stop()
+
+	case "quit":
+		return true
+
+	default:
+		fmt.Fprintf(d.output, "Error (unknown command): %s\n", parts[0])
+	}
+
+	return false
+}
+
+// handleUserMove plays the opponent's move in args, and starts thinking if
+// the engine is to move.
+func (d *Driver) handleUserMove(args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(d.output, "Error (move missing): usermove")
+		return
+	}
+
+	d.stop()
+
+	if err := d.engine.Play(args[0]); err != nil {
+		fmt.Fprintf(d.output, "Illegal move: %s\n", args[0])
+		fmt.Fprintln(d.err, err)
+		d.restartAnalysis()
+		return
+	}
+
+	if d.analyze.Load() {
+		d.restartAnalysis()
+		return
+	}
+
+	if !d.force && d.engine.Board().STM == d.side {
+		d.startThinking()
+	}
+}
+
+// handleUndo takes back n moves.
+func (d *Driver) handleUndo(n int) {
+	d.stop()
+
+	for range n {
+		if err := d.engine.Undo(); err != nil {
+			fmt.Fprintln(d.err, err)
+			break
+		}
+	}
+
+	d.restartAnalysis()
+}
+
+// handleLevel sets the conventional or incremental time control from args:
+// moves per session, base time in minutes or minutes:seconds, and increment
+// in seconds.
+func (d *Driver) handleLevel(args []string) {
+	if len(args) < 3 {
+		fmt.Fprintln(d.err, "argument missing")
+		return
+	}
+
+	mps, err := strconv.Atoi(args[0])
+	if err != nil || mps < 0 {
+		fmt.Fprintln(d.err, "invalid moves per session")
+		return
+	}
+
+	base, err := parseBase(args[1])
+	if err != nil {
+		fmt.Fprintln(d.err, err)
+		return
+	}
+
+	inc, err := strconv.ParseFloat(args[2], 64)
+	if err != nil || inc < 0 {
+		fmt.Fprintln(d.err, "invalid increment")
+		return
+	}
+
+	d.tc = timeControl{
+		mps:   mps,
+		base:  base,
+		inc:   time.Duration(inc * float64(time.Second)),
+		depth: d.tc.depth,
+		own:   base,
+		opp:   base,
+	}
+}
+
+// handleSt sets the exact time per move from args in seconds.
+func (d *Driver) handleSt(args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(d.err, "argument missing")
+		return
+	}
+
+	st, err := strconv.ParseFloat(args[0], 64)
+	if err != nil || st <= 0 {
+		fmt.Fprintln(d.err, "invalid time")
+		return
+	}
+
+	d.tc = timeControl{st: time.Duration(st * float64(time.Second)), depth: d.tc.depth}
+}
+
+// startThinking starts searching for the engine's move in the background.
+func (d *Driver) startThinking() {
+	b := d.engine.Board()
+	d.start(d.tc.limits(b.STM, b.Ply(), d.overhead))
+}
+
+// restartAnalysis starts analysing the current position in analyze mode.
+func (d *Driver) restartAnalysis() {
+	if d.analyze.Load() {
+		d.start(engine.Limits{})
+	}
+}
+
+// start starts a search in the background within limits.
+func (d *Driver) start(limits engine.Limits) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &thinking{cancel: cancel, done: make(chan result, 1)}
+
+	go func() {
+		r, err := d.engine.Think(ctx, limits)
+		t.done <- result{r, err}
+	}()
+
+	d.think = t
+}
+
+// stop interrupts the running search discarding its result.
+func (d *Driver) stop() {
+	if d.think == nil {
+		return
+	}
+
+	d.think.cancel()
+	<-d.think.done
+	d.think = nil
+}
+
+// finish handles the result r of the search that finished on its own or by
+// the move now command. The move is played unless the engine is analysing.
+func (d *Driver) finish(r result) {
+	d.think.cancel()
+	d.think = nil
+
+	if d.analyze.Load() {
+		return
+	}
+
+	if errors.Is(r.err, engine.ErrNoMoves) {
+		b := d.engine.Board()
+		switch {
+		case !b.InCheck(b.STM):
+			fmt.Fprintln(d.output, "1/2-1/2 {Stalemate}")
+		case b.STM == White:
+			fmt.Fprintln(d.output, "0-1 {Black mates}")
+		default:
+			fmt.Fprintln(d.output, "1-0 {White mates}")
+		}
+		return
+	}
+
+	// move now has to move, a search without a move is done again to depth 1
+	if r.err != nil {
+		fmt.Fprintln(d.err, r.err)
+
+		if r.Result, r.err = d.engine.Think(context.Background(), engine.Limits{Depth: 1}); r.err != nil {
+			fmt.Fprintln(d.err, r.err)
+			return
+		}
+	}
+
+	if err := d.engine.Play(r.Move.String()); err != nil {
+		fmt.Fprintln(d.err, err)
+		return
+	}
+	fmt.Fprintf(d.output, "move %s\n", r.Move)
+}
+
+// info writes the thinking output of the search: ply, score, time in
+// centiseconds, nodes and the principal variation.
+func (d *Driver) info(info search.Info) {
+	if !d.post.Load() && !d.analyze.Load() {
+		return
+	}
+
+	if info.Kind != search.PVInfo || info.Bound != transp.Exact || info.MultiPV > 1 || len(info.PV) == 0 {
+		return
+	}
+
+	pv := make([]string, 0, len(info.PV))
+	for _, m := range info.PV {
+		pv = append(pv, m.String())
+	}
+
+	fmt.Fprintf(d.output, "%d %d %d %d %s\n",
+		info.Depth, score(info.Score), info.Time/10, info.Nodes, strings.Join(pv, " "))
+}
+
+// score is s in the thinking output format, mate in n moves is reported as
+// mateScore + n, being mated in n moves as -mateScore - n.
+func score(s Score) int {
+	n, ok := s.MateMoves()
+	switch {
+	case !ok:
+		return int(s)
+	case s > 0:
+		return mateScore + n
+	}
+	return -mateScore + n
+}
+
+func parseInt(value string) int {
+	result, err := strconv.Atoi(value)
+	if err != nil {
+		return 0
+	}
+	return result
+}
+
+// parseCentiseconds parses the clock time of the time and otim commands.
+func parseCentiseconds(args []string) time.Duration {
+	if len(args) < 1 {
+		return 0
+	}
+	return time.Duration(parseInt(args[0])) * 10 * time.Millisecond
+}
+
+// parseBase parses the base time of the level command, given in minutes or in
+// minutes:seconds.
+func parseBase(value string) (time.Duration, error) {
+	minutes, seconds, found := strings.Cut(value, ":")
+
+	m, err := strconv.Atoi(minutes)
+	if err != nil || m < 0 {
+		return 0, errors.New("invalid base time")
+	}
+
+	s := 0
+	if found {
+		if s, err = strconv.Atoi(seconds); err != nil || s < 0 || s > 59 {
+			return 0, errors.New("invalid base time")
+		}
+	}
+
+	return time.Duration(m)*time.Minute + time.Duration(s)*time.Second, nil
+}
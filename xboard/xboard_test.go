@@ -0,0 +1,202 @@
+package xboard_test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/paulsonkoly/chess-3/xboard"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// session is a driver running in the background, fed through a pipe.
+type session struct {
+	input  *io.PipeWriter
+	output chan string
+	done   chan struct{}
+}
+
+func newSession(t *testing.T) *session {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+
+	s := &session{input: inW, output: make(chan string, 1024), done: make(chan struct{})}
+
+	d := xboard.NewDriver(xboard.WithInput(inR), xboard.WithOutput(outW), xboard.WithError(io.Discard))
+
+	go func() {
+		d.Run()
+		outW.Close()
+	}()
+
+	go func() {
+		defer close(s.done)
+		scanner := bufio.NewScanner(outR)
+		for scanner.Scan() {
+			s.output <- scanner.Text()
+		}
+		close(s.output)
+	}()
+
+	t.Cleanup(func() {
+		s.send("quit")
+		inW.Close()
+		<-s.done
+	})
+
+	return s
+}
+
+func (s *session) send(commands ...string) {
+	for _, c := range commands {
+		fmt.Fprintln(s.input, c)
+	}
+}
+
+// expect reads the output until a line matching re, returning the lines read.
+func (s *session) expect(t *testing.T, re string) []string {
+	t.Helper()
+	pattern := regexp.MustCompile(re)
+	lines := []string{}
+
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case line, ok := <-s.output:
+			require.True(t, ok, "output closed waiting for %q", re)
+			lines = append(lines, line)
+			if pattern.MatchString(line) {
+				return lines
+			}
+
+		case <-timeout:
+			require.Fail(t, "timeout", "waiting for %q", re)
+		}
+	}
+}
+
+func TestProtover(t *testing.T) {
+	s := newSession(t)
+	s.send("xboard", "protover 2")
+
+	lines := s.expect(t, "^feature ")
+	line := lines[len(lines)-1]
+
+	for _, feature := range []string{"setboard=1", "usermove=1", "ping=1", "analyze=1", "done=1"} {
+		assert.Contains(t, line, feature)
+	}
+}
+
+func TestPing(t *testing.T) {
+	s := newSession(t)
+	s.send("xboard", "ping 7")
+
+	s.expect(t, "^pong 7$")
+}
+
+func TestUnknownCommand(t *testing.T) {
+	s := newSession(t)
+	s.send("xboard", "foo")
+
+	s.expect(t, `^Error \(unknown command\): foo$`)
+}
+
+func TestUserMove(t *testing.T) {
+	s := newSession(t)
+	s.send("xboard", "new", "sd 3", "usermove e2e4")
+
+	s.expect(t, "^move [a-h][1-8][a-h][1-8]$")
+}
+
+func TestIllegalMove(t *testing.T) {
+	s := newSession(t)
+	s.send("xboard", "new", "force", "usermove e2e5")
+
+	s.expect(t, "^Illegal move: e2e5$")
+}
+
+func TestForceGo(t *testing.T) {
+	s := newSession(t)
+	s.send("xboard", "new", "force", "usermove e2e4", "usermove e7e5", "sd 3", "go")
+
+	lines := s.expect(t, "^move ")
+	assert.Len(t, lines, 1)
+}
+
+func TestUndoRemove(t *testing.T) {
+	s := newSession(t)
+	s.send("xboard", "new", "force", "usermove e2e4", "usermove e7e5", "undo", "usermove e7e5", "remove",
+		"usermove e2e4", "ping 1")
+
+	lines := s.expect(t, "^pong 1$")
+	assert.Equal(t, []string{"pong 1"}, lines)
+}
+
+func TestSetboard(t *testing.T) {
+	tests := []struct {
+		name string
+		fen  string
+		want string
+	}{
+		{"single move", "7k/8/8/8/8/8/6q1/K7 w - - 0 1", "^move a1b1$"},
+		{"checkmate", "rnb1kbnr/pppp1ppp/8/4p3/6Pq/5P2/PPPPP2P/RNBQKBNR w KQkq - 1 3", `^0-1 \{Black mates\}$`},
+		{"stalemate", "7k/5Q2/6K1/8/8/8/8/8 b - - 0 1", `^1/2-1/2 \{Stalemate\}$`},
+		{"invalid", "8/8/8/8/8/8/8/8 w - - 0 1", "^tellusererror Illegal position$"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSession(t)
+			s.send("xboard", "new", "force", "sd 3", "setboard "+tt.fen, "go")
+
+			s.expect(t, tt.want)
+		})
+	}
+}
+
+func TestPost(t *testing.T) {
+	s := newSession(t)
+	s.send("xboard", "new", "post", "sd 4", "usermove e2e4")
+
+	thinking := regexp.MustCompile(`^\d+ -?\d+ \d+ \d+( [a-h][1-8][a-h][1-8][nbrq]?)+$`)
+
+	lines := s.expect(t, "^move ")
+	require.Greater(t, len(lines), 1)
+	for _, line := range lines[:len(lines)-1] {
+		assert.Regexp(t, thinking, line)
+	}
+	assert.True(t, strings.HasPrefix(lines[len(lines)-2], "4 "))
+}
+
+func TestAnalyze(t *testing.T) {
+	s := newSession(t)
+	s.send("xboard", "new", "force", "analyze")
+
+	s.expect(t, `^\d+ -?\d+ \d+ \d+ `)
+
+	s.send("usermove e2e4")
+	s.expect(t, `^\d+ -?\d+ \d+ \d+ [a-h][1-8][a-h][1-8]`)
+
+	s.send("exit", "ping 1")
+	for _, line := range s.expect(t, "^pong 1$") {
+		assert.False(t, strings.HasPrefix(line, "move "), line)
+	}
+}
+
+// TestMoveNow tests that move now right after the search started still
+// moves. The search is started and interrupted repeatedly to hit the race of
+// the two.
+func TestMoveNow(t *testing.T) {
+	s := newSession(t)
+	s.send("xboard", "level 0 60 0")
+
+	for range 20 {
+		s.send("new", "time 360000", "otim 360000", "usermove e2e4", "?")
+		s.expect(t, "^move ")
+	}
+}